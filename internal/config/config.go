@@ -35,6 +35,102 @@ type CleanupConfig struct {
 	MaxAge   string `mapstructure:"max_age"`  // duration string (e.g., "168h")
 }
 
+type IDConfig struct {
+	Length           int    `mapstructure:"length"`            // Number of characters, or number of words for the "words" style
+	Style            string `mapstructure:"style"`             // "random" (default), "pronounceable" or "words"
+	Alphabet         string `mapstructure:"alphabet"`          // Characters random IDs are drawn from (defaults to URL-safe base64)
+	ExcludeAmbiguous bool   `mapstructure:"exclude_ambiguous"` // Leave out look-alike characters such as 0/O and 1/l/I
+}
+
+type IDsConfig struct {
+	Paste      IDConfig `mapstructure:"paste"`
+	Shortlink  IDConfig `mapstructure:"shortlink"`
+	Collection IDConfig `mapstructure:"collection"`
+}
+
+type ArchiveConfig struct {
+	MaxEntries   int   `mapstructure:"max_entries"`    // Maximum number of entries listed from an archive
+	MaxEntrySize int64 `mapstructure:"max_entry_size"` // Maximum uncompressed size of a single entry in bytes
+	MaxTotalSize int64 `mapstructure:"max_total_size"` // Maximum bytes decompressed while reading a tar archive
+	MaxRatio     int   `mapstructure:"max_ratio"`      // Maximum compression ratio of a single zip entry
+}
+
+type TusConfig struct {
+	Expiry time.Duration `mapstructure:"expiry"` // How long an incomplete resumable upload is kept (e.g., "24h")
+}
+
+type TCPConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`         // Accept pastes piped over raw TCP (e.g. `cat file | nc host 9999`)
+	Address        string        `mapstructure:"address"`         // Listen address for the TCP listener
+	IdleTimeout    time.Duration `mapstructure:"idle_timeout"`    // Finish the paste after this long without data
+	Timeout        time.Duration `mapstructure:"timeout"`         // Longest a single connection may stay open
+	MaxConnections int           `mapstructure:"max_connections"` // Connections handled at once, others are turned away
+}
+
+type SSHConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`   // Accept uploads and commands over SSH
+	Address   string `mapstructure:"address"`   // Listen address for the SSH server
+	HostKey   string `mapstructure:"host_key"`  // Path to the host private key, generated on first start if missing
+	Anonymous bool   `mapstructure:"anonymous"` // Accept public keys not linked to an API key, uploading anonymously
+
+	IdleTimeout    time.Duration `mapstructure:"idle_timeout"`    // Close connections that send nothing for this long
+	Timeout        time.Duration `mapstructure:"timeout"`         // Longest a single connection may stay open
+	MaxConnections int           `mapstructure:"max_connections"` // Connections handled at once, others are turned away
+}
+
+type FetchConfig struct {
+	Timeout      time.Duration `mapstructure:"timeout"`       // Total time allowed for fetching a remote URL, redirects included
+	MaxRedirects int           `mapstructure:"max_redirects"` // Maximum number of redirects followed
+	AllowPrivate bool          `mapstructure:"allow_private"` // Allow fetching loopback, private and link-local addresses
+}
+
+type ShortlinkConfig struct {
+	Interstitial string           `mapstructure:"interstitial"` // Warn before redirecting: "off", "new_keys" or "all"
+	NewKeyAge    time.Duration    `mapstructure:"new_key_age"`  // Keys younger than this get the "new_keys" warning
+	LinkCheck    LinkCheckConfig  `mapstructure:"link_check"`
+	Reputation   ReputationConfig `mapstructure:"reputation"`
+	Anonymous    AnonymousConfig  `mapstructure:"anonymous"`
+	Passwords    PasswordConfig   `mapstructure:"passwords"`
+	GeoIP        GeoIPConfig      `mapstructure:"geoip"`
+}
+
+type GeoIPConfig struct {
+	Database string        `mapstructure:"database"`  // MaxMind country or city database (.mmdb) that country rules look visitors up in
+	Remote   bool          `mapstructure:"remote"`    // Without a database, look visitors up on ip-api.com instead
+	CacheTTL time.Duration `mapstructure:"cache_ttl"` // How long remote lookups are cached
+}
+
+type PasswordConfig struct {
+	Limit  int           `mapstructure:"limit"`  // Wrong passwords of protected shortlinks one IP can try per window
+	Window time.Duration `mapstructure:"window"` // The window the limit applies to
+}
+
+type AnonymousConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`    // Let clients without an API key create shortlinks; needs reputation checks
+	Expiry    time.Duration `mapstructure:"expiry"`     // How long anonymous shortlinks last unless they ask for less
+	MaxExpiry time.Duration `mapstructure:"max_expiry"` // The longest anonymous shortlinks can ask to last
+	Limit     int           `mapstructure:"limit"`      // Shortlinks one IP can create per window
+	Window    time.Duration `mapstructure:"window"`     // The window the limit applies to
+}
+
+type ReputationConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`           // Check shortlink destinations against blocklists
+	DomainLists     []string      `mapstructure:"domain_lists"`      // Files of blocked domains, one per line; subdomains are blocked too
+	PatternLists    []string      `mapstructure:"pattern_lists"`     // Files of regular expressions matched against whole URLs
+	HashPrefixLists []string      `mapstructure:"hash_prefix_lists"` // Files of hex encoded SHA-256 prefixes of host/path expressions
+	ReloadInterval  time.Duration `mapstructure:"reload_interval"`   // How often the files are checked for changes
+	CheckRedirects  bool          `mapstructure:"check_redirects"`   // Check destinations again on every redirect
+	TrustedKeys     []string      `mapstructure:"trusted_keys"`      // API keys whose shortlinks skip the checks
+}
+
+type LinkCheckConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`     // Periodically check shortlink targets for broken links
+	Interval    time.Duration `mapstructure:"interval"`    // How often a working target is checked
+	Concurrency int           `mapstructure:"concurrency"` // Targets checked at the same time
+	Threshold   int           `mapstructure:"threshold"`   // Failed checks in a row before a link counts as broken
+	Notify      bool          `mapstructure:"notify"`      // Email the owning API key when one of its links breaks
+}
+
 type GlobalRateLimitConfig struct {
 	Enabled bool    `mapstructure:"enabled"` // Enable global rate limiting
 	Rate    float64 `mapstructure:"rate"`    // Requests per second
@@ -64,6 +160,12 @@ type ServerConfig struct {
 	ServerHeader      string          `mapstructure:"server_header"`
 	AppName           string          `mapstructure:"app_name"`
 	Cleanup           CleanupConfig   `mapstructure:"cleanup"`
+	Archive           ArchiveConfig   `mapstructure:"archive"`
+	Tus               TusConfig       `mapstructure:"tus"`
+	TCP               TCPConfig       `mapstructure:"tcp"`
+	SSH               SSHConfig       `mapstructure:"ssh"`
+	Fetch             FetchConfig     `mapstructure:"fetch"`
+	Shortlinks        ShortlinkConfig `mapstructure:"shortlinks"`
 	RateLimit         RateLimitConfig `mapstructure:"rate_limit"`
 	CORSOrigins       []string        `mapstructure:"cors_origins"`
 	ViewsDirectory    string          `mapstructure:"views_directory"`
@@ -71,14 +173,22 @@ type ServerConfig struct {
 }
 
 type SMTPConfig struct {
-	Enabled  bool   `mapstructure:"enabled"`
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
-	From     string `mapstructure:"from"`
-	FromName string `mapstructure:"from_name"`
-	StartTLS bool   `mapstructure:"starttls"`
+	Enabled  bool              `mapstructure:"enabled"`
+	Host     string            `mapstructure:"host"`
+	Port     int               `mapstructure:"port"`
+	Username string            `mapstructure:"username"`
+	Password string            `mapstructure:"password"`
+	From     string            `mapstructure:"from"`
+	FromName string            `mapstructure:"from_name"`
+	StartTLS bool              `mapstructure:"starttls"`
+	Inbound  InboundSMTPConfig `mapstructure:"inbound"`
+}
+
+type InboundSMTPConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`          // Turn mail sent to <inbound token>@domain into pastes
+	Address        string `mapstructure:"address"`          // Listen address for the SMTP receiver
+	Domain         string `mapstructure:"domain"`           // Domain of inbound addresses (defaults to the base URL's host)
+	MaxMessageSize int    `mapstructure:"max_message_size"` // Largest accepted message in bytes, attachments included
 }
 
 type RedisConfig struct {
@@ -106,6 +216,7 @@ type Config struct {
 	SMTP      SMTPConfig      `mapstructure:"smtp"`
 	Redis     RedisConfig     `mapstructure:"redis"`
 	Retention RetentionConfig `mapstructure:"retention"`
+	IDs       IDsConfig       `mapstructure:"ids"`
 }
 
 func Load() (*Config, error) {
@@ -141,6 +252,62 @@ func Load() (*Config, error) {
 	_ = viper.BindEnv("server.cleanup.interval", "0X_SERVER_CLEANUP_INTERVAL")
 	_ = viper.BindEnv("server.cleanup.max_age", "0X_SERVER_CLEANUP_MAX_AGE")
 
+	// Archive bindings
+	_ = viper.BindEnv("server.archive.max_entries", "0X_SERVER_ARCHIVE_MAX_ENTRIES")
+	_ = viper.BindEnv("server.archive.max_entry_size", "0X_SERVER_ARCHIVE_MAX_ENTRY_SIZE")
+	_ = viper.BindEnv("server.archive.max_total_size", "0X_SERVER_ARCHIVE_MAX_TOTAL_SIZE")
+	_ = viper.BindEnv("server.archive.max_ratio", "0X_SERVER_ARCHIVE_MAX_RATIO")
+
+	// Resumable upload bindings
+	_ = viper.BindEnv("server.tus.expiry", "0X_SERVER_TUS_EXPIRY")
+
+	// TCP listener bindings
+	_ = viper.BindEnv("server.tcp.enabled", "0X_SERVER_TCP_ENABLED")
+	_ = viper.BindEnv("server.tcp.address", "0X_SERVER_TCP_ADDRESS")
+	_ = viper.BindEnv("server.tcp.idle_timeout", "0X_SERVER_TCP_IDLE_TIMEOUT")
+	_ = viper.BindEnv("server.tcp.timeout", "0X_SERVER_TCP_TIMEOUT")
+	_ = viper.BindEnv("server.tcp.max_connections", "0X_SERVER_TCP_MAX_CONNECTIONS")
+
+	// SSH server bindings
+	_ = viper.BindEnv("server.ssh.enabled", "0X_SERVER_SSH_ENABLED")
+	_ = viper.BindEnv("server.ssh.address", "0X_SERVER_SSH_ADDRESS")
+	_ = viper.BindEnv("server.ssh.host_key", "0X_SERVER_SSH_HOST_KEY")
+	_ = viper.BindEnv("server.ssh.anonymous", "0X_SERVER_SSH_ANONYMOUS")
+	_ = viper.BindEnv("server.ssh.idle_timeout", "0X_SERVER_SSH_IDLE_TIMEOUT")
+	_ = viper.BindEnv("server.ssh.timeout", "0X_SERVER_SSH_TIMEOUT")
+	_ = viper.BindEnv("server.ssh.max_connections", "0X_SERVER_SSH_MAX_CONNECTIONS")
+
+	// Remote fetch bindings
+	_ = viper.BindEnv("server.fetch.timeout", "0X_SERVER_FETCH_TIMEOUT")
+	_ = viper.BindEnv("server.fetch.max_redirects", "0X_SERVER_FETCH_MAX_REDIRECTS")
+	_ = viper.BindEnv("server.fetch.allow_private", "0X_SERVER_FETCH_ALLOW_PRIVATE")
+
+	// Shortlink bindings
+	_ = viper.BindEnv("server.shortlinks.interstitial", "0X_SERVER_SHORTLINKS_INTERSTITIAL")
+	_ = viper.BindEnv("server.shortlinks.new_key_age", "0X_SERVER_SHORTLINKS_NEW_KEY_AGE")
+	_ = viper.BindEnv("server.shortlinks.link_check.enabled", "0X_SERVER_SHORTLINKS_LINK_CHECK_ENABLED")
+	_ = viper.BindEnv("server.shortlinks.link_check.interval", "0X_SERVER_SHORTLINKS_LINK_CHECK_INTERVAL")
+	_ = viper.BindEnv("server.shortlinks.link_check.concurrency", "0X_SERVER_SHORTLINKS_LINK_CHECK_CONCURRENCY")
+	_ = viper.BindEnv("server.shortlinks.link_check.threshold", "0X_SERVER_SHORTLINKS_LINK_CHECK_THRESHOLD")
+	_ = viper.BindEnv("server.shortlinks.link_check.notify", "0X_SERVER_SHORTLINKS_LINK_CHECK_NOTIFY")
+	_ = viper.BindEnv("server.shortlinks.reputation.enabled", "0X_SERVER_SHORTLINKS_REPUTATION_ENABLED")
+	_ = viper.BindEnv("server.shortlinks.reputation.domain_lists", "0X_SERVER_SHORTLINKS_REPUTATION_DOMAIN_LISTS")
+	_ = viper.BindEnv("server.shortlinks.reputation.pattern_lists", "0X_SERVER_SHORTLINKS_REPUTATION_PATTERN_LISTS")
+	_ = viper.BindEnv("server.shortlinks.reputation.hash_prefix_lists", "0X_SERVER_SHORTLINKS_REPUTATION_HASH_PREFIX_LISTS")
+	_ = viper.BindEnv("server.shortlinks.reputation.reload_interval", "0X_SERVER_SHORTLINKS_REPUTATION_RELOAD_INTERVAL")
+	_ = viper.BindEnv("server.shortlinks.reputation.check_redirects", "0X_SERVER_SHORTLINKS_REPUTATION_CHECK_REDIRECTS")
+	_ = viper.BindEnv("server.shortlinks.reputation.trusted_keys", "0X_SERVER_SHORTLINKS_REPUTATION_TRUSTED_KEYS")
+	_ = viper.BindEnv("server.shortlinks.anonymous.enabled", "0X_SERVER_SHORTLINKS_ANONYMOUS_ENABLED")
+	_ = viper.BindEnv("server.shortlinks.anonymous.expiry", "0X_SERVER_SHORTLINKS_ANONYMOUS_EXPIRY")
+	_ = viper.BindEnv("server.shortlinks.anonymous.max_expiry", "0X_SERVER_SHORTLINKS_ANONYMOUS_MAX_EXPIRY")
+	_ = viper.BindEnv("server.shortlinks.anonymous.limit", "0X_SERVER_SHORTLINKS_ANONYMOUS_LIMIT")
+	_ = viper.BindEnv("server.shortlinks.anonymous.window", "0X_SERVER_SHORTLINKS_ANONYMOUS_WINDOW")
+	_ = viper.BindEnv("server.shortlinks.passwords.limit", "0X_SERVER_SHORTLINKS_PASSWORDS_LIMIT")
+	_ = viper.BindEnv("server.shortlinks.passwords.window", "0X_SERVER_SHORTLINKS_PASSWORDS_WINDOW")
+	_ = viper.BindEnv("server.shortlinks.geoip.database", "0X_SERVER_SHORTLINKS_GEOIP_DATABASE")
+	_ = viper.BindEnv("server.shortlinks.geoip.remote", "0X_SERVER_SHORTLINKS_GEOIP_REMOTE")
+	_ = viper.BindEnv("server.shortlinks.geoip.cache_ttl", "0X_SERVER_SHORTLINKS_GEOIP_CACHE_TTL")
+
 	// Rate limit bindings
 	_ = viper.BindEnv("server.rate_limit.global.enabled", "0X_SERVER_RATE_LIMIT_GLOBAL_ENABLED")
 	_ = viper.BindEnv("server.rate_limit.global.rate", "0X_SERVER_RATE_LIMIT_GLOBAL_RATE")
@@ -160,6 +327,10 @@ func Load() (*Config, error) {
 	_ = viper.BindEnv("smtp.from", "0X_SMTP_FROM")
 	_ = viper.BindEnv("smtp.from_name", "0X_SMTP_FROM_NAME")
 	_ = viper.BindEnv("smtp.starttls", "0X_SMTP_STARTTLS")
+	_ = viper.BindEnv("smtp.inbound.enabled", "0X_SMTP_INBOUND_ENABLED")
+	_ = viper.BindEnv("smtp.inbound.address", "0X_SMTP_INBOUND_ADDRESS")
+	_ = viper.BindEnv("smtp.inbound.domain", "0X_SMTP_INBOUND_DOMAIN")
+	_ = viper.BindEnv("smtp.inbound.max_message_size", "0X_SMTP_INBOUND_MAX_MESSAGE_SIZE")
 
 	// Redis bindings
 	_ = viper.BindEnv("redis.enabled", "0X_REDIS_ENABLED")
@@ -174,6 +345,20 @@ func Load() (*Config, error) {
 	_ = viper.BindEnv("retention.with_key.max_age", "0X_RETENTION_WITH_KEY_MAX_AGE")
 	_ = viper.BindEnv("retention.points", "0X_RETENTION_POINTS")
 
+	// ID generation bindings
+	_ = viper.BindEnv("ids.paste.length", "0X_IDS_PASTE_LENGTH")
+	_ = viper.BindEnv("ids.paste.style", "0X_IDS_PASTE_STYLE")
+	_ = viper.BindEnv("ids.paste.alphabet", "0X_IDS_PASTE_ALPHABET")
+	_ = viper.BindEnv("ids.paste.exclude_ambiguous", "0X_IDS_PASTE_EXCLUDE_AMBIGUOUS")
+	_ = viper.BindEnv("ids.shortlink.length", "0X_IDS_SHORTLINK_LENGTH")
+	_ = viper.BindEnv("ids.shortlink.style", "0X_IDS_SHORTLINK_STYLE")
+	_ = viper.BindEnv("ids.shortlink.alphabet", "0X_IDS_SHORTLINK_ALPHABET")
+	_ = viper.BindEnv("ids.shortlink.exclude_ambiguous", "0X_IDS_SHORTLINK_EXCLUDE_AMBIGUOUS")
+	_ = viper.BindEnv("ids.collection.length", "0X_IDS_COLLECTION_LENGTH")
+	_ = viper.BindEnv("ids.collection.style", "0X_IDS_COLLECTION_STYLE")
+	_ = viper.BindEnv("ids.collection.alphabet", "0X_IDS_COLLECTION_ALPHABET")
+	_ = viper.BindEnv("ids.collection.exclude_ambiguous", "0X_IDS_COLLECTION_EXCLUDE_AMBIGUOUS")
+
 	// Now set defaults
 	viper.SetDefault("database.driver", "sqlite")
 	viper.SetDefault("database.host", "localhost")
@@ -188,6 +373,9 @@ func Load() (*Config, error) {
 	viper.SetDefault("smtp.starttls", true)
 	viper.SetDefault("smtp.tls_verify", true)
 	viper.SetDefault("smtp.from_name", "Paste69")
+	viper.SetDefault("smtp.inbound.enabled", false)
+	viper.SetDefault("smtp.inbound.address", ":2525")
+	viper.SetDefault("smtp.inbound.max_message_size", 26214400) // 25MB
 
 	viper.SetDefault("storage", []map[string]any{
 		{
@@ -208,6 +396,45 @@ func Load() (*Config, error) {
 	viper.SetDefault("server.cleanup.enabled", true)
 	viper.SetDefault("server.cleanup.interval", 3600)
 	viper.SetDefault("server.cleanup.max_age", "168h")
+	viper.SetDefault("server.archive.max_entries", 10000)        // List at most 10000 entries
+	viper.SetDefault("server.archive.max_entry_size", 10485760)  // 10MB per extracted entry
+	viper.SetDefault("server.archive.max_total_size", 104857600) // 100MB decompressed per request
+	viper.SetDefault("server.archive.max_ratio", 100)            // Reject entries compressed more than 100:1
+	viper.SetDefault("server.tus.expiry", "24h")                 // Purge unfinished resumable uploads after a day
+	viper.SetDefault("server.tcp.enabled", false)
+	viper.SetDefault("server.tcp.address", ":9999")
+	viper.SetDefault("server.tcp.idle_timeout", "5s")
+	viper.SetDefault("server.tcp.timeout", "1m")
+	viper.SetDefault("server.tcp.max_connections", 100)
+	viper.SetDefault("server.ssh.enabled", false)
+	viper.SetDefault("server.ssh.address", ":2222")
+	viper.SetDefault("server.ssh.host_key", "./ssh_host_ed25519_key")
+	viper.SetDefault("server.ssh.anonymous", false)
+	viper.SetDefault("server.ssh.idle_timeout", "1m")
+	viper.SetDefault("server.ssh.timeout", "10m")
+	viper.SetDefault("server.ssh.max_connections", 100)
+	viper.SetDefault("server.fetch.timeout", "10s")
+	viper.SetDefault("server.fetch.max_redirects", 5)
+	viper.SetDefault("server.fetch.allow_private", false) // Never let remote imports reach internal services
+	viper.SetDefault("server.shortlinks.interstitial", "off")
+	viper.SetDefault("server.shortlinks.new_key_age", "168h") // Keys count as new for a week
+	viper.SetDefault("server.shortlinks.link_check.enabled", false)
+	viper.SetDefault("server.shortlinks.link_check.interval", "24h")
+	viper.SetDefault("server.shortlinks.link_check.concurrency", 4)
+	viper.SetDefault("server.shortlinks.link_check.threshold", 3)
+	viper.SetDefault("server.shortlinks.link_check.notify", true)
+	viper.SetDefault("server.shortlinks.reputation.enabled", false)
+	viper.SetDefault("server.shortlinks.reputation.reload_interval", "30s")
+	viper.SetDefault("server.shortlinks.reputation.check_redirects", false)
+	viper.SetDefault("server.shortlinks.anonymous.enabled", false)
+	viper.SetDefault("server.shortlinks.anonymous.expiry", "24h")
+	viper.SetDefault("server.shortlinks.anonymous.max_expiry", "168h")
+	viper.SetDefault("server.shortlinks.anonymous.limit", 10)
+	viper.SetDefault("server.shortlinks.anonymous.window", "1h")
+	viper.SetDefault("server.shortlinks.passwords.limit", 10)
+	viper.SetDefault("server.shortlinks.passwords.window", "15m")
+	viper.SetDefault("server.shortlinks.geoip.remote", false)
+	viper.SetDefault("server.shortlinks.geoip.cache_ttl", "24h")
 	viper.SetDefault("server.cors_origins", []string{"*"})
 	viper.SetDefault("server.views_directory", "./views")
 	viper.SetDefault("server.public_directory", "./public")
@@ -232,6 +459,13 @@ func Load() (*Config, error) {
 	viper.SetDefault("retention.with_key.max_age", 730.0) // 2 years with key
 	viper.SetDefault("retention.points", 50)              // Number of points to generate
 
+	viper.SetDefault("ids.paste.length", 8)
+	viper.SetDefault("ids.paste.style", "random")
+	viper.SetDefault("ids.shortlink.length", 6)
+	viper.SetDefault("ids.shortlink.style", "random")
+	viper.SetDefault("ids.collection.length", 8)
+	viper.SetDefault("ids.collection.style", "random")
+
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
 			return nil, fmt.Errorf("error reading config file: %w", err)
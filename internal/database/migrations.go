@@ -12,7 +12,11 @@ var Models = []interface{}{
 	&models.Paste{},
 	&models.APIKey{},
 	&models.Shortlink{},
+	&models.ShortlinkChange{},
 	&models.AnalyticsEvent{},
+	&models.Collection{},
+	&models.Upload{},
+	&models.SSHKey{},
 }
 
 // RunMigrations runs all necessary database migrations
@@ -25,6 +29,10 @@ func RunMigrations(db *gorm.DB) error {
 		return fmt.Errorf("failed to create constraints: %w", err)
 	}
 
+	if err := createSearchIndex(db); err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"slices"
+
+	"github.com/watzon/0x45/internal/models"
+	"gorm.io/gorm"
+)
+
+// createSearchIndex creates the full-text index over paste filenames, details and content.
+// Postgres keeps a weighted tsvector per paste behind a GIN index, SQLite uses an FTS5 table.
+func createSearchIndex(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "postgres":
+		for _, stmt := range []string{
+			`CREATE TABLE IF NOT EXISTS ` + models.PasteSearchTable + ` (
+				paste_id varchar(32) PRIMARY KEY,
+				api_key varchar(64) NOT NULL,
+				document tsvector NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_paste_search_document ON ` + models.PasteSearchTable + ` USING GIN (document)`,
+			`CREATE INDEX IF NOT EXISTS idx_paste_search_api_key ON ` + models.PasteSearchTable + ` (api_key)`,
+		} {
+			if err := db.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if err := addSearchDetails(db); err != nil {
+			return err
+		}
+		return db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS ` + models.PasteSearchTable + ` USING fts5(
+			paste_id UNINDEXED,
+			api_key UNINDEXED,
+			filename,
+			content,
+			details
+		)`).Error
+	}
+}
+
+// addSearchDetails rebuilds an FTS5 index created before titles, descriptions and tags
+// were searchable, as FTS5 tables can't gain columns. Existing entries are kept with
+// empty details until their paste is edited.
+func addSearchDetails(db *gorm.DB) error {
+	var columns []string
+	if err := db.Raw(`SELECT name FROM pragma_table_info(?)`, models.PasteSearchTable).Scan(&columns).Error; err != nil {
+		return err
+	}
+	if len(columns) == 0 || slices.Contains(columns, "details") {
+		return nil
+	}
+
+	old := models.PasteSearchTable + "_old"
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			`ALTER TABLE ` + models.PasteSearchTable + ` RENAME TO ` + old,
+			`CREATE VIRTUAL TABLE ` + models.PasteSearchTable + ` USING fts5(
+				paste_id UNINDEXED,
+				api_key UNINDEXED,
+				filename,
+				content,
+				details
+			)`,
+			`INSERT INTO ` + models.PasteSearchTable + ` (paste_id, api_key, filename, content, details)
+				SELECT paste_id, api_key, filename, content, '' FROM ` + old,
+			`DROP TABLE ` + old,
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,134 @@
+// Package geoip resolves the countries of visitors' IP addresses for shortlink
+// routing rules. Lookups use a local MaxMind database (GeoLite2 or GeoIP2, country
+// or city edition), so redirects don't wait on a remote service. Instances without
+// one can opt in to cached ip-api.com lookups instead.
+package geoip
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultCacheTTL is used when the cache TTL of remote lookups is left empty
+	defaultCacheTTL = 24 * time.Hour
+
+	// maxCacheEntries bounds the memory used by cached remote lookups
+	maxCacheEntries = 10000
+)
+
+// remoteClient looks up countries while a redirect waits, so it gives up quickly
+var remoteClient = &http.Client{Timeout: 2 * time.Second}
+
+// Locator resolves IP addresses to two letter country codes. It's safe for
+// concurrent use.
+type Locator struct {
+	db *maxminddb.Reader
+
+	// remote looks up an address when there's no database, if remote lookups are enabled
+	remote func(ip string) string
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedCountry
+}
+
+type cachedCountry struct {
+	country string
+	expires time.Time
+}
+
+// record holds the fields read from database entries
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// New creates a locator for the configured database. Without a database, and unless
+// remote lookups are enabled, every address resolves to no country, so country
+// rules never match.
+func New(cfg config.GeoIPConfig, logger *zap.Logger) (*Locator, error) {
+	l := &Locator{
+		ttl:   cfg.CacheTTL,
+		cache: make(map[string]cachedCountry),
+	}
+	if l.ttl <= 0 {
+		l.ttl = defaultCacheTTL
+	}
+
+	if cfg.Database != "" {
+		db, err := maxminddb.Open(cfg.Database)
+		if err != nil {
+			return l, err
+		}
+		l.db = db
+		logger.Info("loaded GeoIP database", zap.String("path", cfg.Database), zap.String("type", db.Metadata.DatabaseType))
+		return l, nil
+	}
+
+	if cfg.Remote {
+		l.remote = func(ip string) string {
+			return utils.GetLocationInfoWithClient(ip, remoteClient).Country
+		}
+	}
+	return l, nil
+}
+
+// Country returns the country code of an IP address, or "" when it's unknown
+func (l *Locator) Country(ip string) string {
+	if l.db != nil {
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return ""
+		}
+		var r record
+		if err := l.db.Lookup(addr, &r); err != nil {
+			return ""
+		}
+		return r.Country.ISOCode
+	}
+
+	if l.remote == nil {
+		return ""
+	}
+	return l.cached(ip)
+}
+
+// cached returns the country of a remote lookup, only asking the remote service
+// about addresses it hasn't seen within the TTL
+func (l *Locator) cached(ip string) string {
+	now := time.Now()
+
+	l.mu.Lock()
+	entry, ok := l.cache[ip]
+	l.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.country
+	}
+
+	country := l.remote(ip)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.cache) >= maxCacheEntries {
+		for key, entry := range l.cache {
+			if !now.Before(entry.expires) {
+				delete(l.cache, key)
+			}
+		}
+		// Still full of fresh entries, so start over rather than grow without bound
+		if len(l.cache) >= maxCacheEntries {
+			clear(l.cache)
+		}
+	}
+	l.cache[ip] = cachedCountry{country: country, expires: now.Add(l.ttl)}
+	return country
+}
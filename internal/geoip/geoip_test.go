@@ -0,0 +1,66 @@
+package geoip
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/watzon/0x45/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestLocator(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		l, err := New(config.GeoIPConfig{}, zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if country := l.Country("192.0.2.1"); country != "" {
+			t.Errorf("Country = %q, want no country without a database or remote lookups", country)
+		}
+	})
+
+	t.Run("missing database", func(t *testing.T) {
+		l, err := New(config.GeoIPConfig{Database: filepath.Join(t.TempDir(), "missing.mmdb"), Remote: true}, zap.NewNop())
+		if err == nil {
+			t.Fatal("expected an error for a missing database")
+		}
+		// The locator still works, it just doesn't know any countries
+		if country := l.Country("192.0.2.1"); country != "" {
+			t.Errorf("Country = %q, want no country", country)
+		}
+	})
+
+	t.Run("remote lookups are cached", func(t *testing.T) {
+		l, err := New(config.GeoIPConfig{Remote: true, CacheTTL: 50 * time.Millisecond}, zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lookups := 0
+		l.remote = func(ip string) string {
+			lookups++
+			return "DE"
+		}
+
+		for range 3 {
+			if country := l.Country("192.0.2.1"); country != "DE" {
+				t.Errorf("Country = %q, want DE", country)
+			}
+		}
+		if lookups != 1 {
+			t.Errorf("remote lookups = %d, want 1", lookups)
+		}
+
+		l.Country("192.0.2.2")
+		if lookups != 2 {
+			t.Errorf("remote lookups = %d, want 2 after a new address", lookups)
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		l.Country("192.0.2.1")
+		if lookups != 3 {
+			t.Errorf("remote lookups = %d, want 3 once the cache expired", lookups)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package mailer
 import (
 	"crypto/tls"
 	"fmt"
+	"mime"
 	"net/smtp"
 
 	"github.com/mailgun/raymond/v2"
@@ -33,21 +34,94 @@ func New(cfg *config.Config) (*Mailer, error) {
 }
 
 func (m *Mailer) SendVerification(to, token string) error {
-	// Read the template file
-	tpl, err := raymond.ParseFile("views/emails/verify_api_key.hbs")
+	body, err := render("views/emails/verify_api_key.hbs", map[string]any{
+		"baseUrl": m.config.Server.BaseURL,
+		"token":   token,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to parse email template: %w", err)
+		return err
 	}
 
-	// Render the template with data
-	body, err := tpl.Exec(map[string]any{
+	return m.send(to, "Verify your Paste69 API Key", body)
+}
+
+// PasteLink describes a paste listed in a notification email
+type PasteLink struct {
+	Filename string
+	URL      string
+}
+
+// SendPasteLinks tells the sender of an inbound email which pastes were created from it
+func (m *Mailer) SendPasteLinks(to, subject string, pastes []PasteLink) error {
+	links := make([]map[string]any, len(pastes))
+	for i, paste := range pastes {
+		links[i] = map[string]any{
+			"filename": paste.Filename,
+			"url":      paste.URL,
+		}
+	}
+
+	body, err := render("views/emails/paste_links.hbs", map[string]any{
 		"baseUrl": m.config.Server.BaseURL,
-		"token":   token,
+		"subject": subject,
+		"pastes":  links,
+	})
+	if err != nil {
+		return err
+	}
+
+	replySubject := "Your pastes"
+	if subject != "" {
+		replySubject = "Re: " + subject
+	}
+	return m.send(to, replySubject, body)
+}
+
+// BrokenLink describes a shortlink whose target stopped working
+type BrokenLink struct {
+	Title     string
+	ShortURL  string
+	TargetURL string
+	Status    int    // HTTP status of the last check, 0 if there was no response
+	Error     string // Why there was no response
+}
+
+// SendBrokenLink tells the owner of a shortlink that its target stopped working
+func (m *Mailer) SendBrokenLink(to string, link BrokenLink) error {
+	body, err := render("views/emails/broken_link.hbs", map[string]any{
+		"baseUrl":   m.config.Server.BaseURL,
+		"title":     link.Title,
+		"shortUrl":  link.ShortURL,
+		"targetUrl": link.TargetURL,
+		"status":    link.Status,
+		"error":     link.Error,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+		return err
 	}
 
+	return m.send(to, "Your short link is broken", body)
+}
+
+// render executes an email template with the given data
+func render(path string, data map[string]any) (string, error) {
+	// Read the template file
+	tpl, err := raymond.ParseFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse email template: %w", err)
+	}
+
+	// Render the template with data
+	body, err := tpl.Exec(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return body, nil
+}
+
+// send delivers an HTML email through the configured SMTP server
+func (m *Mailer) send(to, subject, body string) error {
 	addr := fmt.Sprintf("%s:%d", m.config.SMTP.Host, m.config.SMTP.Port)
 
 	// Configure TLS
@@ -94,11 +168,11 @@ func (m *Mailer) SendVerification(to, token string) error {
 
 	msg := fmt.Sprintf("To: %s\r\n"+
 		"From: %s <%s>\r\n"+
-		"Subject: Verify your Paste69 API Key\r\n"+
+		"Subject: %s\r\n"+
 		"MIME-version: 1.0;\r\n"+
 		"Content-Type: text/html; charset=\"UTF-8\";\r\n"+
 		"\r\n"+
-		"%s", to, m.config.SMTP.FromName, m.config.SMTP.From, body)
+		"%s", to, m.config.SMTP.FromName, m.config.SMTP.From, mime.QEncoding.Encode("utf-8", subject), body)
 
 	if _, err = w.Write([]byte(msg)); err != nil {
 		return fmt.Errorf("failed to write email body: %w", err)
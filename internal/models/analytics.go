@@ -27,7 +27,7 @@ type AnalyticsEvent struct {
 	EventType EventType `gorm:"type:varchar(32);index;not null"`
 
 	// Resource information (what the event is about)
-	ResourceID   string `gorm:"type:varchar(16);index;not null"` // ID of the shortlink or paste
+	ResourceID   string `gorm:"type:varchar(32);index;not null"` // ID of the shortlink or paste
 	ResourceType string `gorm:"type:varchar(32);index;not null"` // "shortlink" or "paste"
 
 	// Request information
@@ -49,7 +49,7 @@ type AnalyticsEvent struct {
 }
 
 // CreateEvent is a helper function to create a new analytics event
-func CreateEvent(db *gorm.DB, eventType EventType, resourceType string, resourceID string, userAgent string, ipAddress string, refererURL string) error {
+func CreateEvent(db *gorm.DB, eventType EventType, resourceType string, resourceID string, userAgent string, ipAddress string, refererURL string, metadata JSON) error {
 	ua := useragent.Parse(userAgent)
 	locationInfo := utils.GetLocationInfo(ipAddress)
 
@@ -67,6 +67,7 @@ func CreateEvent(db *gorm.DB, eventType EventType, resourceType string, resource
 		Region:       locationInfo.Region,
 		ZipCode:      locationInfo.ZipCode,
 		Country:      locationInfo.Country,
+		Metadata:     metadata,
 	}
 
 	return db.Create(event).Error
@@ -38,6 +38,9 @@ type APIKey struct {
 	VerifyExpiry time.Time
 
 	IsReset bool `json:"is_reset" gorm:"default:false"`
+
+	// Local part of the address that turns inbound mail into pastes for this key
+	InboundToken string `gorm:"type:varchar(32);index"`
 }
 
 // GenerateKey generates a new API key string
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/watzon/0x45/internal/utils"
+	"gorm.io/gorm"
+)
+
+// CollectionIDLength is the length of generated collection IDs unless configured otherwise
+const CollectionIDLength = 8
+
+// Collection groups several pastes under a single ID with a shared expiry and delete key
+type Collection struct {
+	ID        string `gorm:"primarykey;type:varchar(32)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	// Access control
+	Private   bool
+	DeleteKey string `gorm:"type:varchar(32)"`
+	APIKey    string `gorm:"type:varchar(64);index"` // If created with an API key
+
+	// Expiration, shared by every file in the collection
+	ExpiresAt *time.Time `gorm:"index"`
+}
+
+// BeforeCreate generates ID and DeleteKey if not set
+func (c *Collection) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = utils.MustGenerateID(CollectionIDLength)
+	}
+
+	if c.DeleteKey == "" {
+		c.DeleteKey = utils.MustGenerateID(32)
+	}
+
+	return nil
+}
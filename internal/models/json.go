@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"fmt"
 )
 
 // JSON custom type to handle both PostgreSQL JSONB and SQLite TEXT
@@ -51,3 +52,30 @@ func (j *JSON) UnmarshalJSON(data []byte) error {
 	*j = append((*j)[0:0], data...)
 	return nil
 }
+
+// listValue stores a list as a JSON array, or NULL when it's empty
+func listValue[T any](list []T) (driver.Value, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// scanList reads a list stored by listValue
+func scanList[T any](value any, list *[]T) error {
+	switch v := value.(type) {
+	case nil:
+		*list = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, list)
+	case string:
+		return json.Unmarshal([]byte(v), list)
+	default:
+		return fmt.Errorf("invalid type %T for a JSON list", value)
+	}
+}
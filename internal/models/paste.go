@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -10,8 +11,14 @@ import (
 	"gorm.io/gorm"
 )
 
+// PasteIDLength is the length of generated paste IDs unless configured otherwise
+const PasteIDLength = 8
+
+// PasteSearchTable is the full-text index over pastes, created by the migrations
+const PasteSearchTable = "paste_search"
+
 type Paste struct {
-	ID        string `gorm:"primarykey;type:varchar(16)"`
+	ID        string `gorm:"primarykey;type:varchar(32)"` // Generated ID, or a custom slug
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -27,11 +34,19 @@ type Paste struct {
 	StorageType string `gorm:"type:varchar(32)"` // "local" or "s3"
 	StorageName string `gorm:"type:varchar(64)"` // Name of the storage config
 
+	// Details supplied by the uploader
+	Title       string `gorm:"type:varchar(255)"`
+	Description string `gorm:"type:text"`
+	Tags        Tags   `gorm:"type:text"`
+
 	// Access control
 	Private   bool
 	DeleteKey string `gorm:"type:varchar(32)"`
 	APIKey    string `gorm:"type:varchar(64);index"` // If created with an API key
 
+	// Collection this paste belongs to, if it was uploaded as part of one
+	CollectionID string `gorm:"type:varchar(32);index"`
+
 	// Expiration
 	ExpiresAt *time.Time `gorm:"index"`
 
@@ -39,10 +54,35 @@ type Paste struct {
 	Metadata JSON `gorm:"type:jsonb"` // For PostgreSQL, will fallback to JSON string for SQLite
 }
 
+// PasteMetadata holds the optional structured data stored in Paste.Metadata
+type PasteMetadata struct {
+	ForkedFrom string `json:"forked_from,omitempty"` // ID of the paste this one was forked from
+}
+
+// GetMetadata decodes the paste's metadata, returning an empty value if there is none
+func (p *Paste) GetMetadata() PasteMetadata {
+	var meta PasteMetadata
+	if len(p.Metadata) == 0 {
+		return meta
+	}
+	_ = json.Unmarshal(p.Metadata, &meta)
+	return meta
+}
+
+// SetMetadata encodes the given metadata into the paste
+func (p *Paste) SetMetadata(meta PasteMetadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	p.Metadata = JSON(data)
+	return nil
+}
+
 // BeforeCreate generates ID and DeleteKey if not set
 func (p *Paste) BeforeCreate(tx *gorm.DB) error {
 	if p.ID == "" {
-		p.ID = utils.MustGenerateID(8)
+		p.ID = utils.MustGenerateID(PasteIDLength)
 	}
 
 	if p.DeleteKey == "" {
@@ -87,3 +127,12 @@ func (p *Paste) BeforeCreate(tx *gorm.DB) error {
 
 	return nil
 }
+
+// AfterDelete removes the paste from the search index, so deleted pastes never
+// show up in search results
+func (p *Paste) AfterDelete(tx *gorm.DB) error {
+	if p.ID == "" {
+		return nil
+	}
+	return tx.Exec("DELETE FROM "+PasteSearchTable+" WHERE paste_id = ?", p.ID).Error
+}
@@ -7,11 +7,19 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/watzon/0x45/internal/utils"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// ShortlinkIDLength is the length of generated shortlink IDs unless configured otherwise
+const ShortlinkIDLength = 6
+
+// DefaultRedirectStatus is used by shortlinks that don't pick a redirect status. It's
+// temporary, so browsers don't cache redirects that can still be edited.
+const DefaultRedirectStatus = 307
+
 type Shortlink struct {
-	ID        string `gorm:"primarykey;type:varchar(8)"` // Shorter IDs for URLs
+	ID        string `gorm:"primarykey;type:varchar(32)"` // Generated ID, or a custom slug
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -19,6 +27,35 @@ type Shortlink struct {
 	// URL information
 	TargetURL string `gorm:"type:text;not null"`
 	Title     string `gorm:"type:varchar(255)"` // Optional, can be fetched from target
+	Tags      Tags   `gorm:"type:text"`
+
+	// Routing rules, evaluated in order before falling back to TargetURL
+	Rules ShortlinkRules `gorm:"type:jsonb"`
+
+	// Split test destinations. When set, visitors no rule matches are spread over
+	// these instead of going to TargetURL.
+	Variants ShortlinkVariants `gorm:"type:jsonb"`
+
+	// Show a warning page with the destination instead of redirecting straight away
+	Interstitial bool `gorm:"not null;default:false"`
+
+	// Redirect behaviour
+	RedirectStatus int       // 301, 302, 307 or 308; 0 means DefaultRedirectStatus
+	Passthrough    bool      `gorm:"not null;default:false"` // Forward the visitor's path suffix and query string
+	UTM            UTMParams `gorm:"type:jsonb"`
+
+	// Visitor restrictions
+	PasswordHash string     `gorm:"type:varchar(72)"`   // bcrypt hash of the password visitors need, if any
+	MaxClicks    int        `gorm:"not null;default:0"` // 0 means unlimited
+	Clicks       int        `gorm:"not null;default:0"` // Redirects so far, counted against MaxClicks
+	NotBefore    *time.Time // Start of the activation window
+	NotAfter     *time.Time // End of the activation window
+
+	// Broken link monitoring of TargetURL
+	Checks        LinkChecks `gorm:"type:jsonb"`
+	CheckFailures int        `gorm:"not null;default:0"` // Failed checks in a row
+	Broken        bool       `gorm:"not null;default:false"`
+	NextCheckAt   *time.Time `gorm:"index"` // Checked as soon as possible when unset
 
 	// Access control
 	APIKey    string     `gorm:"type:varchar(64);not null;index"` // Required for creation
@@ -31,7 +68,7 @@ type Shortlink struct {
 
 func (s *Shortlink) BeforeCreate(tx *gorm.DB) error {
 	if s.ID == "" {
-		s.ID = utils.MustGenerateID(6) // Shorter IDs for URLs
+		s.ID = utils.MustGenerateID(ShortlinkIDLength) // Shorter IDs for URLs
 	}
 	if s.DeleteKey == "" {
 		s.DeleteKey = utils.MustGenerateID(32)
@@ -39,13 +76,73 @@ func (s *Shortlink) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Status returns the HTTP status visitors are redirected with
+func (s *Shortlink) Status() int {
+	if s.RedirectStatus == 0 {
+		return DefaultRedirectStatus
+	}
+	return s.RedirectStatus
+}
+
+// SetPassword protects the shortlink with a password, or removes the protection when
+// the password is empty
+func (s *Shortlink) SetPassword(password string) error {
+	if password == "" {
+		s.PasswordHash = ""
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	s.PasswordHash = string(hash)
+	return nil
+}
+
+// HasPassword reports whether visitors need a password to follow the shortlink
+func (s *Shortlink) HasPassword() bool {
+	return s.PasswordHash != ""
+}
+
+// CheckPassword reports whether the password unlocks the shortlink
+func (s *Shortlink) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(s.PasswordHash), []byte(password)) == nil
+}
+
+// Exhausted reports whether the shortlink has used up its clicks
+func (s *Shortlink) Exhausted() bool {
+	return s.MaxClicks > 0 && s.Clicks >= s.MaxClicks
+}
+
+// ResetChecks forgets the link check history, so a new target is checked right away
+func (s *Shortlink) ResetChecks() {
+	s.Checks = nil
+	s.CheckFailures = 0
+	s.Broken = false
+	s.NextCheckAt = nil
+}
+
 func (s *Shortlink) ToResponse(baseURL string) fiber.Map {
 	response := fiber.Map{
-		"id":         s.ID,
-		"url":        s.TargetURL,
-		"title":      s.Title,
-		"created_at": s.CreatedAt,
-		"expires_at": s.ExpiresAt,
+		"id":                 s.ID,
+		"url":                s.TargetURL,
+		"title":              s.Title,
+		"tags":               s.Tags,
+		"rules":              s.Rules,
+		"variants":           s.Variants,
+		"interstitial":       s.Interstitial,
+		"redirect_status":    s.Status(),
+		"passthrough":        s.Passthrough,
+		"utm":                s.UTM,
+		"password_protected": s.HasPassword(),
+		"max_clicks":         s.MaxClicks,
+		"clicks":             s.Clicks,
+		"not_before":         s.NotBefore,
+		"not_after":          s.NotAfter,
+		"broken":             s.Broken,
+		"checks":             s.Checks,
+		"created_at":         s.CreatedAt,
+		"expires_at":         s.ExpiresAt,
 	}
 
 	// Ensure baseURL doesn't end with a slash
@@ -54,6 +151,7 @@ func (s *Shortlink) ToResponse(baseURL string) fiber.Map {
 	// Add URL paths
 	response["short_url"] = fmt.Sprintf("%s/u/%s", baseURL, s.ID)
 	response["stats_url"] = fmt.Sprintf("%s/u/%s/stats", baseURL, s.ID)
+	response["preview_url"] = fmt.Sprintf("%s/u/%s+", baseURL, s.ID)
 
 	// Only include delete_url if there's a delete key
 	if s.DeleteKey != "" {
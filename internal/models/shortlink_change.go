@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Kinds of shortlink changes
+const (
+	ShortlinkChangeEdit     = "edit"
+	ShortlinkChangeRollback = "rollback"
+)
+
+// ShortlinkChange records an edit of a shortlink's target URL or title, so owners
+// can see where a link used to point and roll it back
+type ShortlinkChange struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	ShortlinkID string `gorm:"type:varchar(32);not null;index"`
+	Kind        string `gorm:"type:varchar(16);not null"` // ShortlinkChangeEdit or ShortlinkChangeRollback
+
+	PreviousURL   string `gorm:"type:text;not null"`
+	TargetURL     string `gorm:"type:text;not null"`
+	PreviousTitle string `gorm:"type:varchar(255)"`
+	Title         string `gorm:"type:varchar(255)"`
+}
+
+// ToResponse converts a ShortlinkChange to a response map
+func (c *ShortlinkChange) ToResponse() fiber.Map {
+	return fiber.Map{
+		"id":             c.ID,
+		"kind":           c.Kind,
+		"previous_url":   c.PreviousURL,
+		"url":            c.TargetURL,
+		"previous_title": c.PreviousTitle,
+		"title":          c.Title,
+		"changed_at":     c.CreatedAt,
+	}
+}
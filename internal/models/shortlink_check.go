@@ -0,0 +1,62 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// MaxLinkChecks is how many checks of its target a shortlink remembers
+const MaxLinkChecks = 10
+
+// LinkCheck is the outcome of requesting the target of a shortlink
+type LinkCheck struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Status    int       `json:"status,omitempty"`  // HTTP status of the final response, 0 if there was none
+	Error     string    `json:"error,omitempty"`   // Why no response was received
+	Skipped   string    `json:"skipped,omitempty"` // Why the target wasn't requested at all
+}
+
+// OK reports whether the target answered with a status other than an error
+func (c LinkCheck) OK() bool {
+	return c.Error == "" && c.Status > 0 && c.Status < 400
+}
+
+// LinkChecks is the status history of a shortlink's target, oldest first, stored as a
+// JSON column
+type LinkChecks []LinkCheck
+
+// Add appends a check, dropping the oldest ones beyond MaxLinkChecks
+func (c LinkChecks) Add(check LinkCheck) LinkChecks {
+	c = append(c, check)
+	if len(c) > MaxLinkChecks {
+		c = c[len(c)-MaxLinkChecks:]
+	}
+	return c
+}
+
+// Last returns the most recent check, if there is one
+func (c LinkChecks) Last() *LinkCheck {
+	if len(c) == 0 {
+		return nil
+	}
+	return &c[len(c)-1]
+}
+
+// Value implements the driver.Valuer interface
+func (c LinkChecks) Value() (driver.Value, error) {
+	return listValue(c)
+}
+
+// Scan implements the sql.Scanner interface
+func (c *LinkChecks) Scan(value any) error {
+	return scanList(value, (*[]LinkCheck)(c))
+}
+
+// MarshalJSON encodes a missing history as an empty array rather than null
+func (c LinkChecks) MarshalJSON() ([]byte, error) {
+	if c == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]LinkCheck(c))
+}
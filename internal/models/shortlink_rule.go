@@ -0,0 +1,284 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	// Rules name IANA timezones, which the scratch container image has no database for
+	_ "time/tzdata"
+
+	"github.com/mileusna/useragent"
+)
+
+// MaxShortlinkRules limits the number of routing rules on a single shortlink
+const MaxShortlinkRules = 20
+
+// Devices a routing rule can match on
+const (
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+)
+
+var ruleDevices = []string{DeviceIOS, DeviceAndroid, DeviceMobile, DeviceTablet, DeviceDesktop, DeviceBot}
+
+var ruleWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ShortlinkRule sends the visitors of a shortlink matching all of its conditions to a
+// different URL. Conditions that are left empty match everyone; a list condition
+// matches when any of its entries does.
+type ShortlinkRule struct {
+	URL string `json:"url"`
+
+	Devices   []string `json:"devices,omitempty"`   // See the Device constants
+	Countries []string `json:"countries,omitempty"` // ISO 3166-1 alpha-2 codes, e.g. "DE"
+	Languages []string `json:"languages,omitempty"` // Language tags, "en" also matches "en-GB"
+
+	// Time window. Days and hours are read in Timezone, which defaults to UTC.
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	Days     []string   `json:"days,omitempty"` // "mon" through "sun"
+	From     string     `json:"from,omitempty"` // "15:04", a From not before To wraps over midnight
+	To       string     `json:"to,omitempty"`
+	Timezone string     `json:"timezone,omitempty"`
+}
+
+// ShortlinkRules is the ordered list of routing rules of a shortlink. The first rule
+// matching a visitor decides where they're sent, stored as a JSON column.
+type ShortlinkRules []ShortlinkRule
+
+// RedirectVisitor describes the request a shortlink redirect is made for
+type RedirectVisitor struct {
+	UserAgent useragent.UserAgent
+	Country   string
+	Languages []string // Most preferred first, lowercase
+	Time      time.Time
+}
+
+// Normalize cleans up the rules and checks that their conditions are valid. Target
+// URLs are left for the caller to validate.
+func (r ShortlinkRules) Normalize() (ShortlinkRules, error) {
+	if len(r) > MaxShortlinkRules {
+		return nil, fmt.Errorf("at most %d rules are allowed", MaxShortlinkRules)
+	}
+
+	rules := make(ShortlinkRules, len(r))
+	for i, rule := range r {
+		if err := rule.normalize(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		rules[i] = rule
+	}
+	return rules, nil
+}
+
+func (r *ShortlinkRule) normalize() error {
+	r.URL = strings.TrimSpace(r.URL)
+	r.Devices = normalizeList(r.Devices, strings.ToLower)
+	r.Countries = normalizeList(r.Countries, strings.ToUpper)
+	r.Languages = normalizeList(r.Languages, strings.ToLower)
+	r.Days = normalizeList(r.Days, strings.ToLower)
+
+	for _, device := range r.Devices {
+		if !slices.Contains(ruleDevices, device) {
+			return fmt.Errorf("unknown device %q, must be one of %s", device, strings.Join(ruleDevices, ", "))
+		}
+	}
+	for _, country := range r.Countries {
+		if len(country) != 2 {
+			return fmt.Errorf("country %q must be a two letter code", country)
+		}
+	}
+	for _, day := range r.Days {
+		if !slices.Contains(ruleWeekdays, day) {
+			return fmt.Errorf("unknown day %q, must be one of %s", day, strings.Join(ruleWeekdays, ", "))
+		}
+	}
+
+	if (r.From == "") != (r.To == "") {
+		return errors.New("from and to must be set together")
+	}
+	for _, clock := range []string{r.From, r.To} {
+		if _, err := time.Parse("15:04", clock); clock != "" && err != nil {
+			return fmt.Errorf("invalid time %q, must be HH:MM", clock)
+		}
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", r.Timezone)
+	}
+	if r.StartsAt != nil && r.EndsAt != nil && !r.EndsAt.After(*r.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// Match returns the URL of the first rule matching the visitor
+func (r ShortlinkRules) Match(visitor *RedirectVisitor) (string, bool) {
+	for i := range r {
+		if r[i].matches(visitor) {
+			return r[i].URL, true
+		}
+	}
+	return "", false
+}
+
+// NeedsCountry reports whether any rule matches on the visitor's country, so the
+// GeoIP lookup can be skipped when none does
+func (r ShortlinkRules) NeedsCountry() bool {
+	return slices.ContainsFunc(r, func(rule ShortlinkRule) bool {
+		return len(rule.Countries) > 0
+	})
+}
+
+func (r *ShortlinkRule) matches(visitor *RedirectVisitor) bool {
+	if len(r.Devices) > 0 && !slices.ContainsFunc(r.Devices, func(device string) bool {
+		return matchesDevice(device, visitor.UserAgent)
+	}) {
+		return false
+	}
+	if len(r.Countries) > 0 && !slices.Contains(r.Countries, visitor.Country) {
+		return false
+	}
+	if len(r.Languages) > 0 && !slices.ContainsFunc(visitor.Languages, func(language string) bool {
+		return slices.ContainsFunc(r.Languages, func(tag string) bool {
+			return language == tag || strings.HasPrefix(language, tag+"-")
+		})
+	}) {
+		return false
+	}
+	return r.matchesTime(visitor.Time)
+}
+
+func (r *ShortlinkRule) matchesTime(t time.Time) bool {
+	if r.StartsAt != nil && t.Before(*r.StartsAt) {
+		return false
+	}
+	if r.EndsAt != nil && !t.Before(*r.EndsAt) {
+		return false
+	}
+
+	if location, err := time.LoadLocation(r.Timezone); err == nil {
+		t = t.In(location)
+	}
+	if len(r.Days) > 0 && !slices.Contains(r.Days, ruleWeekdays[t.Weekday()]) {
+		return false
+	}
+	if r.From != "" {
+		// Zero padded clock times compare correctly as strings
+		clock := t.Format("15:04")
+		if r.From < r.To {
+			return clock >= r.From && clock < r.To
+		}
+		return clock >= r.From || clock < r.To
+	}
+	return true
+}
+
+func matchesDevice(device string, ua useragent.UserAgent) bool {
+	switch device {
+	case DeviceIOS:
+		return ua.IsIOS()
+	case DeviceAndroid:
+		return ua.IsAndroid()
+	case DeviceMobile:
+		return ua.Mobile
+	case DeviceTablet:
+		return ua.Tablet
+	case DeviceDesktop:
+		return ua.Desktop
+	case DeviceBot:
+		return ua.Bot
+	}
+	return false
+}
+
+// normalizeList trims and converts the entries of a list, dropping empty ones
+func normalizeList(list []string, convert func(string) string) []string {
+	var result []string
+	for _, entry := range list {
+		if entry = convert(strings.TrimSpace(entry)); entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// ParseAcceptLanguage returns the languages of an Accept-Language header, most
+// preferred first. Languages the client refuses with q=0 are left out.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var languages []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if _, err := fmt.Sscanf(value, "%g", &q); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			languages = append(languages, weighted{tag, q})
+		}
+	}
+
+	slices.SortStableFunc(languages, func(a, b weighted) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+
+	tags := make([]string, len(languages))
+	for i, language := range languages {
+		tags[i] = language.tag
+	}
+	return tags
+}
+
+// Value implements the driver.Valuer interface
+func (r ShortlinkRules) Value() (driver.Value, error) {
+	return listValue(r)
+}
+
+// Scan implements the sql.Scanner interface
+func (r *ShortlinkRules) Scan(value any) error {
+	return scanList(value, (*[]ShortlinkRule)(r))
+}
+
+// MarshalJSON encodes missing rules as an empty array rather than null
+func (r ShortlinkRules) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]ShortlinkRule(r))
+}
+
+// UnmarshalJSON decodes the list of rules. It's needed alongside UnmarshalText, which
+// encoding/json would otherwise use and then reject anything but a JSON string.
+func (r *ShortlinkRules) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*[]ShortlinkRule)(r))
+}
+
+// UnmarshalText reads rules sent as a JSON encoded form field
+func (r *ShortlinkRules) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, (*[]ShortlinkRule)(r))
+}
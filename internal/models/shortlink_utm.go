@@ -0,0 +1,102 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MaxUTMValueLength limits the length of a single UTM parameter template
+const MaxUTMValueLength = 255
+
+// UTMParams are campaign parameters appended to the destination of a shortlink. The
+// values are templates: {id}, {variant}, {referrer} and {date} are replaced with the
+// shortlink ID, the split test variant, the referring host and the current date.
+type UTMParams struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// UTMContext holds the values the placeholders of UTM templates are replaced with
+type UTMContext struct {
+	ID       string
+	Variant  string
+	Referrer string // Host of the referring page
+	Time     time.Time
+}
+
+// IsZero reports whether no parameter is set
+func (p UTMParams) IsZero() bool {
+	return p == UTMParams{}
+}
+
+// Normalize trims the templates and checks their length
+func (p UTMParams) Normalize() (UTMParams, error) {
+	for _, value := range []*string{&p.Source, &p.Medium, &p.Campaign, &p.Term, &p.Content} {
+		*value = strings.TrimSpace(*value)
+		if len(*value) > MaxUTMValueLength {
+			return UTMParams{}, fmt.Errorf("UTM values must be at most %d characters", MaxUTMValueLength)
+		}
+	}
+	return p, nil
+}
+
+// Apply adds the parameters to a query. Parameters the query already has are kept,
+// so tags set on the target or passed through from the visitor win.
+func (p UTMParams) Apply(query url.Values, ctx UTMContext) {
+	replacer := strings.NewReplacer(
+		"{id}", ctx.ID,
+		"{variant}", ctx.Variant,
+		"{referrer}", ctx.Referrer,
+		"{date}", ctx.Time.Format("2006-01-02"),
+	)
+
+	for _, param := range []struct{ name, value string }{
+		{"utm_source", p.Source},
+		{"utm_medium", p.Medium},
+		{"utm_campaign", p.Campaign},
+		{"utm_term", p.Term},
+		{"utm_content", p.Content},
+	} {
+		if param.value == "" || query.Has(param.name) {
+			continue
+		}
+		if value := replacer.Replace(param.value); value != "" {
+			query.Set(param.name, value)
+		}
+	}
+}
+
+// Value implements the driver.Valuer interface
+func (p UTMParams) Value() (driver.Value, error) {
+	if p.IsZero() {
+		return nil, nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (p *UTMParams) Scan(value any) error {
+	*p = UTMParams{}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return errors.New("invalid type for UTMParams")
+	}
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// Limits on the split test variants of a single shortlink
+const (
+	MaxShortlinkVariants = 10
+	MaxVariantNameLength = 32
+	MaxVariantWeight     = 1000
+)
+
+// ShortlinkVariant is one of the destinations of a split test. Visitors are spread
+// over the variants in proportion to their weights.
+type ShortlinkVariant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"` // Defaults to 1
+}
+
+// ShortlinkVariants are the weighted destinations of a shortlink that's being split
+// tested, stored as a JSON column
+type ShortlinkVariants []ShortlinkVariant
+
+// Normalize fills in default weights and checks that the variants have unique names
+// and sensible weights. Target URLs are left for the caller to validate.
+func (v ShortlinkVariants) Normalize() (ShortlinkVariants, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	if len(v) == 1 {
+		return nil, errors.New("a split test needs at least two variants")
+	}
+	if len(v) > MaxShortlinkVariants {
+		return nil, fmt.Errorf("at most %d variants are allowed", MaxShortlinkVariants)
+	}
+
+	variants := make(ShortlinkVariants, len(v))
+	for i, variant := range v {
+		variant.Name = strings.ToLower(strings.TrimSpace(variant.Name))
+		variant.URL = strings.TrimSpace(variant.URL)
+
+		if variant.Name == "" {
+			return nil, fmt.Errorf("variant %d has no name", i+1)
+		}
+		if len(variant.Name) > MaxVariantNameLength {
+			return nil, fmt.Errorf("variant name %q is longer than %d characters", variant.Name, MaxVariantNameLength)
+		}
+		for _, r := range variant.Name {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+				return nil, fmt.Errorf("variant name %q may only contain letters, digits, dashes and underscores", variant.Name)
+			}
+		}
+		if variants[:i].Find(variant.Name) != nil {
+			return nil, fmt.Errorf("variant name %q is used twice", variant.Name)
+		}
+
+		if variant.Weight == 0 {
+			variant.Weight = 1
+		}
+		if variant.Weight < 0 || variant.Weight > MaxVariantWeight {
+			return nil, fmt.Errorf("variant %q must have a weight between 1 and %d", variant.Name, MaxVariantWeight)
+		}
+		variants[i] = variant
+	}
+	return variants, nil
+}
+
+// Find returns the variant with the given name, if there is one
+func (v ShortlinkVariants) Find(name string) *ShortlinkVariant {
+	for i := range v {
+		if v[i].Name == name {
+			return &v[i]
+		}
+	}
+	return nil
+}
+
+// Pick chooses a variant by weight. The same key always gets the same variant, as
+// long as the variants don't change.
+func (v ShortlinkVariants) Pick(key string) *ShortlinkVariant {
+	total := 0
+	for _, variant := range v {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	point := int(hash.Sum64() % uint64(total))
+	for i := range v {
+		if point < v[i].Weight {
+			return &v[i]
+		}
+		point -= v[i].Weight
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (v ShortlinkVariants) Value() (driver.Value, error) {
+	return listValue(v)
+}
+
+// Scan implements the sql.Scanner interface
+func (v *ShortlinkVariants) Scan(value any) error {
+	return scanList(value, (*[]ShortlinkVariant)(v))
+}
+
+// MarshalJSON encodes missing variants as an empty array rather than null
+func (v ShortlinkVariants) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]ShortlinkVariant(v))
+}
+
+// UnmarshalJSON decodes the list of variants, see ShortlinkRules.UnmarshalJSON
+func (v *ShortlinkVariants) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*[]ShortlinkVariant)(v))
+}
+
+// UnmarshalText reads variants sent as a JSON encoded form field
+func (v *ShortlinkVariants) UnmarshalText(text []byte) error {
+	return json.Unmarshal(text, (*[]ShortlinkVariant)(v))
+}
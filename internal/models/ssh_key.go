@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SSHKey links an SSH public key to an API key, so uploads over SSH get that key's
+// quotas and can be listed or deleted later
+type SSHKey struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	APIKey      string `gorm:"type:varchar(64);not null;index"`
+	Fingerprint string `gorm:"type:varchar(64);not null;uniqueIndex"` // SHA256 fingerprint as printed by ssh-keygen -l
+	PublicKey   string `gorm:"type:text;not null"`                    // authorized_keys format
+	Comment     string `gorm:"type:varchar(255)"`
+
+	LastUsedAt *time.Time
+}
+
+// ToResponse converts an SSHKey to a response map
+func (k *SSHKey) ToResponse() fiber.Map {
+	return fiber.Map{
+		"id":           k.ID,
+		"fingerprint":  k.Fingerprint,
+		"public_key":   k.PublicKey,
+		"comment":      k.Comment,
+		"created_at":   k.CreatedAt,
+		"last_used_at": k.LastUsedAt,
+	}
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Limits on the tags of a single paste or shortlink
+const (
+	MaxTags      = 10
+	MaxTagLength = 32
+)
+
+// Tags is a list of labels on a paste or shortlink. They're stored as a single
+// delimited column, e.g. ",docs,go,", so a tag can be matched with a LIKE on both
+// PostgreSQL and SQLite.
+type Tags []string
+
+// ParseTags splits a comma separated list of tags, as sent in forms and headers
+func ParseTags(s string) Tags {
+	var tags Tags
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Normalize lowercases and deduplicates the tags, rejecting tags that are too long
+// or contain anything other than letters, digits, dashes, underscores and dots
+func (t Tags) Normalize() (Tags, error) {
+	var tags Tags
+	for _, tag := range t {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(tags, tag) {
+			continue
+		}
+		if len(tag) > MaxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+		}
+		for _, r := range tag {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
+				return nil, fmt.Errorf("tag %q may only contain letters, digits, dashes, underscores and dots", tag)
+			}
+		}
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > MaxTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", MaxTags)
+	}
+	return tags, nil
+}
+
+// Value implements the driver.Valuer interface
+func (t Tags) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return "", nil
+	}
+	return "," + strings.Join(t, ",") + ",", nil
+}
+
+// Scan implements the sql.Scanner interface
+func (t *Tags) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+	case []byte:
+		*t = ParseTags(string(v))
+	case string:
+		*t = ParseTags(v)
+	default:
+		return errors.New("invalid type for Tags")
+	}
+	return nil
+}
+
+// MarshalJSON encodes missing tags as an empty array rather than null
+func (t Tags) MarshalJSON() ([]byte, error) {
+	if t == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON accepts either an array of tags or a comma separated string
+func (t *Tags) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = ParseTags(s)
+		return nil
+	}
+
+	var tags []string
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return err
+	}
+	*t = tags
+	return nil
+}
+
+// UnmarshalText reads a comma separated list of tags, as sent in form fields
+func (t *Tags) UnmarshalText(text []byte) error {
+	*t = ParseTags(string(text))
+	return nil
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/watzon/0x45/internal/utils"
+	"gorm.io/gorm"
+)
+
+// Upload tracks a resumable (tus) upload until it is finalized into a paste
+type Upload struct {
+	ID        string `gorm:"primarykey;type:varchar(32)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Progress
+	Length int64 // Total size declared when the upload was created
+	Offset int64 `gorm:"column:upload_offset"` // Number of bytes received so far ("offset" is reserved in SQL)
+
+	// Upload-Metadata header sent on creation, kept verbatim for HEAD requests
+	Metadata string `gorm:"type:text"`
+
+	// Storage paths of the staged chunks, in upload order
+	Chunks JSON `gorm:"type:jsonb"`
+
+	// Access control
+	APIKey string `gorm:"type:varchar(64);index"` // If created with an API key
+
+	// Set once all bytes have been received and the paste was created
+	PasteID string `gorm:"type:varchar(32)"`
+
+	// Incomplete uploads are purged after this time
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// BeforeCreate generates the upload ID, which doubles as the secret needed to resume it
+func (u *Upload) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == "" {
+		u.ID = utils.MustGenerateID(32)
+	}
+	return nil
+}
+
+// GetChunks decodes the storage paths of the staged chunks
+func (u *Upload) GetChunks() []string {
+	var chunks []string
+	if len(u.Chunks) == 0 {
+		return chunks
+	}
+	_ = json.Unmarshal(u.Chunks, &chunks)
+	return chunks
+}
+
+// SetChunks encodes the storage paths of the staged chunks
+func (u *Upload) SetChunks(chunks []string) error {
+	data, err := json.Marshal(chunks)
+	if err != nil {
+		return err
+	}
+	u.Chunks = JSON(data)
+	return nil
+}
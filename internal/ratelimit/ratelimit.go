@@ -21,6 +21,7 @@ type RateLimiter struct {
 	// In-memory limiters (for single process mode)
 	globalLimiter *rate.Limiter
 	ipLimiters    sync.Map
+	ipBuckets     sync.Map // Buckets of Take, which can give tokens back
 
 	config   Config
 	useRedis bool
@@ -41,6 +42,7 @@ type Config struct {
 	}
 	Redis    *redis.Client // Optional: only required for prefork mode
 	UseRedis bool          // Whether to use Redis (true if prefork is enabled)
+	Prefix   string        // Optional: keeps the Redis keys of limiters sharing a server apart
 }
 
 // New creates a new RateLimiter instance
@@ -73,6 +75,42 @@ func (r *RateLimiter) Check(ip string) error {
 	return r.checkMemory(ip)
 }
 
+// Take takes a token from the per-IP bucket of ip in one step, reporting whether there
+// was one; the global limit doesn't apply. refund puts the token back, which lets
+// callers only count requests that turn out badly without racing parallel requests.
+func (r *RateLimiter) Take(ip string) (ok bool, refund func()) {
+	noop := func() {}
+	if !r.config.PerIP.Enabled {
+		return true, noop
+	}
+
+	if !r.useRedis {
+		b := r.getIPBucket(ip)
+		if !b.adjust(r.config.PerIP.Rate, r.config.PerIP.Burst, -1) {
+			return false, noop
+		}
+		return true, func() { b.adjust(r.config.PerIP.Rate, r.config.PerIP.Burst, 1) }
+	}
+
+	if r.redis == nil {
+		return false, noop
+	}
+	key := fmt.Sprintf("ip:%s", ip)
+	ok, err := r.adjustRedisTokens(context.Background(), key, r.config.PerIP.Rate, r.config.PerIP.Burst, -1)
+	if err != nil {
+		r.logger.Error("IP rate limit check failed", zap.Error(err), zap.String("ip", ip))
+		return false, noop
+	}
+	if !ok {
+		return false, noop
+	}
+	return true, func() {
+		if _, err := r.adjustRedisTokens(context.Background(), key, r.config.PerIP.Rate, r.config.PerIP.Burst, 1); err != nil {
+			r.logger.Error("IP rate limit refund failed", zap.Error(err), zap.String("ip", ip))
+		}
+	}
+}
+
 // checkMemory implements in-memory rate limiting using golang.org/x/time/rate
 func (r *RateLimiter) checkMemory(ip string) error {
 	// Check global rate limit if enabled
@@ -109,6 +147,41 @@ func (r *RateLimiter) getIPLimiter(ip string) *rate.Limiter {
 	return limiter.(*rate.Limiter)
 }
 
+// getIPBucket returns the bucket Take uses for the specified IP address
+func (r *RateLimiter) getIPBucket(ip string) *bucket {
+	b, _ := r.ipBuckets.LoadOrStore(ip, &bucket{})
+	return b.(*bucket)
+}
+
+// bucket is an in-memory token bucket that, unlike rate.Limiter, can be refilled by
+// hand. It follows the same steps as adjustScript does in Redis.
+type bucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// adjust refills the bucket for the time since its last update and adds delta tokens
+// to it, reporting false without changing it if that would leave it negative
+func (b *bucket) adjust(rate float64, burst int, delta float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+		b.last = now
+	}
+
+	tokens := math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate) + delta
+	if tokens < 0 {
+		return false
+	}
+	b.tokens = math.Min(float64(burst), tokens)
+	b.last = now
+	return true
+}
+
 // checkRedis implements Redis-based rate limiting for prefork mode
 func (r *RateLimiter) checkRedis(ip string) error {
 	if r.redis == nil {
@@ -161,9 +234,76 @@ func (r *RateLimiter) checkRedis(ip string) error {
 
 // checkRedisLimit implements a Redis-based token bucket algorithm
 func (r *RateLimiter) checkRedisLimit(ctx context.Context, key string, rate float64, burst int) (bool, error) {
-	// Create keys for the token count and last update time
-	tokenKey := fmt.Sprintf("ratelimit:%s:tokens", key)
-	timeKey := fmt.Sprintf("ratelimit:%s:ts", key)
+	tokens, now, err := r.redisTokens(ctx, key, rate, burst)
+	if err != nil {
+		return false, err
+	}
+
+	// Try to consume a token
+	if tokens < 1 {
+		return false, nil
+	}
+
+	// Update token count and timestamp. They can expire once the bucket would be full
+	// again, which takes longer than a second for slow rates.
+	tokenKey, timeKey := r.redisKeys(key)
+	ttl := max(time.Second, time.Duration(float64(burst)/rate*float64(time.Second)))
+	pipe := r.redis.Pipeline()
+	pipe.Set(ctx, tokenKey, tokens-1, ttl)
+	pipe.Set(ctx, timeKey, now, ttl)
+
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// adjustScript refills a bucket for the time since its last update and adds delta
+// tokens to it, as one step so parallel requests can't both take the last token.
+// It returns 0 without changing the bucket if that would leave it negative.
+var adjustScript = redis.NewScript(`
+local tokens = tonumber(redis.call("GET", KEYS[1]))
+local last = tonumber(redis.call("GET", KEYS[2]))
+local now, rate, burst = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local ttl, delta = tonumber(ARGV[4]), tonumber(ARGV[5])
+if tokens == nil or last == nil then
+	tokens = burst
+	last = now
+end
+tokens = math.min(burst, tokens + (now - last) / 1000 * rate) + delta
+if tokens < 0 then
+	return 0
+end
+redis.call("SET", KEYS[1], tostring(math.min(burst, tokens)), "PX", ttl)
+redis.call("SET", KEYS[2], now, "PX", ttl)
+return 1
+`)
+
+// adjustRedisTokens adds delta tokens to a bucket atomically, reporting false when
+// the bucket doesn't hold enough tokens to take them
+func (r *RateLimiter) adjustRedisTokens(ctx context.Context, key string, rate float64, burst int, delta int) (bool, error) {
+	tokenKey, timeKey := r.redisKeys(key)
+	ttl := max(time.Second, time.Duration(float64(burst)/rate*float64(time.Second)))
+	ok, err := adjustScript.Run(ctx, r.redis, []string{tokenKey, timeKey},
+		time.Now().UnixMilli(), rate, burst, ttl.Milliseconds(), delta).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+// redisKeys returns the keys holding the token count and last update time of a bucket
+func (r *RateLimiter) redisKeys(key string) (string, string) {
+	return fmt.Sprintf("ratelimit:%s%s:tokens", r.config.Prefix, key),
+		fmt.Sprintf("ratelimit:%s%s:ts", r.config.Prefix, key)
+}
+
+// redisTokens returns the tokens a bucket holds now, refilled for the time since its
+// last update, along with the current time in milliseconds
+func (r *RateLimiter) redisTokens(ctx context.Context, key string, rate float64, burst int) (float64, int64, error) {
+	tokenKey, timeKey := r.redisKeys(key)
 
 	now := time.Now().UnixMilli()
 	pipe := r.redis.Pipeline()
@@ -174,7 +314,7 @@ func (r *RateLimiter) checkRedisLimit(ctx context.Context, key string, rate floa
 
 	_, err := pipe.Exec(ctx)
 	if err != nil && err != redis.Nil {
-		return false, err
+		return 0, 0, err
 	}
 
 	// Get current token count or set to burst if key doesn't exist
@@ -187,22 +327,5 @@ func (r *RateLimiter) checkRedisLimit(ctx context.Context, key string, rate floa
 
 	// Calculate tokens to add based on time passed
 	timePassed := float64(now-lastUpdate) / 1000.0 // Convert to seconds
-	tokens = math.Min(float64(burst), tokens+(timePassed*rate))
-
-	// Try to consume a token
-	if tokens < 1 {
-		return false, nil
-	}
-
-	// Update token count and timestamp
-	pipe = r.redis.Pipeline()
-	pipe.Set(ctx, tokenKey, tokens-1, time.Second)
-	pipe.Set(ctx, timeKey, now, time.Second)
-
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		return false, err
-	}
-
-	return true, nil
+	return math.Min(float64(burst), tokens+(timePassed*rate)), now, nil
 }
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	config := Config{}
+	config.Global.Enabled = true
+	config.Global.Rate = 1
+	config.Global.Burst = 1
+	config.PerIP.Enabled = true
+	config.PerIP.Rate = 1.0 / 3600
+	config.PerIP.Burst = 3
+
+	t.Run("parallel", func(t *testing.T) {
+		limiter := New(config)
+
+		var taken atomic.Int32
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if ok, _ := limiter.Take("192.0.2.1"); ok {
+					taken.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if taken.Load() != 3 {
+			t.Errorf("taken = %d, want the burst of 3", taken.Load())
+		}
+		if ok, _ := limiter.Take("192.0.2.2"); !ok {
+			t.Error("other IPs should have their own bucket")
+		}
+	})
+
+	t.Run("refund", func(t *testing.T) {
+		limiter := New(config)
+
+		for range 10 {
+			ok, refund := limiter.Take("192.0.2.1")
+			if !ok {
+				t.Fatal("refunded tokens should be taken again")
+			}
+			refund()
+		}
+
+		for range 3 {
+			if ok, _ := limiter.Take("192.0.2.1"); !ok {
+				t.Fatal("expected a token")
+			}
+		}
+		if ok, _ := limiter.Take("192.0.2.1"); ok {
+			t.Error("expected the bucket to be empty")
+		}
+	})
+
+	t.Run("refills", func(t *testing.T) {
+		config := config
+		config.PerIP.Rate = 20
+		config.PerIP.Burst = 1
+		limiter := New(config)
+
+		if ok, _ := limiter.Take("192.0.2.1"); !ok {
+			t.Fatal("expected a token")
+		}
+		if ok, _ := limiter.Take("192.0.2.1"); ok {
+			t.Fatal("expected the bucket to be empty")
+		}
+		time.Sleep(100 * time.Millisecond)
+		if ok, _ := limiter.Take("192.0.2.1"); !ok {
+			t.Error("expected the bucket to refill")
+		}
+	})
+}
@@ -0,0 +1,294 @@
+package reputation
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// Hash prefixes are between 4 bytes and a full SHA-256 hash long
+const (
+	minHashPrefixLength = 4
+	maxHashPrefixLength = sha256.Size
+)
+
+// matcher looks a URL up in a loaded list
+type matcher interface {
+	lookup(u *url.URL) (string, bool)
+	len() int
+}
+
+// parseFunc reads the entries of a list file
+type parseFunc func(r io.Reader) (matcher, error)
+
+// fileList is a blocklist loaded from a file
+type fileList struct {
+	path  string
+	parse parseFunc
+
+	mu      sync.RWMutex
+	matcher matcher
+	modTime time.Time
+	bytes   int64
+}
+
+// Name implements Source
+func (l *fileList) Name() string {
+	return l.path
+}
+
+// Lookup implements Source
+func (l *fileList) Lookup(u *url.URL) (string, bool) {
+	l.mu.RLock()
+	m := l.matcher
+	l.mu.RUnlock()
+
+	if m == nil {
+		return "", false
+	}
+	return m.lookup(u)
+}
+
+// size returns the number of entries in the list
+func (l *fileList) size() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.matcher == nil {
+		return 0
+	}
+	return l.matcher.len()
+}
+
+// reload reads the file again if its modification time or size changed, reporting
+// whether it did
+func (l *fileList) reload() (bool, error) {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return false, err
+	}
+
+	l.mu.RLock()
+	unchanged := l.matcher != nil && info.ModTime().Equal(l.modTime) && info.Size() == l.bytes
+	l.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	m, err := l.parse(f)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", l.path, err)
+	}
+
+	l.mu.Lock()
+	l.matcher = m
+	l.modTime = info.ModTime()
+	l.bytes = info.Size()
+	l.mu.Unlock()
+	return true, nil
+}
+
+// readLines calls fn for every line of a list that isn't blank or a "#" comment
+func readLines(r io.Reader, fn func(n int, line string) error) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(n, line); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// domainSet blocks hosts and all of their subdomains
+type domainSet map[string]struct{}
+
+// parseDomains reads one domain per line. Lines in hosts file format, such as
+// "0.0.0.0 example.com", and trailing comments are accepted too.
+func parseDomains(r io.Reader) (matcher, error) {
+	domains := domainSet{}
+	err := readLines(r, func(_ int, line string) error {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return nil
+		}
+		domain := canonicalHost(strings.TrimPrefix(fields[len(fields)-1], "*."))
+		if domain == "" {
+			return fmt.Errorf("invalid domain %q", fields[len(fields)-1])
+		}
+		domains[domain] = struct{}{}
+		return nil
+	})
+	return domains, err
+}
+
+func (d domainSet) lookup(u *url.URL) (string, bool) {
+	host := canonicalHost(u.Hostname())
+	if net.ParseIP(host) != nil {
+		_, ok := d[host]
+		return host, ok
+	}
+
+	for {
+		if _, ok := d[host]; ok {
+			return host, true
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			return "", false
+		}
+		host = parent
+	}
+}
+
+func (d domainSet) len() int {
+	return len(d)
+}
+
+// patternList blocks URLs matching any of its regular expressions
+type patternList []*regexp.Regexp
+
+// parsePatterns reads one regular expression per line, matched against whole URLs
+func parsePatterns(r io.Reader) (matcher, error) {
+	var patterns patternList
+	err := readLines(r, func(_ int, line string) error {
+		pattern, err := regexp.Compile(line)
+		if err != nil {
+			return err
+		}
+		patterns = append(patterns, pattern)
+		return nil
+	})
+	return patterns, err
+}
+
+func (p patternList) lookup(u *url.URL) (string, bool) {
+	s := u.String()
+	for _, pattern := range p {
+		if pattern.MatchString(s) {
+			return pattern.String(), true
+		}
+	}
+	return "", false
+}
+
+func (p patternList) len() int {
+	return len(p)
+}
+
+// hashPrefixSet blocks URLs by SHA-256 prefixes of their host/path expressions, so
+// lists can be shared without spelling out the URLs they block
+type hashPrefixSet struct {
+	prefixes map[string]struct{}
+	lengths  []int
+}
+
+// parseHashPrefixes reads one hex encoded hash prefix per line
+func parseHashPrefixes(r io.Reader) (matcher, error) {
+	set := &hashPrefixSet{prefixes: map[string]struct{}{}}
+	err := readLines(r, func(_ int, line string) error {
+		prefix, err := hex.DecodeString(line)
+		if err != nil || len(prefix) < minHashPrefixLength || len(prefix) > maxHashPrefixLength {
+			return fmt.Errorf("invalid hash prefix %q, must be %d to %d hex encoded bytes", line, minHashPrefixLength, maxHashPrefixLength)
+		}
+		set.prefixes[string(prefix)] = struct{}{}
+		if !slices.Contains(set.lengths, len(prefix)) {
+			set.lengths = append(set.lengths, len(prefix))
+		}
+		return nil
+	})
+	return set, err
+}
+
+func (s *hashPrefixSet) lookup(u *url.URL) (string, bool) {
+	for _, expression := range expressions(u) {
+		sum := sha256.Sum256([]byte(expression))
+		for _, n := range s.lengths {
+			if _, ok := s.prefixes[string(sum[:n])]; ok {
+				return expression, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (s *hashPrefixSet) len() int {
+	return len(s.prefixes)
+}
+
+// expressions returns the host/path combinations a URL is looked up by in hash prefix
+// lists, like Safe Browsing does: the host and up to four of its parent domains, each
+// with the path and query, the path alone, the root and up to three leading
+// directories of the path. For "https://a.b.example.com/1/2.html?x=1" they include
+// "a.b.example.com/1/2.html?x=1", "b.example.com/1/" and "example.com/".
+func expressions(u *url.URL) []string {
+	host := canonicalHost(u.Hostname())
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		parts := strings.Split(host, ".")
+		for i := max(len(parts)-5, 1); i < len(parts)-1; i++ {
+			hosts = append(hosts, strings.Join(parts[i:], "."))
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	dir := "/"
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i := 0; ; i++ {
+		if !slices.Contains(paths, dir) {
+			paths = append(paths, dir)
+		}
+		if i >= len(segments)-1 || i >= 3 {
+			break
+		}
+		dir += segments[i] + "/"
+	}
+
+	result := make([]string, 0, len(hosts)*len(paths))
+	for _, h := range hosts {
+		for _, p := range paths {
+			result = append(result, h+p)
+		}
+	}
+	return result
+}
+
+// canonicalHost lowercases a host name, converting international names to their
+// ASCII form so look-alike spellings can't slip past a list
+func canonicalHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
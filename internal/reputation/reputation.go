@@ -0,0 +1,146 @@
+package reputation
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/watzon/0x45/internal/config"
+	"go.uber.org/zap"
+)
+
+// defaultReloadInterval is used when the reload interval is left empty
+const defaultReloadInterval = 30 * time.Second
+
+// Source is a blocklist URLs can be looked up in. Sources are used from many
+// goroutines at once, so lookups must be safe for concurrent use.
+type Source interface {
+	// Name identifies the source in logs
+	Name() string
+	// Lookup returns the entry that matches the URL, if one does
+	Lookup(u *url.URL) (string, bool)
+}
+
+// Verdict explains why a URL is blocked
+type Verdict struct {
+	Source string // Name of the source that matched
+	Match  string // The matching entry, such as a domain or a pattern
+}
+
+// Checker decides whether URLs are safe to send visitors to by looking them up in the
+// blocklists maintained by the instance operator. Lists loaded from files are reloaded
+// when the files change.
+type Checker struct {
+	logger      *zap.Logger
+	interval    time.Duration
+	sources     []Source
+	files       []*fileList
+	trustedKeys []string
+}
+
+// New creates a checker for the configured lists. A list that can't be loaded is
+// reported in the returned error and left empty until it loads on a later reload,
+// so the checker can always be used.
+func New(cfg config.ReputationConfig, logger *zap.Logger) (*Checker, error) {
+	c := &Checker{
+		logger:      logger,
+		interval:    cfg.ReloadInterval,
+		trustedKeys: cfg.TrustedKeys,
+	}
+	if c.interval <= 0 {
+		c.interval = defaultReloadInterval
+	}
+	if !cfg.Enabled {
+		return c, nil
+	}
+
+	for _, path := range cfg.DomainLists {
+		c.addFile(path, parseDomains)
+	}
+	for _, path := range cfg.PatternLists {
+		c.addFile(path, parsePatterns)
+	}
+	for _, path := range cfg.HashPrefixLists {
+		c.addFile(path, parseHashPrefixes)
+	}
+
+	_, err := c.Reload()
+	return c, err
+}
+
+// Add plugs in another source, such as a remote reputation service. Sources have to
+// be added before the checker is used.
+func (c *Checker) Add(source Source) {
+	c.sources = append(c.sources, source)
+}
+
+// Trusted reports whether the shortlinks of an API key skip the checks
+func (c *Checker) Trusted(apiKey string) bool {
+	return apiKey != "" && slices.Contains(c.trustedKeys, apiKey)
+}
+
+// Check looks a URL up in every source, returning nil when none of them block it
+func (c *Checker) Check(rawURL string) *Verdict {
+	if len(c.sources) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	for _, source := range c.sources {
+		if match, ok := source.Lookup(u); ok {
+			return &Verdict{Source: source.Name(), Match: match}
+		}
+	}
+	return nil
+}
+
+// Reload rereads the list files that changed since they were last loaded and returns
+// how many were reloaded. A list that fails to load keeps its previous entries.
+func (c *Checker) Reload() (int, error) {
+	var errs []error
+	reloaded := 0
+	for _, file := range c.files {
+		changed, err := file.reload()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if changed {
+			reloaded++
+			c.logger.Info("loaded URL blocklist", zap.String("path", file.path), zap.Int("entries", file.size()))
+		}
+	}
+	return reloaded, errors.Join(errs...)
+}
+
+// Watch reloads changed list files in the background
+func (c *Checker) Watch() {
+	if len(c.files) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := c.Reload(); err != nil {
+				c.logger.Error("failed to reload URL blocklists", zap.Error(err))
+			}
+		}
+	}()
+
+	c.logger.Info("watching URL blocklists", zap.Int("lists", len(c.files)), zap.Duration("interval", c.interval))
+}
+
+// addFile adds a list loaded from a file
+func (c *Checker) addFile(path string, parse parseFunc) {
+	file := &fileList{path: path, parse: parse}
+	c.files = append(c.files, file)
+	c.sources = append(c.sources, file)
+}
@@ -0,0 +1,167 @@
+package reputation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/watzon/0x45/internal/config"
+	"go.uber.org/zap"
+)
+
+func writeList(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hashPrefix(expression string) string {
+	sum := sha256.Sum256([]byte(expression))
+	return hex.EncodeToString(sum[:4])
+}
+
+func TestChecker(t *testing.T) {
+	dir := t.TempDir()
+	domains := filepath.Join(dir, "domains.txt")
+	patterns := filepath.Join(dir, "patterns.txt")
+	hashes := filepath.Join(dir, "hashes.txt")
+
+	writeList(t, domains, "# phishing\nevil.example\n0.0.0.0 tracker.example # hosts format\n*.wildcard.example\nbücher.example\n192.0.2.1\n")
+	writeList(t, patterns, `^https?://[^/]+/wp-admin/`+"\n")
+	writeList(t, hashes, hashPrefix("malware.example/payload/")+"\n")
+
+	checker, err := New(config.ReputationConfig{
+		Enabled:         true,
+		DomainLists:     []string{domains},
+		PatternLists:    []string{patterns},
+		HashPrefixLists: []string{hashes},
+		TrustedKeys:     []string{"trusted"},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{url: "https://evil.example/login", blocked: true},
+		{url: "https://WWW.Evil.Example./", blocked: true},
+		{url: "https://notevil.example/", blocked: false},
+		{url: "https://tracker.example/pixel.gif", blocked: true},
+		{url: "https://a.wildcard.example/", blocked: true},
+		{url: "https://xn--bcher-kva.example/", blocked: true},
+		{url: "https://bücher.example/", blocked: true},
+		{url: "http://192.0.2.1:8080/", blocked: true},
+		{url: "http://192.0.2.10/", blocked: false},
+		{url: "https://blog.example/wp-admin/setup.php", blocked: true},
+		{url: "https://blog.example/posts/wp-admin/", blocked: false},
+		{url: "https://malware.example/payload/run.exe?x=1", blocked: true},
+		{url: "https://cdn.malware.example/payload/", blocked: true},
+		{url: "https://malware.example/other/", blocked: false},
+		{url: "not a url", blocked: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if verdict := checker.Check(tt.url); (verdict != nil) != tt.blocked {
+				t.Errorf("Check(%q) = %+v, want blocked %v", tt.url, verdict, tt.blocked)
+			}
+		})
+	}
+
+	if verdict := checker.Check("https://evil.example/"); verdict == nil || verdict.Source != domains || verdict.Match != "evil.example" {
+		t.Errorf("unexpected verdict %+v", verdict)
+	}
+
+	if !checker.Trusted("trusted") || checker.Trusted("other") || checker.Trusted("") {
+		t.Error("only listed keys should be trusted")
+	}
+
+	t.Run("reload", func(t *testing.T) {
+		if n, err := checker.Reload(); err != nil || n != 0 {
+			t.Fatalf("Reload() = %d, %v, want nothing reloaded", n, err)
+		}
+
+		writeList(t, domains, "other.example\n")
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(domains, later, later); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := checker.Reload(); err != nil || n != 1 {
+			t.Fatalf("Reload() = %d, %v, want one list reloaded", n, err)
+		}
+		if checker.Check("https://evil.example/") != nil {
+			t.Error("removed entries should no longer block")
+		}
+		if checker.Check("https://other.example/") == nil {
+			t.Error("added entries should block")
+		}
+
+		// A broken list keeps what it had
+		writeList(t, patterns, "(unclosed\n")
+		later = later.Add(time.Minute)
+		if err := os.Chtimes(patterns, later, later); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := checker.Reload(); err == nil {
+			t.Error("expected an error for an invalid pattern")
+		}
+		if checker.Check("https://blog.example/wp-admin/") == nil {
+			t.Error("the previous patterns should still apply")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		checker, err := New(config.ReputationConfig{DomainLists: []string{domains}}, zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if checker.Check("https://other.example/") != nil {
+			t.Error("a disabled checker shouldn't block anything")
+		}
+	})
+
+	t.Run("missing list", func(t *testing.T) {
+		checker, err := New(config.ReputationConfig{Enabled: true, DomainLists: []string{filepath.Join(dir, "missing.txt")}}, zap.NewNop())
+		if err == nil {
+			t.Error("expected an error for a missing list")
+		}
+		if checker == nil || checker.Check("https://example.com/") != nil {
+			t.Error("the checker should still be usable")
+		}
+	})
+}
+
+func TestExpressions(t *testing.T) {
+	u, _ := url.Parse("https://a.b.c.d.e.f.example.com/1/2/3/4/5.html?x=1")
+	got := expressions(u)
+
+	for _, want := range []string{
+		"a.b.c.d.e.f.example.com/1/2/3/4/5.html?x=1",
+		"a.b.c.d.e.f.example.com/1/2/3/4/5.html",
+		"a.b.c.d.e.f.example.com/",
+		"a.b.c.d.e.f.example.com/1/2/3/",
+		"d.e.f.example.com/1/",
+		"example.com/",
+	} {
+		if !slices.Contains(got, want) {
+			t.Errorf("expressions missing %q", want)
+		}
+	}
+	for _, unwanted := range []string{"com/", "c.d.e.f.example.com/", "example.com/1/2/3/4/"} {
+		if slices.Contains(got, unwanted) {
+			t.Errorf("expressions shouldn't include %q", unwanted)
+		}
+	}
+
+	u, _ = url.Parse("http://192.0.2.1")
+	if got := expressions(u); !slices.Equal(got, []string{"192.0.2.1/"}) {
+		t.Errorf("expressions(%s) = %v", u, got)
+	}
+}
@@ -37,3 +37,28 @@ func (h *APIKeyHandlers) HandleRequestAPIKey(c *fiber.Ctx) error {
 func (h *APIKeyHandlers) HandleVerifyAPIKey(c *fiber.Ctx) error {
 	return h.services.APIKey.VerifyKey(c)
 }
+
+// HandleAddSSHKey links an SSH public key to the API key, for use with the SSH server
+func (h *APIKeyHandlers) HandleAddSSHKey(c *fiber.Ctx) error {
+	return h.services.APIKey.AddSSHKey(c)
+}
+
+// HandleListSSHKeys lists the SSH public keys linked to the API key
+func (h *APIKeyHandlers) HandleListSSHKeys(c *fiber.Ctx) error {
+	return h.services.APIKey.ListSSHKeys(c)
+}
+
+// HandleDeleteSSHKey unlinks an SSH public key from the API key
+func (h *APIKeyHandlers) HandleDeleteSSHKey(c *fiber.Ctx) error {
+	return h.services.APIKey.DeleteSSHKey(c)
+}
+
+// HandleGetInboundAddress returns the email address that turns mail into pastes for the API key
+func (h *APIKeyHandlers) HandleGetInboundAddress(c *fiber.Ctx) error {
+	return h.services.Inbound.GetAddress(c)
+}
+
+// HandleRotateInboundAddress replaces the inbound email address of the API key
+func (h *APIKeyHandlers) HandleRotateInboundAddress(c *fiber.Ctx) error {
+	return h.services.Inbound.RotateAddress(c)
+}
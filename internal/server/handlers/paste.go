@@ -10,6 +10,7 @@ import (
 	"github.com/gomarkdown/markdown/parser"
 	"github.com/valyala/fasthttp"
 	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/models"
 	"github.com/watzon/0x45/internal/server/services"
 	"go.uber.org/zap"
 )
@@ -37,9 +38,33 @@ func NewPasteHandlers(services *services.Services, logger *zap.Logger, config *c
 // @Success 200 {object} services.PasteResponse
 // @Failure 400 {object} fiber.Error
 func (h *PasteHandlers) HandleUpload(c *fiber.Ctx) error {
+	// Requests carrying several files create a collection instead
+	if h.services.Collection.IsCollectionUpload(c) {
+		return h.services.Collection.UploadCollection(c)
+	}
 	return h.services.Paste.UploadPaste(c)
 }
 
+// HandleRawUpload creates a paste from a raw PUT body, e.g. `curl -T file.log`
+func (h *PasteHandlers) HandleRawUpload(c *fiber.Ctx) error {
+	return h.services.Paste.UploadRawPaste(c, c.Params("filename"))
+}
+
+// HandleFork creates a new paste from an existing one
+func (h *PasteHandlers) HandleFork(c *fiber.Ctx) error {
+	return h.services.Paste.ForkPaste(c, getPasteID(c))
+}
+
+// HandleForkForm renders the editor prefilled with the paste being forked
+func (h *PasteHandlers) HandleForkForm(c *fiber.Ctx) error {
+	paste, err := h.services.Paste.GetPaste(getPasteID(c))
+	if err != nil {
+		return err
+	}
+
+	return h.services.Paste.RenderForkForm(c, paste)
+}
+
 // HandleView serves the content with syntax highlighting if applicable
 func (h *PasteHandlers) HandleView(c *fiber.Ctx) error {
 	id := getPasteID(c)
@@ -51,7 +76,15 @@ func (h *PasteHandlers) HandleView(c *fiber.Ctx) error {
 
 	paste, err := h.services.Paste.GetPaste(id)
 	if err != nil {
-		return err
+		collection, err := h.findCollection(id, err)
+		if err != nil {
+			return err
+		}
+
+		if strings.Contains(c.Get("Accept"), "application/xhtml+xml") {
+			return h.services.Collection.RenderCollection(c, collection)
+		}
+		return h.services.Collection.RenderCollectionJSON(c, collection)
 	}
 
 	if err := h.services.Analytics.LogPasteView(c, paste.ID); err != nil {
@@ -112,7 +145,11 @@ func (h *PasteHandlers) HandleRawView(c *fiber.Ctx) error {
 
 	paste, err := h.services.Paste.GetPaste(id)
 	if err != nil {
-		return err
+		collection, err := h.findCollection(id, err)
+		if err != nil {
+			return err
+		}
+		return h.services.Collection.RenderCollectionRaw(c, collection)
 	}
 
 	return h.services.Paste.RenderPasteRaw(c, paste)
@@ -129,15 +166,101 @@ func (h *PasteHandlers) HandleDownload(c *fiber.Ctx) error {
 
 	paste, err := h.services.Paste.GetPaste(id)
 	if err != nil {
-		return err
+		collection, err := h.findCollection(id, err)
+		if err != nil {
+			return err
+		}
+		return h.services.Collection.RenderDownload(c, collection)
 	}
 
 	return h.services.Paste.RenderDownload(c, paste)
 }
 
-// HandleDeleteWithKey deletes a paste using its deletion key
+// HandleArchive lists the contents of a zip or tar archive paste
+func (h *PasteHandlers) HandleArchive(c *fiber.Ctx) error {
+	paste, err := h.services.Paste.GetPaste(getPasteID(c))
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(c.Get("Accept"), "application/xhtml+xml") {
+		return h.services.Archive.RenderTree(c, paste)
+	}
+	return h.services.Archive.RenderListJSON(c, paste)
+}
+
+// HandleArchiveView serves a single archive entry with syntax highlighting if applicable
+func (h *PasteHandlers) HandleArchiveView(c *fiber.Ctx) error {
+	paste, err := h.services.Paste.GetPaste(getPasteID(c))
+	if err != nil {
+		return err
+	}
+
+	return h.services.Archive.RenderEntry(c, paste, c.Params("*"))
+}
+
+// HandleArchiveRaw serves the raw content of a single archive entry
+func (h *PasteHandlers) HandleArchiveRaw(c *fiber.Ctx) error {
+	paste, err := h.services.Paste.GetPaste(getPasteID(c))
+	if err != nil {
+		return err
+	}
+
+	return h.services.Archive.RenderEntryRaw(c, paste, c.Params("*"))
+}
+
+// HandleDeleteWithKey deletes a paste or collection using its deletion key
 func (h *PasteHandlers) HandleDeleteWithKey(c *fiber.Ctx) error {
-	return h.services.Paste.DeleteWithKey(c, getPasteID(c))
+	id := getPasteID(c)
+
+	if _, err := h.services.Paste.GetPaste(id); err != nil {
+		collection, err := h.findCollection(id, err)
+		if err != nil {
+			return err
+		}
+		return h.services.Collection.DeleteWithKey(c, collection)
+	}
+
+	return h.services.Paste.DeleteWithKey(c, id)
+}
+
+// HandleCollectionFile serves the raw content of a single file in a collection
+func (h *PasteHandlers) HandleCollectionFile(c *fiber.Ctx) error {
+	collection, err := h.services.Collection.FindCollection(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return h.services.Collection.RenderFileRaw(c, collection, c.Params("*"))
+}
+
+// HandleTusOptions advertises the supported tus protocol version and extensions
+func (h *PasteHandlers) HandleTusOptions(c *fiber.Ctx) error {
+	return h.services.Tus.Options(c)
+}
+
+// HandleTusCreate starts a resumable upload
+func (h *PasteHandlers) HandleTusCreate(c *fiber.Ctx) error {
+	return h.services.Tus.Create(c)
+}
+
+// HandleTusHead reports the offset of a resumable upload
+func (h *PasteHandlers) HandleTusHead(c *fiber.Ctx) error {
+	return h.services.Tus.Head(c, c.Params("id"))
+}
+
+// HandleTusPatch appends a chunk to a resumable upload
+func (h *PasteHandlers) HandleTusPatch(c *fiber.Ctx) error {
+	return h.services.Tus.Patch(c, c.Params("id"))
+}
+
+// HandleTusDelete terminates a resumable upload
+func (h *PasteHandlers) HandleTusDelete(c *fiber.Ctx) error {
+	return h.services.Tus.Delete(c, c.Params("id"))
+}
+
+// HandleSearchPastes searches the filenames and content of the API key's pastes
+func (h *PasteHandlers) HandleSearchPastes(c *fiber.Ctx) error {
+	return h.services.Search.Search(c)
 }
 
 // HandleListPastes returns a paginated list of pastes for the API key
@@ -150,11 +273,33 @@ func (h *PasteHandlers) HandleDeletePaste(c *fiber.Ctx) error {
 	return h.services.Paste.Delete(c, getPasteID(c))
 }
 
+// HandleUpdatePaste edits the title, description and tags of a paste
+func (h *PasteHandlers) HandleUpdatePaste(c *fiber.Ctx) error {
+	return h.services.Paste.UpdateDetails(c, getPasteID(c))
+}
+
 // HandleUpdateExpiration updates a paste's expiration time
 func (h *PasteHandlers) HandleUpdateExpiration(c *fiber.Ctx) error {
 	return h.services.Paste.UpdateExpiration(c, getPasteID(c))
 }
 
+// HandleGetPasteQR returns a QR code of the paste's URL
+func (h *PasteHandlers) HandleGetPasteQR(c *fiber.Ctx) error {
+	id := getPasteID(c)
+
+	// Get extension from locals if available
+	if ext := c.Locals("extension"); ext != nil {
+		id = id + "." + ext.(string)
+	}
+
+	paste, err := h.services.Paste.GetPaste(id)
+	if err != nil {
+		return err
+	}
+
+	return h.services.Paste.GetPasteQR(c, paste)
+}
+
 // HandleGetPasteImage returns an image of the paste suitable for Open Graph
 func (h *PasteHandlers) HandleGetPasteImage(c *fiber.Ctx) error {
 	id := getPasteID(c)
@@ -230,6 +375,20 @@ func (h *PasteHandlers) HandlePreview(c *fiber.Ctx) error {
 	}, "layouts/main")
 }
 
+// findCollection looks up a collection when no paste with the given ID exists.
+// Any error other than a missing paste is passed through unchanged.
+func (h *PasteHandlers) findCollection(id string, pasteErr error) (*models.Collection, error) {
+	if e, ok := pasteErr.(*fiber.Error); !ok || e.Code != fiber.StatusNotFound {
+		return nil, pasteErr
+	}
+
+	collection, err := h.services.Collection.FindCollection(id)
+	if err != nil {
+		return nil, pasteErr
+	}
+	return collection, nil
+}
+
 // formatExpiryTime formats a time pointer into a string
 func formatExpiryTime(t *time.Time) string {
 	if t == nil {
@@ -251,3 +410,13 @@ func formatSize(size int64) string {
 	}
 	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
 }
+
+// HandleBatchUpload creates several pastes from a single request
+func (h *PasteHandlers) HandleBatchUpload(c *fiber.Ctx) error {
+	return h.services.Batch.UploadPastes(c)
+}
+
+// HandleBatchDelete deletes several pastes owned by the API key
+func (h *PasteHandlers) HandleBatchDelete(c *fiber.Ctx) error {
+	return h.services.Batch.DeletePastes(c)
+}
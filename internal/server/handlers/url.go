@@ -1,12 +1,25 @@
 package handlers
 
 import (
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/models"
 	"github.com/watzon/0x45/internal/server/services"
 	"go.uber.org/zap"
 )
 
+// managementRoutes are the paths below "/u/:id" that belong to the URL management API
+// rather than being passed through to the target
+var managementRoutes = map[string]bool{
+	"stats":    true,
+	"history":  true,
+	"preview":  true,
+	"rollback": true,
+	"qr":       true,
+}
+
 type URLHandlers struct {
 	services *services.Services
 	logger   *zap.Logger
@@ -27,6 +40,11 @@ func (h *URLHandlers) HandleURLShorten(c *fiber.Ctx) error {
 	return h.services.URL.CreateShortlink(c)
 }
 
+// HandleBatchShorten creates several shortlinks from a single request
+func (h *URLHandlers) HandleBatchShorten(c *fiber.Ctx) error {
+	return h.services.Batch.CreateShortlinks(c)
+}
+
 // HandleURLStats returns statistics for a shortened URL
 func (h *URLHandlers) HandleURLStats(c *fiber.Ctx) error {
 	return h.services.URL.GetStats(c)
@@ -37,6 +55,21 @@ func (h *URLHandlers) HandleListURLs(c *fiber.Ctx) error {
 	return h.services.URL.ListURLs(c)
 }
 
+// HandleUpdateURL edits the target, title and tags of a URL
+func (h *URLHandlers) HandleUpdateURL(c *fiber.Ctx) error {
+	return h.services.URL.Update(c)
+}
+
+// HandleURLHistory lists the changes made to a URL
+func (h *URLHandlers) HandleURLHistory(c *fiber.Ctx) error {
+	return h.services.URL.History(c)
+}
+
+// HandleRollbackURL restores a URL's target from before one of its changes
+func (h *URLHandlers) HandleRollbackURL(c *fiber.Ctx) error {
+	return h.services.URL.Rollback(c)
+}
+
 // HandleUpdateURLExpiration updates a URL's expiration time
 func (h *URLHandlers) HandleUpdateURLExpiration(c *fiber.Ctx) error {
 	return h.services.URL.UpdateExpiration(c)
@@ -47,18 +80,89 @@ func (h *URLHandlers) HandleDeleteURL(c *fiber.Ctx) error {
 	return h.services.URL.Delete(c)
 }
 
-// HandleRedirect redirects to the target URL
+// HandlePreviewURL shows where a URL leads without redirecting
+func (h *URLHandlers) HandlePreviewURL(c *fiber.Ctx) error {
+	return h.services.URL.Preview(c, c.Params("id"))
+}
+
+// HandleDeleteURLWithKey deletes a URL using the deletion key from its delete URL. GET
+// requests whose second path segment isn't the key are passed through to the target.
+func (h *URLHandlers) HandleDeleteURLWithKey(c *fiber.Ctx) error {
+	if c.Method() == fiber.MethodGet && !h.services.URL.HasDeleteKey(c.Params("id"), c.Params("key")) {
+		return c.Next()
+	}
+	return h.services.URL.DeleteWithKey(c, c.Params("id"))
+}
+
+// HandleURLQR returns a QR code of the short URL
+func (h *URLHandlers) HandleURLQR(c *fiber.Ctx) error {
+	return h.services.URL.QR(c, c.Params("id"))
+}
+
+// HandleRedirect redirects to the target URL, or where the shortlink's rules send the visitor.
+// It also takes the password form of protected URLs, which posts back to the same path.
 func (h *URLHandlers) HandleRedirect(c *fiber.Ctx) error {
 	id := c.Params("id")
+
+	// "/u/:id+" shows where a shortlink leads instead of going there
+	if id, ok := strings.CutSuffix(id, "+"); ok {
+		return h.services.URL.Preview(c, id)
+	}
+
 	shortlink, err := h.services.URL.FindShortlink(id)
+	if c.Method() == fiber.MethodPost && (err != nil || !shortlink.HasPassword()) {
+		return c.Next()
+	}
 	if err != nil {
 		return err
 	}
+	return h.redirect(c, shortlink)
+}
+
+// HandleRedirectPath redirects "/u/:id/more/path" for URLs that pass path suffixes
+// through. Everything else falls through to the URL management routes.
+func (h *URLHandlers) HandleRedirectPath(c *fiber.Ctx) error {
+	if managementRoutes[c.Params("*")] {
+		return c.Next()
+	}
+
+	shortlink, err := h.services.URL.FindShortlink(c.Params("id"))
+	if err != nil || !shortlink.Passthrough {
+		return c.Next()
+	}
+	if c.Method() == fiber.MethodPost && !shortlink.HasPassword() {
+		return c.Next()
+	}
+	return h.redirect(c, shortlink)
+}
+
+// redirect sends the visitor on to where the shortlink leads for them, once they gave
+// its password and by way of the interstitial when it has one
+func (h *URLHandlers) redirect(c *fiber.Ctx, shortlink *models.Shortlink) error {
+	if !h.services.URL.Unlocked(c, shortlink) {
+		return h.services.URL.RenderPasswordPrompt(c, shortlink)
+	}
+	if c.Query("confirm") == "" && h.services.URL.NeedsInterstitial(shortlink) {
+		return h.services.URL.RenderInterstitial(c, shortlink)
+	}
+
+	target, variant := h.services.URL.Target(c, shortlink)
+	if h.services.URL.Blocked(shortlink, target) {
+		return fiber.NewError(fiber.StatusForbidden, "Destination is blocked on this instance")
+	}
+
+	if err := h.services.URL.CountClick(shortlink); err != nil {
+		return err
+	}
 
 	// Log the click
-	if err := h.services.Analytics.LogShortlinkClick(c, shortlink.ID); err != nil {
+	if err := h.services.Analytics.LogShortlinkClick(c, shortlink.ID, variant); err != nil {
 		h.logger.Error("failed to log shortlink click", zap.Error(err))
 	}
 
-	return c.Redirect(shortlink.TargetURL, fiber.StatusTemporaryRedirect)
+	// The password form is posted, send the browser on with a GET
+	if c.Method() == fiber.MethodPost {
+		return c.Redirect(target, fiber.StatusSeeOther)
+	}
+	return c.Redirect(target, shortlink.Status())
 }
@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"regexp"
 
 	"github.com/dustin/go-humanize"
@@ -33,6 +35,24 @@ func (h *WebHandlers) getBaseURLHost() string {
 	return httpRe.ReplaceAllString(h.config.Server.BaseURL, "")
 }
 
+// getListenerInfo describes an optional non-HTTP listener for the docs, if it is enabled
+func (h *WebHandlers) getListenerInfo(enabled bool, address string) fiber.Map {
+	if !enabled {
+		return nil
+	}
+
+	host := "localhost"
+	if u, err := url.Parse(h.config.Server.BaseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	_, port, _ := net.SplitHostPort(address)
+
+	return fiber.Map{
+		"host": host,
+		"port": port,
+	}
+}
+
 // HandleIndex serves the main web interface page
 func (h *WebHandlers) HandleIndex(c *fiber.Ctx) error {
 	h.logger.Debug("generating retention data for index page")
@@ -109,6 +129,10 @@ func (h *WebHandlers) HandleDocs(c *fiber.Ctx) error {
 		"baseUrlHost":    h.getBaseURLHost(),
 		"baseUrl":        h.config.Server.BaseURL,
 		"apiKeysEnabled": h.services.APIKey.IsEnabled(),
+		"tcp":            h.getListenerInfo(h.config.Server.TCP.Enabled, h.config.Server.TCP.Address),
+		"ssh":            h.getListenerInfo(h.config.Server.SSH.Enabled, h.config.Server.SSH.Address),
+		"sshAnonymous":   h.config.Server.SSH.Anonymous,
+		"inboundEmail":   h.config.SMTP.Inbound.Enabled,
 		"retention": fiber.Map{
 			"noKey":   retentionStats.NoKeyRange,
 			"withKey": retentionStats.WithKeyRange,
@@ -82,8 +82,9 @@ func (m *Middleware) Recover() fiber.Handler {
 func (m *Middleware) CORS() fiber.Handler {
 	return cors.New(cors.Config{
 		AllowOrigins:     strings.Join(m.config.Server.CORSOrigins, ","),
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
+		AllowMethods:     "GET,HEAD,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,Tus-Resumable,Upload-Length,Upload-Offset,Upload-Metadata",
+		ExposeHeaders:    "Location,Tus-Resumable,Tus-Version,Tus-Extension,Tus-Max-Size,Upload-Offset,Upload-Length,Upload-Metadata,Upload-Expires,X-Paste-Id,X-Paste-Url,X-Paste-Delete-Url",
 		AllowCredentials: false,
 		MaxAge:           300,
 	})
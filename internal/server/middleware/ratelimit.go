@@ -8,13 +8,16 @@ import (
 	"github.com/redis/go-redis/v9"
 	"github.com/watzon/0x45/internal/config"
 	"github.com/watzon/0x45/internal/ratelimit"
+	"github.com/watzon/0x45/internal/server/services"
 	"go.uber.org/zap"
 )
 
 type RateLimiter struct {
-	logger  *zap.Logger
-	config  *config.Config
-	limiter *ratelimit.RateLimiter
+	logger     *zap.Logger
+	config     *config.Config
+	limiter    *ratelimit.RateLimiter
+	shortlinks *ratelimit.RateLimiter // Stricter per-IP limit for anonymous shortlinks
+	passwords  *ratelimit.RateLimiter // Per-IP limit on wrong shortlink passwords
 }
 
 func NewRateLimiter(logger *zap.Logger, config *config.Config) *RateLimiter {
@@ -56,10 +59,39 @@ func NewRateLimiter(logger *zap.Logger, config *config.Config) *RateLimiter {
 		limiterConfig.Redis = redisClient
 	}
 
+	// Anonymous shortlinks get a bucket of Limit tokens per IP that refills over the
+	// window. A limit of 0 turns it off.
+	anonymous := config.Server.Shortlinks.Anonymous
+	shortlinkConfig := ratelimit.Config{
+		Redis:    limiterConfig.Redis,
+		UseRedis: limiterConfig.UseRedis,
+		Prefix:   "shortlinks:",
+	}
+	if anonymous.Limit > 0 && anonymous.Window > 0 {
+		shortlinkConfig.PerIP.Enabled = true
+		shortlinkConfig.PerIP.Rate = float64(anonymous.Limit) / anonymous.Window.Seconds()
+		shortlinkConfig.PerIP.Burst = anonymous.Limit
+	}
+
+	// Wrong passwords of protected shortlinks work the same way
+	passwords := config.Server.Shortlinks.Passwords
+	passwordConfig := ratelimit.Config{
+		Redis:    limiterConfig.Redis,
+		UseRedis: limiterConfig.UseRedis,
+		Prefix:   "passwords:",
+	}
+	if passwords.Limit > 0 && passwords.Window > 0 {
+		passwordConfig.PerIP.Enabled = true
+		passwordConfig.PerIP.Rate = float64(passwords.Limit) / passwords.Window.Seconds()
+		passwordConfig.PerIP.Burst = passwords.Limit
+	}
+
 	return &RateLimiter{
-		logger:  logger,
-		config:  config,
-		limiter: ratelimit.New(limiterConfig),
+		logger:     logger,
+		config:     config,
+		limiter:    ratelimit.New(limiterConfig),
+		shortlinks: ratelimit.New(shortlinkConfig),
+		passwords:  ratelimit.New(passwordConfig),
 	}
 }
 
@@ -88,3 +120,56 @@ func (m *RateLimiter) RateLimit() fiber.Handler {
 		return c.Next()
 	}
 }
+
+// AnonymousShortlinks returns a middleware that limits how many shortlinks each IP
+// creates without an API key, while the instance offers them. It has to run after the
+// auth middleware.
+func (m *RateLimiter) AnonymousShortlinks() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		shortlinks := m.config.Server.Shortlinks
+		if c.Locals("apiKey") != nil || !shortlinks.Anonymous.Enabled || !shortlinks.Reputation.Enabled {
+			return c.Next()
+		}
+
+		if err := m.shortlinks.Check(c.IP()); err != nil {
+			m.logger.Warn("anonymous shortlink rate limit exceeded",
+				zap.String("ip", c.IP()),
+				zap.Error(err),
+			)
+			return err
+		}
+
+		return c.Next()
+	}
+}
+
+// ShortlinkPasswords returns a middleware that limits how many wrong passwords of
+// protected shortlinks each IP can try. Every password attempt takes a token before
+// it's checked, so parallel guesses can't get past the limit, and gets it back unless
+// the URL service flags the password as wrong on the context. Once an IP used them
+// up, its password attempts are refused before they are checked.
+func (m *RateLimiter) ShortlinkPasswords() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if services.ShortlinkPassword(c) == "" {
+			return c.Next()
+		}
+
+		ok, refund := m.passwords.Take(c.IP())
+		if !ok {
+			m.logger.Warn("shortlink password rate limit exceeded", zap.String("ip", c.IP()))
+			return fiber.NewError(fiber.StatusTooManyRequests, "Too many wrong passwords, please try again later")
+		}
+
+		err := c.Next()
+		if wrong, _ := c.Locals("wrongPassword").(bool); !wrong {
+			refund()
+		}
+		return err
+	}
+}
+
+// Check applies the global and per-IP limits to a client that doesn't go through
+// fiber, such as a raw TCP connection
+func (m *RateLimiter) Check(ip string) error {
+	return m.limiter.Check(ip)
+}
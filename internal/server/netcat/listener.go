@@ -0,0 +1,300 @@
+// Package netcat accepts pastes piped over a raw TCP connection, termbin style:
+//
+//	cat file.log | nc host 9999
+//
+// The connection is read until the client closes it or stops sending data, and
+// the URL of the new paste is written back before the connection is closed.
+package netcat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/server/services"
+	"go.uber.org/zap"
+)
+
+// Defaults used when the tcp section of the config is left empty
+const (
+	defaultIdleTimeout    = 5 * time.Second
+	defaultTimeout        = time.Minute
+	defaultMaxConnections = 100
+)
+
+// RateLimiter is satisfied by the server's HTTP rate limiter, so TCP clients share its limits
+type RateLimiter interface {
+	Check(ip string) error
+}
+
+// Listener serves raw TCP paste uploads
+type Listener struct {
+	logger  *zap.Logger
+	config  *config.Config
+	paste   *services.PasteService
+	limiter RateLimiter
+
+	// slots holds a token for every connection being handled, capping how many
+	// slow clients can tie up sockets and goroutines at once
+	slots chan struct{}
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closed   bool
+}
+
+func NewListener(logger *zap.Logger, config *config.Config, paste *services.PasteService, limiter RateLimiter) *Listener {
+	maxConnections := config.Server.TCP.MaxConnections
+	if maxConnections <= 0 {
+		maxConnections = defaultMaxConnections
+	}
+
+	return &Listener{
+		logger:  logger,
+		config:  config,
+		paste:   paste,
+		limiter: limiter,
+		slots:   make(chan struct{}, maxConnections),
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen binds the configured address. Connections are accepted once Serve is called.
+func (l *Listener) Listen() error {
+	ln, err := net.Listen("tcp", l.config.Server.TCP.Address)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.listener = ln
+	l.mu.Unlock()
+	return nil
+}
+
+// Addr returns the address the listener is bound to
+func (l *Listener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.listener == nil {
+		return nil
+	}
+	return l.listener.Addr()
+}
+
+// Serve accepts connections until Shutdown is called
+func (l *Listener) Serve() error {
+	l.mu.Lock()
+	ln := l.listener
+	l.mu.Unlock()
+	if ln == nil {
+		return errors.New("netcat: Serve called before Listen")
+	}
+
+	l.logger.Info("tcp paste listener started", zap.String("address", ln.Addr().String()))
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if l.isClosed() {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			l.reply(conn, fiber.NewError(fiber.StatusServiceUnavailable, "Too many connections, please try again later"))
+			conn.Close()
+			continue
+		}
+
+		if !l.track(conn) {
+			<-l.slots
+			conn.Close()
+			return nil
+		}
+
+		go func() {
+			defer func() { <-l.slots }()
+			defer l.untrack(conn)
+			l.handle(conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and waits for active ones to finish.
+// Connections still open when ctx is done are closed forcibly.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.closed = true
+	var err error
+	if l.listener != nil {
+		err = l.listener.Close()
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		l.mu.Lock()
+		for conn := range l.conns {
+			conn.Close()
+		}
+		l.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// handle reads a single paste from the connection and replies with its URL
+func (l *Listener) handle(conn net.Conn) {
+	defer conn.Close()
+
+	// However the client trickles its data in, the connection ends at this deadline
+	deadline := time.Now().Add(l.timeout())
+	if err := conn.SetDeadline(deadline); err != nil {
+		return
+	}
+
+	ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	if err := l.limiter.Check(ip); err != nil {
+		l.reply(conn, err)
+		return
+	}
+
+	content, err := l.read(conn, deadline)
+	if err != nil {
+		l.reply(conn, err)
+		return
+	}
+
+	paste, err := l.paste.CreatePaste(content, nil, &services.PasteOptions{})
+	if err != nil {
+		l.reply(conn, err)
+		return
+	}
+
+	l.logger.Debug("created paste over tcp",
+		zap.String("id", paste.ID),
+		zap.String("ip", ip),
+		zap.Int("size", len(content)))
+
+	_ = conn.SetWriteDeadline(time.Now().Add(l.idleTimeout()))
+	_, _ = fmt.Fprintln(conn, l.paste.PasteURL(paste))
+}
+
+// read collects data until EOF or until the client goes quiet for the idle timeout,
+// which is how plain `nc` signals that it's done without closing the socket. Data
+// still arriving at the deadline is refused rather than cut short.
+func (l *Listener) read(conn net.Conn, deadline time.Time) ([]byte, error) {
+	limit := int64(l.config.Server.DefaultUploadSize)
+	reader := &idleReader{conn: conn, timeout: l.idleTimeout(), deadline: deadline}
+
+	content, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Failed to read paste")
+	}
+	if err != nil && !time.Now().Before(deadline) {
+		return nil, fiber.NewError(fiber.StatusRequestTimeout, fmt.Sprintf("Paste took longer than %s to send", l.timeout()))
+	}
+
+	if int64(len(content)) > limit {
+		return nil, fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds default upload limit of %d bytes", limit))
+	}
+
+	return content, nil
+}
+
+// reply writes an error message back to the client
+func (l *Listener) reply(conn net.Conn, err error) {
+	message := "Internal Server Error"
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		message = fe.Message
+	} else {
+		l.logger.Error("failed to create paste over tcp", zap.Error(err))
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(l.idleTimeout()))
+	_, _ = fmt.Fprintf(conn, "error: %s\n", message)
+}
+
+func (l *Listener) idleTimeout() time.Duration {
+	if l.config.Server.TCP.IdleTimeout > 0 {
+		return l.config.Server.TCP.IdleTimeout
+	}
+	return defaultIdleTimeout
+}
+
+func (l *Listener) timeout() time.Duration {
+	if l.config.Server.TCP.Timeout > 0 {
+		return l.config.Server.TCP.Timeout
+	}
+	return defaultTimeout
+}
+
+func (l *Listener) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// track registers an active connection, refusing it once shutdown has begun
+func (l *Listener) track(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.conns[conn] = struct{}{}
+	l.wg.Add(1)
+	return true
+}
+
+func (l *Listener) untrack(conn net.Conn) {
+	l.mu.Lock()
+	delete(l.conns, conn)
+	l.mu.Unlock()
+	l.wg.Done()
+}
+
+// idleReader pushes the read deadline forward before every read, so a pause in
+// the data ends the paste, but never past the connection's overall deadline
+type idleReader struct {
+	conn     net.Conn
+	timeout  time.Duration
+	deadline time.Time
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	next := time.Now().Add(r.timeout)
+	if next.After(r.deadline) {
+		next = r.deadline
+	}
+	if err := r.conn.SetReadDeadline(next); err != nil {
+		return 0, err
+	}
+	return r.conn.Read(p)
+}
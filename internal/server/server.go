@@ -13,9 +13,13 @@ import (
 	"github.com/watzon/0x45/internal/database"
 	"github.com/watzon/0x45/internal/server/handlers"
 	"github.com/watzon/0x45/internal/server/middleware"
+	"github.com/watzon/0x45/internal/server/netcat"
 	"github.com/watzon/0x45/internal/server/services"
+	"github.com/watzon/0x45/internal/server/smtpd"
+	"github.com/watzon/0x45/internal/server/sshd"
 	"github.com/watzon/0x45/internal/server/template"
 	"github.com/watzon/0x45/internal/storage"
+	"github.com/watzon/0x45/internal/utils"
 	"github.com/watzon/hdur"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -30,6 +34,9 @@ type Server struct {
 	services   *services.Services
 	handlers   *handlers.Handlers
 	middleware *middleware.Middleware
+	tcp        *netcat.Listener
+	ssh        *sshd.Server
+	smtp       *smtpd.Server
 }
 
 func New(config *config.Config, logger *zap.Logger) *Server {
@@ -58,9 +65,15 @@ func New(config *config.Config, logger *zap.Logger) *Server {
 		},
 	})
 
+	// Refuse to start with ID settings that would produce unusable IDs
+	if err := utils.ValidateIDsConfig(config.IDs); err != nil {
+		logger.Fatal("Invalid ID configuration", zap.Error(err))
+	}
+
 	// Initialize database
 	db, err := database.New(config, &gorm.Config{
 		// Logger: gormLogger,
+		TranslateError: true, // Report unique violations as gorm.ErrDuplicatedKey
 	})
 	if err != nil {
 		logger.Fatal("Error connecting to database", zap.Error(err))
@@ -137,8 +150,10 @@ func (s *Server) SetupMiddleware() {
 	// Setup CORS
 	s.app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin, Content-Type, Accept",
+		AllowMethods: "GET,HEAD,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata",
+		// Let browser tus clients read the upload state and resulting paste
+		ExposeHeaders: "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Metadata, Upload-Expires, X-Paste-Id, X-Paste-Url, X-Paste-Delete-Url",
 	}))
 
 	// Add request logging
@@ -162,16 +177,37 @@ func (s *Server) SetupRoutes() {
 	keys := s.app.Group("/keys")
 	keys.Post("/request", s.handlers.APIKey.HandleRequestAPIKey)
 	keys.Get("/verify", s.handlers.APIKey.HandleVerifyAPIKey)
-
-	// URL redirect route - must be before the group to avoid auth middleware
-	s.app.Get("/u/:id", s.handlers.URL.HandleRedirect)
+	keys.Get("/ssh", s.middleware.Auth.Auth(true), s.handlers.APIKey.HandleListSSHKeys)
+	keys.Post("/ssh", s.middleware.Auth.Auth(true), s.handlers.APIKey.HandleAddSSHKey)
+	keys.Delete("/ssh/:id", s.middleware.Auth.Auth(true), s.handlers.APIKey.HandleDeleteSSHKey)
+	keys.Get("/inbound", s.middleware.Auth.Auth(true), s.handlers.APIKey.HandleGetInboundAddress)
+	keys.Post("/inbound", s.middleware.Auth.Auth(true), s.handlers.APIKey.HandleRotateInboundAddress)
+
+	// Listing has to be matched before the redirect route, which would take "list" as an ID
+	s.app.Get("/u/list", s.middleware.Auth.Auth(true), s.handlers.URL.HandleListURLs)
+
+	// URL redirect, preview and password routes - must be before the group to avoid auth middleware
+	passwords := s.middleware.RateLimit.ShortlinkPasswords()
+	s.app.Get("/u/:id", passwords, s.handlers.URL.HandleRedirect)
+	s.app.Get("/u/:id/preview", passwords, s.handlers.URL.HandlePreviewURL)
+	s.app.Get("/u/:id/qr", s.handlers.URL.HandleURLQR)
+	s.app.Get("/u/:id/:key", s.handlers.URL.HandleDeleteURLWithKey)
+	s.app.Get("/u/:id/*", passwords, s.handlers.URL.HandleRedirectPath)
+	s.app.Post("/u/:id", passwords, s.handlers.URL.HandleRedirect)
+	s.app.Post("/u/:id/*", passwords, s.handlers.URL.HandleRedirectPath)
+	s.app.Delete("/u/:id/:key", s.handlers.URL.HandleDeleteURLWithKey)
+
+	// Shortening works without an API key where the instance allows it
+	s.app.Post("/u", s.middleware.Auth.Auth(false), s.middleware.RateLimit.AnonymousShortlinks(), s.handlers.URL.HandleURLShorten)
 
 	// URL management routes
 	urls := s.app.Group("/u")
 	urls.Use(s.middleware.Auth.Auth(true))
-	urls.Post("/", s.handlers.URL.HandleURLShorten)
-	urls.Get("/list", s.handlers.URL.HandleListURLs)
+	urls.Post("/batch", s.handlers.URL.HandleBatchShorten)
 	urls.Get("/:id/stats", s.handlers.URL.HandleURLStats)
+	urls.Get("/:id/history", s.handlers.URL.HandleURLHistory)
+	urls.Patch("/:id", s.handlers.URL.HandleUpdateURL)
+	urls.Post("/:id/rollback", s.handlers.URL.HandleRollbackURL)
 	urls.Delete("/:id", s.handlers.URL.HandleDeleteURL)
 	urls.Put("/:id/expiry", s.handlers.URL.HandleUpdateURLExpiration)
 
@@ -179,11 +215,37 @@ func (s *Server) SetupRoutes() {
 	pastes := s.app.Group("/p")
 	pastes.Post("/", s.middleware.Auth.Auth(false), s.handlers.Paste.HandleUpload)
 	pastes.Get("/list", s.middleware.Auth.Auth(true), s.handlers.Paste.HandleListPastes)
+	pastes.Get("/search", s.middleware.Auth.Auth(true), s.handlers.Paste.HandleSearchPastes)
+	pastes.Post("/batch", s.middleware.Auth.Auth(false), s.handlers.Paste.HandleBatchUpload)
+	pastes.Delete("/batch", s.middleware.Auth.Auth(true), s.handlers.Paste.HandleBatchDelete)
+	pastes.Post("/:id/fork", s.middleware.Auth.Auth(false), s.handlers.Paste.HandleFork)
+	pastes.Patch("/:id", s.middleware.Auth.Auth(true), s.handlers.Paste.HandleUpdatePaste)
 	pastes.Delete("/:id", s.middleware.Auth.Auth(false), s.handlers.Paste.HandleDeletePaste)
 	pastes.Put("/:id/expiry", s.middleware.Auth.Auth(true), s.handlers.Paste.HandleUpdateExpiration)
 
+	// Raw uploads - `curl -T file.log host/` sends PUT /file.log
+	s.app.Put("/", s.middleware.Auth.Auth(false), s.handlers.Paste.HandleRawUpload)
+	s.app.Put("/:filename", s.middleware.Auth.Auth(false), s.handlers.Paste.HandleRawUpload)
+	pastes.Put("/:filename", s.middleware.Auth.Auth(false), s.handlers.Paste.HandleRawUpload)
+
+	// Resumable (tus) uploads - registered before the public routes, which also answer HEAD
+	pastes.Options("/tus", s.middleware.Auth.Auth(false), s.handlers.Paste.HandleTusOptions)
+	pastes.Post("/tus", s.middleware.Auth.Auth(false), s.handlers.Paste.HandleTusCreate)
+	pastes.Head("/tus/:id", s.handlers.Paste.HandleTusHead)
+	pastes.Patch("/tus/:id", s.handlers.Paste.HandleTusPatch)
+	pastes.Delete("/tus/:id", s.handlers.Paste.HandleTusDelete)
+
+	// Collection files get their own prefix so names like "raw" or "download.zip"
+	// can't be shadowed by the paste routes below
+	s.app.Get("/p/:id/files/*", s.handlers.Paste.HandleCollectionFile)
+
 	// Public paste routes - extension routes first (more specific)
 	s.app.Get("/p/:id.:ext", func(c *fiber.Ctx) error {
+		// Fiber lets :id.:ext span slashes here, so leave nested paths like
+		// /p/:id/main.go or /p/:id.zip/archive to the routes below
+		if strings.Contains(c.Params("id")+c.Params("ext"), "/") {
+			return c.Next()
+		}
 		c.Locals("extension", c.Params("ext"))
 		return s.handlers.Paste.HandleView(c)
 	})
@@ -199,13 +261,22 @@ func (s *Server) SetupRoutes() {
 		c.Locals("extension", c.Params("ext"))
 		return s.handlers.Paste.HandleGetPasteImage(c)
 	})
+	s.app.Get("/p/:id.:ext/qr", func(c *fiber.Ctx) error {
+		c.Locals("extension", c.Params("ext"))
+		return s.handlers.Paste.HandleGetPasteQR(c)
+	})
 
 	// Non-extension paste routes last (more general)
 	s.app.Get("/p/:id", s.handlers.Paste.HandleView)
 	s.app.Get("/p/:id/raw", s.handlers.Paste.HandleRawView)
 	s.app.Get("/p/:id/download", s.handlers.Paste.HandleDownload)
 	s.app.Get("/p/:id/image", s.handlers.Paste.HandleGetPasteImage)
+	s.app.Get("/p/:id/qr", s.handlers.Paste.HandleGetPasteQR)
 	s.app.Get("/p/:id/preview", s.handlers.Paste.HandlePreview)
+	s.app.Get("/p/:id/fork", s.handlers.Paste.HandleForkForm)
+	s.app.Get("/p/:id/archive", s.handlers.Paste.HandleArchive)
+	s.app.Get("/p/:id/archive/view/*", s.handlers.Paste.HandleArchiveView)
+	s.app.Get("/p/:id/archive/raw/*", s.handlers.Paste.HandleArchiveRaw)
 	s.app.Delete("/p/:id/:key", s.handlers.Paste.HandleDeleteWithKey)
 	s.app.Get("/p/:id/:key", s.handlers.Paste.HandleDeleteWithKey)
 }
@@ -234,9 +305,64 @@ func (s *Server) Start(addr string) error {
 		}
 	}
 
+	// Reload the URL blocklists when their files change
+	if s.config.Server.Shortlinks.Reputation.Enabled {
+		s.services.Reputation.Watch()
+	} else if s.config.Server.Shortlinks.Anonymous.Enabled {
+		s.logger.Warn("anonymous shortlinks need URL reputation checks and stay disabled until they're enabled")
+	}
+
+	// Start checking shortlink targets for broken links
+	if s.config.Server.Shortlinks.LinkCheck.Enabled {
+		s.services.LinkCheck.StartScheduler()
+	}
+
 	// Setup routes
 	s.SetupRoutes()
 
+	// Start the raw TCP paste listener next to the HTTP server
+	if s.config.Server.TCP.Enabled {
+		s.tcp = netcat.NewListener(s.logger, s.config, s.services.Paste, s.middleware.RateLimit)
+		if err := s.tcp.Listen(); err != nil {
+			return fmt.Errorf("failed to start tcp listener: %w", err)
+		}
+		go func() {
+			if err := s.tcp.Serve(); err != nil {
+				s.logger.Error("tcp listener stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	// Start the SSH server next to the HTTP server
+	if s.config.Server.SSH.Enabled {
+		sshServer, err := sshd.NewServer(s.logger, s.config, s.services, s.middleware.RateLimit)
+		if err != nil {
+			return fmt.Errorf("failed to create ssh server: %w", err)
+		}
+		if err := sshServer.Listen(); err != nil {
+			return fmt.Errorf("failed to start ssh server: %w", err)
+		}
+		s.ssh = sshServer
+		go func() {
+			if err := s.ssh.Serve(); err != nil {
+				s.logger.Error("ssh server stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	// Start the inbound SMTP server next to the HTTP server
+	if s.config.SMTP.Inbound.Enabled {
+		s.smtp = smtpd.NewServer(s.logger, s.config, s.services.Inbound, s.middleware.RateLimit)
+		if err := s.smtp.Listen(); err != nil {
+			return fmt.Errorf("failed to start smtp server: %w", err)
+		}
+		go func() {
+			if err := s.smtp.Serve(); err != nil {
+				s.logger.Error("smtp server stopped", zap.Error(err))
+			}
+		}()
+	}
+
 	// Start server
 	return s.app.Listen(addr)
 }
@@ -274,6 +400,21 @@ func (s *Server) GetMiddleware() *middleware.Middleware {
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.tcp != nil {
+		if err := s.tcp.Shutdown(ctx); err != nil {
+			s.logger.Error("failed to shutdown tcp listener", zap.Error(err))
+		}
+	}
+	if s.ssh != nil {
+		if err := s.ssh.Shutdown(ctx); err != nil {
+			s.logger.Error("failed to shutdown ssh server", zap.Error(err))
+		}
+	}
+	if s.smtp != nil {
+		if err := s.smtp.Shutdown(ctx); err != nil {
+			s.logger.Error("failed to shutdown smtp server", zap.Error(err))
+		}
+	}
 	return s.app.ShutdownWithContext(ctx)
 }
 
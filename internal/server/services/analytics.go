@@ -1,6 +1,7 @@
 package services
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -118,13 +119,17 @@ func (s *AnalyticsService) GetResourceStats(resourceType string, resourceID stri
 
 // LogEvent creates a new analytics event with common request information
 func (s *AnalyticsService) LogEvent(c *fiber.Ctx, eventType models.EventType, resourceType string, resourceID string) error {
+	return s.logEvent(c, eventType, resourceType, resourceID, nil)
+}
+
+func (s *AnalyticsService) logEvent(c *fiber.Ctx, eventType models.EventType, resourceType string, resourceID string, metadata models.JSON) error {
 	// Get request information
 	userAgent := c.Get("User-Agent")
 	ipAddress := c.IP()
 	refererURL := c.Get("Referer")
 
 	// Create event with request context
-	return models.CreateEvent(s.db, eventType, resourceType, resourceID, userAgent, ipAddress, refererURL)
+	return models.CreateEvent(s.db, eventType, resourceType, resourceID, userAgent, ipAddress, refererURL, metadata)
 }
 
 // LogPasteView creates an analytics event for paste views
@@ -132,9 +137,52 @@ func (s *AnalyticsService) LogPasteView(c *fiber.Ctx, pasteID string) error {
 	return s.LogEvent(c, models.EventPasteView, "paste", pasteID)
 }
 
-// LogShortlinkClick creates an analytics event for shortlink clicks
-func (s *AnalyticsService) LogShortlinkClick(c *fiber.Ctx, shortlinkID string) error {
-	return s.LogEvent(c, models.EventShortlinkClick, "shortlink", shortlinkID)
+// LogShortlinkClick creates an analytics event for shortlink clicks, recording the split
+// test variant the visitor was sent to, if any
+func (s *AnalyticsService) LogShortlinkClick(c *fiber.Ctx, shortlinkID string, variant string) error {
+	var metadata models.JSON
+	if variant != "" {
+		data, err := json.Marshal(fiber.Map{"variant": variant})
+		if err != nil {
+			return err
+		}
+		metadata = data
+	}
+	return s.logEvent(c, models.EventShortlinkClick, "shortlink", shortlinkID, metadata)
+}
+
+// GetVariantClicks counts the clicks on a shortlink per split test variant
+func (s *AnalyticsService) GetVariantClicks(shortlinkID string, timeframe AnalyticsTimeframe) (map[string]int64, error) {
+	variant := "json_extract(metadata, '$.variant')"
+	if s.db.Dialector.Name() == "postgres" {
+		variant = "metadata->>'variant'"
+	}
+
+	query := s.db.Model(&models.AnalyticsEvent{}).
+		Select(variant+" AS variant, COUNT(*) AS count").
+		Where("event_type = ? AND resource_type = ? AND resource_id = ?", models.EventShortlinkClick, "shortlink", shortlinkID).
+		Where(variant + " IS NOT NULL").
+		Group(variant)
+	if timeframe.StartTime != nil {
+		query = query.Where("created_at >= ?", timeframe.StartTime)
+	}
+	if timeframe.EndTime != nil {
+		query = query.Where("created_at <= ?", timeframe.EndTime)
+	}
+
+	var rows []struct {
+		Variant string
+		Count   int64
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	clicks := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		clicks[row.Variant] = row.Count
+	}
+	return clicks, nil
 }
 
 // GetStatsHistory generates usage statistics for the specified number of days
@@ -3,6 +3,7 @@ package services
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -131,6 +132,18 @@ func (s *APIKeyService) IsEnabled() bool {
 	return s.config.SMTP.Enabled && s.HasMailer()
 }
 
+// FindVerifiedKey looks up a verified API key, returning nil if there is none
+func (s *APIKeyService) FindVerifiedKey(key string) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	if err := s.db.Where("key = ? AND verified = ?", key, true).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
 // Helper functions
 
 func (s *APIKeyService) sendVerificationEmail(email, token string) error {
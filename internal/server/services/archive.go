@@ -0,0 +1,556 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Fallback limits used when the archive section of the config is left empty
+const (
+	defaultArchiveMaxEntries   = 10000
+	defaultArchiveMaxEntrySize = 10 * 1024 * 1024
+	defaultArchiveMaxTotalSize = 100 * 1024 * 1024
+	defaultArchiveMaxRatio     = 100
+)
+
+// Archive formats that can be browsed
+const (
+	archiveZip   = "zip"
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+)
+
+var errArchiveTooLarge = fiber.NewError(fiber.StatusRequestEntityTooLarge, "Archive exceeds the decompression limit")
+
+type ArchiveService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	config *config.Config
+	paste  *PasteService
+}
+
+func NewArchiveService(db *gorm.DB, logger *zap.Logger, config *config.Config, paste *PasteService) *ArchiveService {
+	return &ArchiveService{
+		db:     db,
+		logger: logger,
+		config: config,
+		paste:  paste,
+	}
+}
+
+// archiveEntry holds the metadata of a single entry read from an archive
+type archiveEntry struct {
+	path       string
+	size       int64
+	compressed int64
+	isDir      bool
+	modified   time.Time
+}
+
+// entryReader streams a single archive entry and releases the stored blob when closed
+type entryReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *entryReader) Close() error {
+	var err error
+	for _, closer := range r.closers {
+		if cerr := closer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// inflateLimitReader fails once more than limit bytes have been decompressed
+type inflateLimitReader struct {
+	r     io.Reader
+	read  int64
+	limit int64
+}
+
+func (l *inflateLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n, errArchiveTooLarge
+	}
+	return n, err
+}
+
+// archiveFormat returns the browsable archive format for a mime type, or an empty
+// string if pastes of that type cannot be browsed
+func archiveFormat(mimeType string) string {
+	mtype := mimetype.Lookup(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	for ; mtype != nil; mtype = mtype.Parent() {
+		switch {
+		case mtype.Is("application/zip"):
+			return archiveZip
+		case mtype.Is("application/x-tar"):
+			return archiveTar
+		case mtype.Is("application/gzip"):
+			return archiveTarGz
+		}
+	}
+	return ""
+}
+
+// limits returns the configured archive limits, falling back to the defaults for unset values
+func (s *ArchiveService) limits() config.ArchiveConfig {
+	limits := s.config.Server.Archive
+	if limits.MaxEntries <= 0 {
+		limits.MaxEntries = defaultArchiveMaxEntries
+	}
+	if limits.MaxEntrySize <= 0 {
+		limits.MaxEntrySize = defaultArchiveMaxEntrySize
+	}
+	if limits.MaxTotalSize <= 0 {
+		limits.MaxTotalSize = defaultArchiveMaxTotalSize
+	}
+	if limits.MaxRatio <= 0 {
+		limits.MaxRatio = defaultArchiveMaxRatio
+	}
+	return limits
+}
+
+// RenderTree renders the file tree of an archive paste
+func (s *ArchiveService) RenderTree(c *fiber.Ctx, paste *models.Paste) error {
+	entries, truncated, err := s.listEntries(paste)
+	if err != nil {
+		return err
+	}
+
+	var totalSize int64
+	var fileCount int
+	for _, entry := range entries {
+		if !entry.isDir {
+			totalSize += entry.size
+			fileCount++
+		}
+	}
+
+	rows := make([]fiber.Map, 0, len(entries))
+	for _, entry := range withParentDirs(entries) {
+		depth := strings.Count(entry.path, "/")
+		row := fiber.Map{
+			"name":   path.Base(entry.path),
+			"isDir":  entry.isDir,
+			"indent": fmt.Sprintf("%.1frem", float64(depth)*1.5),
+		}
+		if !entry.isDir {
+			row["size"] = formatSize(entry.size)
+			row["viewUrl"] = s.entryURL(paste, "view", entry.path)
+			row["rawUrl"] = s.entryURL(paste, "raw", entry.path)
+		}
+		rows = append(rows, row)
+	}
+
+	return c.Render("archive", fiber.Map{
+		"id":        paste.ID,
+		"filename":  paste.Filename,
+		"format":    archiveFormat(paste.MimeType),
+		"count":     fileCount,
+		"size":      formatSize(totalSize),
+		"entries":   rows,
+		"truncated": truncated,
+		"baseUrl":   s.config.Server.BaseURL,
+	}, "layouts/main")
+}
+
+// RenderListJSON serves the entries of an archive paste as JSON
+func (s *ArchiveService) RenderListJSON(c *fiber.Ctx, paste *models.Paste) error {
+	entries, truncated, err := s.listEntries(paste)
+	if err != nil {
+		return err
+	}
+
+	response := ArchiveResponse{
+		ID:        paste.ID,
+		Format:    archiveFormat(paste.MimeType),
+		Entries:   make([]ArchiveEntryResponse, len(entries)),
+		Truncated: truncated,
+	}
+	for i, entry := range entries {
+		response.Entries[i] = ArchiveEntryResponse{
+			Path:     entry.path,
+			Size:     entry.size,
+			IsDir:    entry.isDir,
+			Modified: entry.modified,
+		}
+		if !entry.isDir {
+			response.Entries[i].URL = s.config.Server.BaseURL + s.entryURL(paste, "view", entry.path)
+			response.Entries[i].RawURL = s.config.Server.BaseURL + s.entryURL(paste, "raw", entry.path)
+		}
+	}
+
+	return c.JSON(response)
+}
+
+// RenderEntry renders a single archive entry with syntax highlighting if applicable
+func (s *ArchiveService) RenderEntry(c *fiber.Ctx, paste *models.Paste, name string) error {
+	entry, reader, err := s.openEntry(paste, name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return s.readError(err)
+	}
+
+	mimeType := mimetype.Detect(content).String()
+	extension := strings.TrimPrefix(path.Ext(entry.path), ".")
+
+	var rendered string
+	if s.paste.isTextContent(mimeType) {
+		rendered, err = s.paste.renderHighlightedText(string(content), extension, mimeType)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.Render("archive_entry", fiber.Map{
+		"id":         paste.ID,
+		"filename":   paste.Filename,
+		"path":       entry.path,
+		"rawUrl":     s.entryURL(paste, "raw", entry.path),
+		"language":   s.paste.getLanguageName(extension, mimeType),
+		"content":    rendered,
+		"isText":     rendered != "",
+		"isImage":    s.paste.isImageContent(mimeType),
+		"size":       formatSize(entry.size),
+		"mimeType":   mimeType,
+		"baseUrl":    s.config.Server.BaseURL,
+		"archiveUrl": fmt.Sprintf("/p/%s/archive", paste.ID),
+	}, "layouts/main")
+}
+
+// RenderEntryRaw streams the raw content of a single archive entry
+func (s *ArchiveService) RenderEntryRaw(c *fiber.Ctx, paste *models.Paste, name string) error {
+	entry, reader, err := s.openEntry(paste, name)
+	if err != nil {
+		return err
+	}
+
+	// Sniff the content type from the start of the entry, then stream the rest
+	head := make([]byte, 3072)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		reader.Close()
+		return s.readError(err)
+	}
+	head = head[:n]
+
+	c.Set("Content-Type", mimetype.Detect(head).String())
+	// Add permanent cache headers since content is immutable
+	c.Set("Cache-Control", "public, max-age=31536000, immutable")
+	c.Set("ETag", paste.ID+"/"+entry.path)
+	return c.SendStream(&entryReader{
+		Reader:  io.MultiReader(bytes.NewReader(head), reader),
+		closers: []io.Closer{reader},
+	}, int(entry.size))
+}
+
+// entryURL builds the site-relative URL of an archive entry
+func (s *ArchiveService) entryURL(paste *models.Paste, kind, entryPath string) string {
+	segments := strings.Split(entryPath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("/p/%s/archive/%s/%s", paste.ID, kind, strings.Join(segments, "/"))
+}
+
+// listEntries reads the entries of an archive paste, sorted by path. The listing is
+// truncated once the configured entry limit is reached.
+func (s *ArchiveService) listEntries(paste *models.Paste) ([]archiveEntry, bool, error) {
+	limits := s.limits()
+	var entries []archiveEntry
+	truncated := false
+
+	switch archiveFormat(paste.MimeType) {
+	case archiveZip:
+		zr, closer, err := s.openZip(paste)
+		if err != nil {
+			return nil, false, err
+		}
+		defer closer.Close()
+
+		for _, f := range zr.File {
+			if len(entries) >= limits.MaxEntries {
+				truncated = true
+				break
+			}
+			name, ok := cleanEntryPath(f.Name)
+			if !ok {
+				continue
+			}
+			entries = append(entries, archiveEntry{
+				path:       name,
+				size:       int64(f.UncompressedSize64),
+				compressed: int64(f.CompressedSize64),
+				isDir:      f.FileInfo().IsDir(),
+				modified:   f.Modified,
+			})
+		}
+	case archiveTar, archiveTarGz:
+		tr, closer, err := s.openTar(paste)
+		if err != nil {
+			return nil, false, err
+		}
+		defer closer.Close()
+
+		for {
+			if len(entries) >= limits.MaxEntries {
+				truncated = true
+				break
+			}
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, false, s.readError(err)
+			}
+			name, ok := cleanEntryPath(header.Name)
+			if !ok || (header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir) {
+				continue
+			}
+			entries = append(entries, archiveEntry{
+				path:     name,
+				size:     header.Size,
+				isDir:    header.Typeflag == tar.TypeDir,
+				modified: header.ModTime,
+			})
+		}
+	default:
+		return nil, false, fiber.NewError(fiber.StatusBadRequest, "Paste is not a browsable archive")
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return treeKey(entries[i].path) < treeKey(entries[j].path)
+	})
+	return entries, truncated, nil
+}
+
+// openEntry finds a file in an archive paste and returns a reader for its content.
+// The caller must close the reader to release the stored blob.
+func (s *ArchiveService) openEntry(paste *models.Paste, name string) (archiveEntry, io.ReadCloser, error) {
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	name, ok := cleanEntryPath(name)
+	if !ok {
+		return archiveEntry{}, nil, fiber.NewError(fiber.StatusNotFound, "Archive entry not found")
+	}
+
+	switch archiveFormat(paste.MimeType) {
+	case archiveZip:
+		zr, closer, err := s.openZip(paste)
+		if err != nil {
+			return archiveEntry{}, nil, err
+		}
+
+		for _, f := range zr.File {
+			if entryName, ok := cleanEntryPath(f.Name); !ok || entryName != name || f.FileInfo().IsDir() {
+				continue
+			}
+
+			entry := archiveEntry{
+				path:       name,
+				size:       int64(f.UncompressedSize64),
+				compressed: int64(f.CompressedSize64),
+				modified:   f.Modified,
+			}
+			if err := s.checkEntry(entry); err != nil {
+				closer.Close()
+				return archiveEntry{}, nil, err
+			}
+
+			rc, err := f.Open()
+			if err != nil {
+				closer.Close()
+				return archiveEntry{}, nil, s.readError(err)
+			}
+			return entry, &entryReader{
+				Reader:  io.LimitReader(rc, entry.size),
+				closers: []io.Closer{rc, closer},
+			}, nil
+		}
+		closer.Close()
+	case archiveTar, archiveTarGz:
+		tr, closer, err := s.openTar(paste)
+		if err != nil {
+			return archiveEntry{}, nil, err
+		}
+
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				closer.Close()
+				return archiveEntry{}, nil, s.readError(err)
+			}
+			if entryName, ok := cleanEntryPath(header.Name); !ok || entryName != name || header.Typeflag != tar.TypeReg {
+				continue
+			}
+
+			entry := archiveEntry{
+				path:     name,
+				size:     header.Size,
+				modified: header.ModTime,
+			}
+			if err := s.checkEntry(entry); err != nil {
+				closer.Close()
+				return archiveEntry{}, nil, err
+			}
+			return entry, &entryReader{
+				Reader:  io.LimitReader(tr, entry.size),
+				closers: []io.Closer{closer},
+			}, nil
+		}
+		closer.Close()
+	default:
+		return archiveEntry{}, nil, fiber.NewError(fiber.StatusBadRequest, "Paste is not a browsable archive")
+	}
+
+	return archiveEntry{}, nil, fiber.NewError(fiber.StatusNotFound, "Archive entry not found")
+}
+
+// checkEntry rejects entries whose declared size or compression ratio exceed the configured limits
+func (s *ArchiveService) checkEntry(entry archiveEntry) error {
+	limits := s.limits()
+	if entry.size > limits.MaxEntrySize {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Archive entry exceeds the size limit")
+	}
+	if entry.compressed > 0 && entry.size/entry.compressed > int64(limits.MaxRatio) {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Archive entry exceeds the compression ratio limit")
+	}
+	return nil
+}
+
+// openZip opens the stored blob of a zip paste. Blobs that support random access are read
+// in place; others are buffered in memory, which is bounded by the upload size limit.
+func (s *ArchiveService) openZip(paste *models.Paste) (*zip.Reader, io.Closer, error) {
+	blob, err := s.paste.storage.Open(paste.StoragePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if file, ok := blob.(interface {
+		io.ReaderAt
+		Stat() (fs.FileInfo, error)
+	}); ok {
+		info, err := file.Stat()
+		if err != nil {
+			blob.Close()
+			return nil, nil, err
+		}
+		zr, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			blob.Close()
+			return nil, nil, s.readError(err)
+		}
+		return zr, blob, nil
+	}
+
+	defer blob.Close()
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return nil, nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, s.readError(err)
+	}
+	return zr, io.NopCloser(nil), nil
+}
+
+// openTar opens the stored blob of a tar paste, decompressing it on the fly if needed.
+// The decompressed stream is capped at the configured total size.
+func (s *ArchiveService) openTar(paste *models.Paste) (*tar.Reader, io.Closer, error) {
+	blob, err := s.paste.storage.Open(paste.StoragePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var r io.Reader = blob
+	if archiveFormat(paste.MimeType) == archiveTarGz {
+		gz, err := gzip.NewReader(blob)
+		if err != nil {
+			blob.Close()
+			return nil, nil, s.readError(err)
+		}
+		r = gz
+	}
+
+	return tar.NewReader(&inflateLimitReader{r: r, limit: s.limits().MaxTotalSize}), blob, nil
+}
+
+// readError converts errors from the archive readers into client errors
+func (s *ArchiveService) readError(err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr
+	}
+	s.logger.Debug("failed to read archive", zap.Error(err))
+	return fiber.NewError(fiber.StatusUnprocessableEntity, "Archive could not be read")
+}
+
+// cleanEntryPath normalizes an archive entry name into a relative slash-separated path.
+// Names that resolve to the archive root are rejected.
+func cleanEntryPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	return name, name != ""
+}
+
+// treeKey sorts paths so that every directory is directly followed by its contents
+func treeKey(p string) string {
+	return strings.ReplaceAll(p, "/", "\x00")
+}
+
+// withParentDirs adds the parent directories that an archive does not list explicitly
+func withParentDirs(entries []archiveEntry) []archiveEntry {
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		seen[entry.path] = true
+	}
+
+	result := entries
+	for _, entry := range entries {
+		for dir := path.Dir(entry.path); dir != "."; dir = path.Dir(dir) {
+			if seen[dir] {
+				break
+			}
+			seen[dir] = true
+			result = append(result, archiveEntry{path: dir, isDir: true})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return treeKey(result[i].path) < treeKey(result[j].path)
+	})
+	return result
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// maxBatchItems bounds the number of items in a single batch request
+const maxBatchItems = 100
+
+// batchTitleFetches bounds how many shortlink titles are fetched concurrently
+const batchTitleFetches = 8
+
+// BatchService creates and deletes several pastes or shortlinks in one request. Items
+// are processed in a single transaction, each in its own savepoint, so one failing
+// item is reported without affecting the others.
+type BatchService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	config *config.Config
+	paste  *PasteService
+	url    *URLService
+}
+
+func NewBatchService(db *gorm.DB, logger *zap.Logger, config *config.Config, paste *PasteService, url *URLService) *BatchService {
+	return &BatchService{
+		db:     db,
+		logger: logger,
+		config: config,
+		paste:  paste,
+		url:    url,
+	}
+}
+
+// batchPaste holds a single paste read from a batch upload
+type batchPaste struct {
+	content []byte
+	opts    *PasteOptions
+}
+
+// UploadPastes creates a paste for every file or item of a multipart or JSON request
+func (s *BatchService) UploadPastes(c *fiber.Ctx) error {
+	items, err := s.parsePasteItems(c)
+	if err != nil {
+		return err
+	}
+	if err := checkBatchSize(len(items)); err != nil {
+		return err
+	}
+
+	var apiKey *models.APIKey
+	if key := c.Locals("apiKey"); key != nil {
+		apiKey = key.(*models.APIKey)
+	}
+
+	results := make([]BatchResult, len(items))
+	var created []*models.Paste
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for i, item := range items {
+			results[i].Index = i
+
+			if len(item.content) == 0 {
+				s.fail(&results[i], fiber.NewError(fiber.StatusBadRequest, "Empty file"))
+				continue
+			}
+			if item.opts.Private && apiKey == nil {
+				s.fail(&results[i], fiber.NewError(fiber.StatusUnauthorized, "Private pastes can only be created with an API key"))
+				continue
+			}
+
+			paste, err := s.paste.createPasteWithDB(tx, bytes.NewReader(item.content), apiKey, int64(len(item.content)), item.opts)
+			if err != nil {
+				s.fail(&results[i], err)
+				continue
+			}
+
+			created = append(created, paste)
+			response := NewPasteResponse(paste, s.config.Server.BaseURL)
+			results[i].Status = fiber.StatusOK
+			results[i].ID = paste.ID
+			results[i].Paste = &response
+		}
+		return nil
+	})
+	if err != nil {
+		// Remove any content that was stored before the transaction failed
+		for _, paste := range created {
+			_ = s.paste.storage.Delete(paste.StoragePath)
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save pastes")
+	}
+
+	return s.respond(c, results)
+}
+
+// DeletePastes deletes several pastes owned by the requesting API key
+func (s *BatchService) DeletePastes(c *fiber.Ctx) error {
+	req := new(BatchDeleteRequest)
+	if err := c.BodyParser(req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := checkBatchSize(len(req.IDs)); err != nil {
+		return err
+	}
+
+	apiKey := c.Locals("apiKey").(*models.APIKey)
+
+	results := make([]BatchResult, len(req.IDs))
+	var deleted []*models.Paste
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range req.IDs {
+			results[i].Index = i
+			results[i].ID = id
+
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				paste, err := s.paste.getPasteWithDB(tx, id)
+				if err != nil {
+					return err
+				}
+				if paste.APIKey == "" || paste.APIKey != apiKey.Key {
+					return fiber.NewError(fiber.StatusUnauthorized, "Not authorized to delete this paste")
+				}
+				if err := tx.Delete(paste).Error; err != nil {
+					return err
+				}
+				deleted = append(deleted, paste)
+				return nil
+			})
+			if err != nil {
+				s.fail(&results[i], err)
+				continue
+			}
+			results[i].Status = fiber.StatusOK
+		}
+		return nil
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete pastes")
+	}
+
+	// Only remove content once the deletions are committed
+	for _, paste := range deleted {
+		if err := s.paste.storage.Delete(paste.StoragePath); err != nil {
+			s.logger.Error("failed to delete paste content", zap.String("id", paste.ID), zap.Error(err))
+		}
+	}
+
+	return s.respond(c, results)
+}
+
+// CreateShortlinks creates a shortlink for every item or URL of the request
+func (s *BatchService) CreateShortlinks(c *fiber.Ctx) error {
+	req := new(BatchShortlinkRequest)
+	if err := c.BodyParser(req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	items := req.Items
+	for _, u := range req.URLs {
+		items = append(items, ShortlinkOptions{URL: u})
+	}
+	if err := checkBatchSize(len(items)); err != nil {
+		return err
+	}
+
+	apiKey := c.Locals("apiKey").(*models.APIKey)
+
+	// Validate the items and fetch page titles up front, so no network work
+	// happens while the transaction is open
+	results := make([]BatchResult, len(items))
+	shortlinks := make([]*models.Shortlink, len(items))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchTitleFetches)
+	for i := range items {
+		results[i].Index = i
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			shortlink, err := s.url.prepareShortlink(apiKey, &items[i])
+			if err != nil {
+				s.fail(&results[i], err)
+				return
+			}
+			shortlinks[i] = shortlink
+		}(i)
+	}
+	wg.Wait()
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for i, shortlink := range shortlinks {
+			if shortlink == nil {
+				continue
+			}
+
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				return s.url.saveShortlink(tx, apiKey, shortlink, items[i].Slug != "")
+			})
+			if err != nil {
+				s.fail(&results[i], err)
+				continue
+			}
+
+			results[i].Status = fiber.StatusOK
+			results[i].ID = shortlink.ID
+			results[i].Shortlink = shortlink.ToResponse(s.config.Server.BaseURL)
+		}
+		return nil
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save shortlinks")
+	}
+
+	return s.respond(c, results)
+}
+
+// Helper functions
+
+// parsePasteItems reads the items of a batch upload. Multipart requests carry one "file"
+// part per paste and an optional "items" field with a JSON array of per-file options.
+func (s *BatchService) parsePasteItems(c *fiber.Ctx) ([]batchPaste, error) {
+	if !strings.Contains(c.Get("Content-Type"), "multipart/form-data") {
+		req := new(BatchPasteRequest)
+		if err := json.Unmarshal(c.Body(), req); err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		items := make([]batchPaste, len(req.Items))
+		for i, item := range req.Items {
+			items[i] = batchPaste{content: []byte(item.Content), opts: item.pasteOptions()}
+		}
+		return items, nil
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid multipart form")
+	}
+
+	files := form.File["file"]
+	var options []BatchPasteItem
+	if values := form.Value["items"]; len(values) > 0 && values[0] != "" {
+		if err := json.Unmarshal([]byte(values[0]), &options); err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid items field")
+		}
+		if len(options) > len(files) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "More items than files")
+		}
+	}
+	if err := checkBatchSize(len(files)); err != nil {
+		return nil, err
+	}
+
+	items := make([]batchPaste, len(files))
+	for i, fh := range files {
+		var item BatchPasteItem
+		if i < len(options) {
+			item = options[i]
+		}
+		if item.Filename == "" && fh.Filename != "-" {
+			item.Filename = fh.Filename
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to open uploaded file")
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to read file content")
+		}
+
+		items[i] = batchPaste{content: content, opts: item.pasteOptions()}
+	}
+	return items, nil
+}
+
+// pasteOptions converts batch item options into paste options
+func (item BatchPasteItem) pasteOptions() *PasteOptions {
+	return &PasteOptions{
+		Filename:  item.Filename,
+		Extension: item.Extension,
+		Private:   item.Private,
+		ExpiresIn: item.ExpiresIn,
+		ExpiresAt: item.ExpiresAt,
+		Slug:      item.Slug,
+
+		Title:       item.Title,
+		Description: item.Description,
+		Tags:        item.Tags,
+	}
+}
+
+// fail records an item error, keeping the message of client errors and hiding internal ones
+func (s *BatchService) fail(result *BatchResult, err error) {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		result.Status = fe.Code
+		result.Error = fe.Message
+		return
+	}
+
+	s.logger.Error("batch item failed", zap.Int("index", result.Index), zap.Error(err))
+	result.Status = fiber.StatusInternalServerError
+	result.Error = "Internal Server Error"
+}
+
+// respond sends the batch results: 200 if every item succeeded, 207 Multi-Status otherwise
+func (s *BatchService) respond(c *fiber.Ctx, results []BatchResult) error {
+	response := BatchResponse{Results: results}
+	for _, result := range results {
+		if result.Error == "" {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+
+	if response.Failed > 0 {
+		c.Status(fiber.StatusMultiStatus)
+	}
+	return c.JSON(response)
+}
+
+func checkBatchSize(n int) error {
+	if n == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "No items provided")
+	}
+	if n > maxBatchItems {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("A batch can hold at most %d items", maxBatchItems))
+	}
+	return nil
+}
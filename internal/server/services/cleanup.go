@@ -9,22 +9,26 @@ import (
 )
 
 type CleanupService struct {
-	db     *gorm.DB
-	logger *zap.Logger
-	config *config.Config
-	paste  *PasteService
-	url    *URLService
-	apiKey *APIKeyService
+	db         *gorm.DB
+	logger     *zap.Logger
+	config     *config.Config
+	paste      *PasteService
+	collection *CollectionService
+	tus        *TusService
+	url        *URLService
+	apiKey     *APIKeyService
 }
 
 func NewCleanupService(db *gorm.DB, logger *zap.Logger, config *config.Config, services *Services) *CleanupService {
 	return &CleanupService{
-		db:     db,
-		logger: logger,
-		config: config,
-		paste:  services.Paste,
-		url:    services.URL,
-		apiKey: services.APIKey,
+		db:         db,
+		logger:     logger,
+		config:     config,
+		paste:      services.Paste,
+		collection: services.Collection,
+		tus:        services.Tus,
+		url:        services.URL,
+		apiKey:     services.APIKey,
 	}
 }
 
@@ -39,6 +43,20 @@ func (s *CleanupService) RunCleanup() {
 		s.logger.Info("cleaned up expired pastes", zap.Int64("count", count))
 	}
 
+	// Cleanup expired collections
+	if count, err := s.collection.CleanupExpired(); err != nil {
+		s.logger.Error("failed to cleanup expired collections", zap.Error(err))
+	} else {
+		s.logger.Info("cleaned up expired collections", zap.Int64("count", count))
+	}
+
+	// Cleanup stale resumable uploads
+	if count, err := s.tus.CleanupExpired(); err != nil {
+		s.logger.Error("failed to cleanup stale uploads", zap.Error(err))
+	} else {
+		s.logger.Info("cleaned up stale uploads", zap.Int64("count", count))
+	}
+
 	// Cleanup expired shortlinks
 	if count, err := s.url.CleanupExpired(); err != nil {
 		s.logger.Error("failed to cleanup expired shortlinks", zap.Error(err))
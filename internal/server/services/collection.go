@@ -0,0 +1,529 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type CollectionService struct {
+	db        *gorm.DB
+	logger    *zap.Logger
+	config    *config.Config
+	paste     *PasteService
+	analytics *AnalyticsService
+}
+
+func NewCollectionService(db *gorm.DB, logger *zap.Logger, config *config.Config, paste *PasteService) *CollectionService {
+	return &CollectionService{
+		db:        db,
+		logger:    logger,
+		config:    config,
+		paste:     paste,
+		analytics: NewAnalyticsService(db, logger, config),
+	}
+}
+
+// collectionFile holds a single file read from a collection upload
+type collectionFile struct {
+	filename  string
+	extension string
+	content   []byte
+}
+
+// IsCollectionUpload reports whether an upload request carries several files and
+// should therefore create a collection instead of a single paste
+func (s *CollectionService) IsCollectionUpload(c *fiber.Ctx) bool {
+	contentType := c.Get("Content-Type")
+
+	if strings.Contains(contentType, "multipart/form-data") {
+		form, err := c.MultipartForm()
+		return err == nil && len(form.File["file"]) > 1
+	}
+
+	if strings.Contains(contentType, "application/json") {
+		body := bytes.TrimSpace(c.Body())
+		if len(body) > 0 && body[0] == '[' {
+			return true
+		}
+
+		var probe struct {
+			Files json.RawMessage `json:"files"`
+		}
+		return json.Unmarshal(body, &probe) == nil && len(probe.Files) > 0
+	}
+
+	return false
+}
+
+// UploadCollection handles the creation of a new collection from a multipart or JSON request
+func (s *CollectionService) UploadCollection(c *fiber.Ctx) error {
+	opts := new(CollectionOptions)
+	var files []collectionFile
+
+	if strings.Contains(c.Get("Content-Type"), "multipart/form-data") {
+		if err := c.BodyParser(opts); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		form, err := c.MultipartForm()
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid multipart form")
+		}
+
+		for _, fh := range form.File["file"] {
+			f, err := fh.Open()
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to open uploaded file")
+			}
+
+			content, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Failed to read file content")
+			}
+
+			files = append(files, collectionFile{filename: fh.Filename, content: content})
+		}
+	} else {
+		body := bytes.TrimSpace(c.Body())
+		if len(body) > 0 && body[0] == '[' {
+			// A bare array of files takes its shared options from the query string
+			if err := json.Unmarshal(body, &opts.Files); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+			}
+			if err := c.QueryParser(opts); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Invalid query parameters")
+			}
+		} else if err := json.Unmarshal(body, opts); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		for _, file := range opts.Files {
+			files = append(files, collectionFile{
+				filename:  file.Filename,
+				extension: file.Extension,
+				content:   []byte(file.Content),
+			})
+		}
+	}
+
+	var apiKey *models.APIKey
+	if key := c.Locals("apiKey"); key != nil {
+		apiKey = key.(*models.APIKey)
+	}
+
+	if opts.Private && apiKey == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Private collections can only be created with an API key")
+	}
+
+	collection, pastes, err := s.createCollection(files, apiKey, opts)
+	if err != nil {
+		return err
+	}
+
+	response := NewCollectionResponse(collection, pastes, s.config.Server.BaseURL)
+
+	// If this is a browser form submission, redirect to the collection view
+	if strings.Contains(c.Get("Accept"), "text/html") {
+		c.Cookie(&fiber.Cookie{
+			Name:     "deletion_url",
+			Value:    response.DeleteURL,
+			Path:     "/",
+			Expires:  time.Now().Add(5 * time.Minute),
+			HTTPOnly: true,
+		})
+		return c.Redirect(response.URL)
+	}
+
+	return c.JSON(response)
+}
+
+// FindCollection retrieves a collection by ID with expiry checking
+func (s *CollectionService) FindCollection(id string) (*models.Collection, error) {
+	// Strip any extension from the ID
+	if idx := strings.LastIndex(id, "."); idx != -1 {
+		id = id[:idx]
+	}
+
+	var collection models.Collection
+	err := s.db.Where("id = ? AND (expires_at IS NULL OR expires_at > ?)", id, time.Now()).First(&collection).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Collection not found or expired")
+		}
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// GetFiles returns the pastes that make up a collection, in upload order
+func (s *CollectionService) GetFiles(collection *models.Collection) ([]models.Paste, error) {
+	var pastes []models.Paste
+	err := s.db.Where("collection_id = ?", collection.ID).
+		Order("created_at ASC").
+		Order("filename ASC").
+		Find(&pastes).Error
+	return pastes, err
+}
+
+// RenderCollection renders the combined view of every file in a collection
+func (s *CollectionService) RenderCollection(c *fiber.Ctx, collection *models.Collection) error {
+	pastes, err := s.GetFiles(collection)
+	if err != nil {
+		return err
+	}
+
+	if err := s.analytics.LogEvent(c, models.EventPasteView, "collection", collection.ID); err != nil {
+		s.logger.Error("failed to log collection view", zap.Error(err))
+	}
+
+	// Check for deletion URL cookie, which is only shown once
+	var deletionUrl string
+	if cookie := c.Cookies("deletion_url"); cookie != "" {
+		c.Cookie(&fiber.Cookie{
+			Name:     "deletion_url",
+			Value:    "",
+			Path:     "/",
+			Expires:  time.Now().Add(-24 * time.Hour),
+			HTTPOnly: true,
+		})
+		deletionUrl = cookie
+	}
+
+	var totalSize int64
+	files := make([]fiber.Map, len(pastes))
+	for i, paste := range pastes {
+		totalSize += paste.Size
+
+		var rendered string
+		if s.paste.isTextContent(paste.MimeType) {
+			content, err := s.paste.storage.Get(paste.StoragePath)
+			if err != nil {
+				return err
+			}
+			rendered, err = s.paste.renderHighlightedText(string(content), paste.Extension, paste.MimeType)
+			if err != nil {
+				return err
+			}
+		}
+
+		files[i] = fiber.Map{
+			"id":       paste.ID,
+			"filename": paste.Filename,
+			"rawUrl":   fmt.Sprintf("/p/%s/files/%s", collection.ID, url.PathEscape(paste.Filename)),
+			"language": s.paste.getLanguageName(paste.Extension, paste.MimeType),
+			"content":  rendered,
+			"isText":   rendered != "",
+			"isImage":  s.paste.isImageContent(paste.MimeType),
+			"size":     formatSize(paste.Size),
+			"mimeType": paste.MimeType,
+		}
+	}
+
+	return c.Render("collection", fiber.Map{
+		"id":          collection.ID,
+		"created":     collection.CreatedAt.Format("2006-01-02 15:04:05"),
+		"expires":     formatExpiryTime(collection.ExpiresAt),
+		"size":        formatSize(totalSize),
+		"count":       len(files),
+		"files":       files,
+		"baseUrl":     s.config.Server.BaseURL,
+		"deletionUrl": deletionUrl,
+	}, "layouts/main")
+}
+
+// RenderCollectionJSON serves the collection metadata as JSON
+func (s *CollectionService) RenderCollectionJSON(c *fiber.Ctx, collection *models.Collection) error {
+	pastes, err := s.GetFiles(collection)
+	if err != nil {
+		return err
+	}
+
+	response := NewCollectionResponse(collection, pastes, s.config.Server.BaseURL)
+	// Never leak the delete key through a public endpoint
+	response.DeleteURL = ""
+	return c.JSON(response)
+}
+
+// RenderCollectionRaw serves a plain text list of raw URLs, one per file in the collection
+func (s *CollectionService) RenderCollectionRaw(c *fiber.Ctx, collection *models.Collection) error {
+	pastes, err := s.GetFiles(collection)
+	if err != nil {
+		return err
+	}
+
+	response := NewCollectionResponse(collection, pastes, s.config.Server.BaseURL)
+
+	var sb strings.Builder
+	for _, file := range response.Files {
+		sb.WriteString(file.RawURL)
+		sb.WriteString("\n")
+	}
+
+	c.Set("Content-Type", "text/plain; charset=utf-8")
+	return c.SendString(sb.String())
+}
+
+// RenderFileRaw serves the raw content of a single file in a collection
+func (s *CollectionService) RenderFileRaw(c *fiber.Ctx, collection *models.Collection, filename string) error {
+	if unescaped, err := url.PathUnescape(filename); err == nil {
+		filename = unescaped
+	}
+
+	var paste models.Paste
+	err := s.db.Where("collection_id = ? AND filename = ?", collection.ID, filename).First(&paste).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fiber.NewError(fiber.StatusNotFound, "File not found in collection")
+		}
+		return err
+	}
+
+	return s.paste.RenderPasteRaw(c, &paste)
+}
+
+// RenderDownload serves every file in the collection as a single zip archive
+func (s *CollectionService) RenderDownload(c *fiber.Ctx, collection *models.Collection) error {
+	pastes, err := s.GetFiles(collection)
+	if err != nil {
+		return err
+	}
+
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, collection.ID))
+	// Add permanent cache headers since content is immutable
+	c.Set("Cache-Control", "public, max-age=31536000, immutable")
+	c.Set("ETag", collection.ID)
+
+	// Stream the archive so large collections are never held in memory. The status
+	// is already sent by then, so a failure can only cut the download short.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := s.writeZip(w, pastes); err != nil {
+			s.logger.Error("failed to stream collection download",
+				zap.String("id", collection.ID),
+				zap.Error(err))
+		}
+	})
+	return nil
+}
+
+// writeZip writes the files of a collection to w as a zip archive
+func (s *CollectionService) writeZip(w io.Writer, pastes []models.Paste) error {
+	zw := zip.NewWriter(w)
+	for _, paste := range pastes {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     paste.Filename,
+			Method:   zip.Deflate,
+			Modified: paste.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		content, err := s.paste.storage.Open(paste.StoragePath)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// DeleteWithKey deletes a collection using its deletion key
+func (s *CollectionService) DeleteWithKey(c *fiber.Ctx, collection *models.Collection) error {
+	key := c.Params("key")
+	if subtle.ConstantTimeCompare([]byte(collection.DeleteKey), []byte(key)) != 1 {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid deletion key")
+	}
+
+	// For DELETE requests, delete the collection
+	if c.Method() == fiber.MethodDelete {
+		if err := s.Delete(collection); err != nil {
+			return err
+		}
+
+		if strings.Contains(c.Get("Accept"), "application/json") {
+			return c.JSON(fiber.Map{
+				"message": "Collection deleted successfully",
+				"id":      collection.ID,
+			})
+		}
+
+		return c.Render("delete_success", fiber.Map{
+			"isDeleteSuccess": true,
+			"baseUrl":         s.config.Server.BaseURL,
+			"kind":            "collection",
+			"title":           "Collection",
+		}, "layouts/main")
+	}
+
+	// For GET requests, show a confirmation page
+	if strings.Contains(c.Get("Accept"), "application/json") {
+		return c.JSON(fiber.Map{
+			"message": "Collection found and will be deleted",
+			"id":      collection.ID,
+		})
+	}
+
+	return c.Render("delete_confirm", fiber.Map{
+		"isDeleteConfirm": true,
+		"baseUrl":         s.config.Server.BaseURL,
+		"kind":            "collection",
+		"title":           "Collection",
+		"deleteUrl":       fmt.Sprintf("%s/p/%s/%s", s.config.Server.BaseURL, collection.ID, key),
+	}, "layouts/main")
+}
+
+// Delete removes a collection together with all of its files
+func (s *CollectionService) Delete(collection *models.Collection) error {
+	pastes, err := s.GetFiles(collection)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, paste := range pastes {
+			if err := s.paste.storage.Delete(paste.StoragePath); err != nil {
+				s.logger.Error("failed to delete collection file content",
+					zap.String("id", paste.ID),
+					zap.Error(err))
+			}
+			if err := tx.Delete(&paste).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(collection).Error
+	})
+}
+
+// CleanupExpired removes expired collections. Their files share the collection's
+// expiry and are removed by the paste cleanup.
+func (s *CollectionService) CleanupExpired() (int64, error) {
+	result := s.db.Where("expires_at < ? AND expires_at IS NOT NULL", time.Now()).Delete(&models.Collection{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// Helper functions
+
+func (s *CollectionService) createCollection(files []collectionFile, apiKey *models.APIKey, opts *CollectionOptions) (*models.Collection, []models.Paste, error) {
+	if len(files) == 0 {
+		return nil, nil, fiber.NewError(fiber.StatusBadRequest, "No files provided")
+	}
+
+	// Validate every file and the combined size before storing anything
+	var totalSize int64
+	seen := make(map[string]bool)
+	for i := range files {
+		file := &files[i]
+		if len(file.content) == 0 {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Empty file")
+		}
+		totalSize += int64(len(file.content))
+
+		file.filename = uniqueFilename(sanitizeFilename(file.filename, i), seen)
+		seen[file.filename] = true
+	}
+
+	if err := s.paste.validateFileSize(totalSize, apiKey); err != nil {
+		return nil, nil, err
+	}
+
+	expiry, err := s.paste.calculateExpiry(ExpiryOptions{
+		Size:      totalSize,
+		HasAPIKey: apiKey != nil,
+		ExpiresIn: opts.ExpiresIn,
+		ExpiresAt: opts.ExpiresAt,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	collection := &models.Collection{
+		Private:   opts.Private,
+		ExpiresAt: expiry,
+	}
+	if apiKey != nil {
+		collection.APIKey = apiKey.Key
+	}
+
+	pastes := make([]models.Paste, 0, len(files))
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := createWithGeneratedID(tx, collection, &collection.ID, s.config.IDs.Collection, models.CollectionIDLength, &models.Paste{}); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to save collection")
+		}
+
+		for _, file := range files {
+			paste, err := s.paste.createPasteWithDB(tx, bytes.NewReader(file.content), apiKey, int64(len(file.content)), &PasteOptions{
+				Filename:     file.filename,
+				Extension:    file.extension,
+				Private:      opts.Private,
+				ExpiresAt:    expiry,
+				CollectionID: collection.ID,
+			})
+			if err != nil {
+				return err
+			}
+			pastes = append(pastes, *paste)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		// Remove any content that was stored before the transaction failed
+		for _, paste := range pastes {
+			_ = s.paste.storage.Delete(paste.StoragePath)
+		}
+		return nil, nil, err
+	}
+
+	return collection, pastes, nil
+}
+
+// sanitizeFilename strips any directory components from a collection filename and
+// falls back to a numbered name when none is given
+func sanitizeFilename(name string, index int) string {
+	name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	if name == "" || name == "." || name == "/" || name == "-" {
+		return fmt.Sprintf("file%d.txt", index+1)
+	}
+	return name
+}
+
+// uniqueFilename appends a counter to name until it no longer clashes with a taken name
+func uniqueFilename(name string, taken map[string]bool) string {
+	if !taken[name] {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
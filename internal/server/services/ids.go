@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/utils"
+	"gorm.io/gorm"
+)
+
+// resolveSlug validates a requested custom slug, namespaces it with the API key's
+// prefix and makes sure none of the given models already uses it as an ID
+func resolveSlug(db *gorm.DB, apiKey *models.APIKey, slug string, taken ...any) (string, error) {
+	if apiKey == nil {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "Custom slugs can only be requested with an API key")
+	}
+
+	if err := utils.ValidateSlug(slug); err != nil {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Invalid slug: "+err.Error())
+	}
+
+	id := utils.ApplySlugPrefix(apiKey.ShortlinkPrefix, slug)
+	if err := utils.ValidateSlug(id); err != nil {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Invalid slug: "+err.Error())
+	}
+
+	inUse, err := idTaken(db, id, taken...)
+	if err != nil {
+		return "", err
+	}
+	if inUse {
+		return "", slugTakenError(id)
+	}
+
+	return id, nil
+}
+
+// idTaken reports whether any of the given models already uses id as an ID
+func idTaken(db *gorm.DB, id string, taken ...any) (bool, error) {
+	for _, model := range taken {
+		// Soft-deleted records still hold their primary key, so include them
+		var count int64
+		if err := db.Unscoped().Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// slugTakenError is returned when a requested slug is already in use
+func slugTakenError(id string) error {
+	return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Slug %q is already taken", id))
+}
+
+// maxIDAttempts bounds how often a colliding generated ID is replaced before giving up
+const maxIDAttempts = 5
+
+// createWithGeneratedID inserts a record, generating its ID from the given settings unless
+// one is already set. A generated ID that collides with an existing record, or with one
+// of the taken models sharing its URLs, is replaced and the insert retried; preset IDs
+// such as custom slugs are inserted once.
+func createWithGeneratedID(db *gorm.DB, record any, id *string, cfg config.IDConfig, defaultLength int, taken ...any) error {
+	if *id != "" {
+		return db.Create(record).Error
+	}
+
+	for attempt := 0; attempt < maxIDAttempts; attempt++ {
+		generated, err := utils.GenerateConfiguredID(cfg, defaultLength)
+		if err != nil {
+			return err
+		}
+		*id = generated
+
+		inUse, err := idTaken(db, *id, taken...)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			continue
+		}
+
+		// Each attempt runs in its own (nested) transaction so a failed insert
+		// does not abort a transaction the caller may have open
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return tx.Create(record).Error
+		})
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+	}
+
+	return gorm.ErrDuplicatedKey
+}
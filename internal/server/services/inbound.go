@@ -0,0 +1,332 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/mailer"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Inbound tokens are lowercase since mail systems don't reliably preserve case in local parts
+const (
+	inboundTokenLength   = 24
+	inboundTokenAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// maxInboundPastes bounds how many attachments of a single email become pastes
+const maxInboundPastes = 20
+
+// maxMIMEDepth bounds how deeply nested multipart bodies are walked
+const maxMIMEDepth = 5
+
+// InboundService turns emails sent to an API key's inbound address into pastes
+type InboundService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	config *config.Config
+	paste  *PasteService
+	mailer *mailer.Mailer
+}
+
+func NewInboundService(db *gorm.DB, logger *zap.Logger, config *config.Config, paste *PasteService) *InboundService {
+	m, err := mailer.New(config)
+	if err != nil {
+		logger.Error("failed to initialize mailer", zap.Error(err))
+	}
+
+	return &InboundService{
+		db:     db,
+		logger: logger,
+		config: config,
+		paste:  paste,
+		mailer: m,
+	}
+}
+
+// GetAddress returns the inbound address of the requesting API key, creating it on first use
+func (s *InboundService) GetAddress(c *fiber.Ctx) error {
+	apiKey := c.Locals("apiKey").(*models.APIKey)
+	if apiKey.InboundToken == "" {
+		if err := s.setToken(apiKey); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(fiber.Map{"address": s.Address(apiKey)})
+}
+
+// RotateAddress replaces the inbound address of the requesting API key
+func (s *InboundService) RotateAddress(c *fiber.Ctx) error {
+	apiKey := c.Locals("apiKey").(*models.APIKey)
+	if err := s.setToken(apiKey); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"address": s.Address(apiKey)})
+}
+
+// Address returns the email address that creates pastes for an API key
+func (s *InboundService) Address(apiKey *models.APIKey) string {
+	return apiKey.InboundToken + "@" + s.Domain()
+}
+
+// Domain returns the mail domain inbound addresses are issued under
+func (s *InboundService) Domain() string {
+	if s.config.SMTP.Inbound.Domain != "" {
+		return s.config.SMTP.Inbound.Domain
+	}
+	if u, err := url.Parse(s.config.Server.BaseURL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "localhost"
+}
+
+// FindKeyByAddress returns the verified API key a recipient address belongs to, or nil
+func (s *InboundService) FindKeyByAddress(address string) (*models.APIKey, error) {
+	local, _, found := strings.Cut(address, "@")
+	if !found || len(local) != inboundTokenLength {
+		return nil, nil
+	}
+
+	var apiKey models.APIKey
+	err := s.db.Where("inbound_token = ? AND verified = ?", strings.ToLower(local), true).First(&apiKey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// Receive creates pastes from a raw RFC 5322 message. Every attachment becomes a paste,
+// or the message body does when there are none. The sender is told the paste URLs by
+// email if outgoing mail is configured.
+func (s *InboundService) Receive(apiKey *models.APIKey, envelopeFrom string, data []byte) ([]*models.Paste, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Malformed message")
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	parts, err := collectMailParts(textproto.MIMEHeader(msg.Header), msg.Body, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	files := selectMailFiles(parts)
+	if len(files) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Message has no content")
+	}
+	if len(files) > maxInboundPastes {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Message has more than %d attachments", maxInboundPastes))
+	}
+
+	pastes := make([]*models.Paste, 0, len(files))
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, file := range files {
+			paste, err := s.paste.createPasteWithDB(tx, bytes.NewReader(file.content), apiKey, int64(len(file.content)), &PasteOptions{
+				Filename: file.filename,
+			})
+			if err != nil {
+				return err
+			}
+			pastes = append(pastes, paste)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.reply(msg.Header, envelopeFrom, subject, pastes)
+	return pastes, nil
+}
+
+// Helper functions
+
+func (s *InboundService) setToken(apiKey *models.APIKey) error {
+	token, err := utils.GenerateConfiguredID(config.IDConfig{
+		Length:   inboundTokenLength,
+		Alphabet: inboundTokenAlphabet,
+	}, inboundTokenLength)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to generate inbound address")
+	}
+
+	if err := s.db.Model(apiKey).Update("inbound_token", token).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save inbound address")
+	}
+	apiKey.InboundToken = token
+	return nil
+}
+
+// reply sends the paste URLs to the sender in the background
+func (s *InboundService) reply(header mail.Header, envelopeFrom, subject string, pastes []*models.Paste) {
+	if !s.config.SMTP.Enabled || s.mailer == nil {
+		return
+	}
+
+	// Never answer bounces or auto-replies, which could start a mail loop
+	if envelopeFrom == "" {
+		return
+	}
+	if auto := header.Get("Auto-Submitted"); auto != "" && !strings.EqualFold(auto, "no") {
+		return
+	}
+
+	to := envelopeFrom
+	for _, field := range []string{"Reply-To", "From"} {
+		if addr, err := mail.ParseAddress(header.Get(field)); err == nil {
+			to = addr.Address
+			break
+		}
+	}
+	if to == "" {
+		return
+	}
+
+	links := make([]mailer.PasteLink, len(pastes))
+	for i, paste := range pastes {
+		links[i] = mailer.PasteLink{Filename: paste.Filename, URL: s.paste.PasteURL(paste)}
+	}
+
+	go func() {
+		if err := s.mailer.SendPasteLinks(to, subject, links); err != nil {
+			s.logger.Error("failed to send inbound paste links", zap.String("to", to), zap.Error(err))
+		}
+	}()
+}
+
+// mailPart is a leaf of a MIME message
+type mailPart struct {
+	mediaType  string
+	filename   string
+	attachment bool
+	content    []byte
+}
+
+// collectMailParts walks a MIME entity and returns its decoded leaf parts
+func collectMailParts(header textproto.MIMEHeader, body io.Reader, depth int) ([]mailPart, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxMIMEDepth {
+			return nil, nil
+		}
+
+		var parts []mailPart
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fiber.NewError(fiber.StatusBadRequest, "Malformed multipart message")
+			}
+
+			children, err := collectMailParts(part.Header, part, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, children...)
+		}
+		return parts, nil
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Failed to decode message part")
+	}
+
+	part := mailPart{mediaType: mediaType, content: content}
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	part.filename = dispParams["filename"]
+	if part.filename == "" {
+		part.filename = params["name"]
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(part.filename); err == nil {
+		part.filename = decoded
+	}
+	part.filename = filepath.Base(filepath.Clean("/" + part.filename))
+	if part.filename == "/" || part.filename == "." {
+		part.filename = ""
+	}
+	part.attachment = disposition == "attachment" || part.filename != ""
+
+	return []mailPart{part}, nil
+}
+
+// selectMailFiles picks the parts that become pastes: all attachments, or the
+// message body if there are none, preferring plain text over HTML
+func selectMailFiles(parts []mailPart) []mailPart {
+	var files []mailPart
+	for _, part := range parts {
+		if part.attachment && len(part.content) > 0 {
+			files = append(files, part)
+		}
+	}
+	if len(files) > 0 {
+		return files
+	}
+
+	for _, mediaType := range []string{"text/plain", "text/html"} {
+		for _, part := range parts {
+			if part.mediaType == mediaType && len(bytes.TrimSpace(part.content)) > 0 {
+				part.filename = "message." + map[string]string{"text/plain": "txt", "text/html": "html"}[mediaType]
+				return []mailPart{part}
+			}
+		}
+	}
+	return nil
+}
+
+// newlineStripper drops line breaks so base64 bodies wrapped at 76 columns decode
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	kept := 0
+	for _, b := range p[:count] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/mailer"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// linkCheckTick is how often the link checker looks for targets that are due
+const linkCheckTick = time.Minute
+
+// linkCheckBatch bounds how many targets a single run checks
+const linkCheckBatch = 500
+
+// Defaults used when the link check section of the config is left empty
+const (
+	defaultLinkCheckInterval = 24 * time.Hour
+	defaultLinkCheckWorkers  = 4
+)
+
+// A failing target is retried after linkCheckRetryDelay, doubling with every failure,
+// until it counts as broken. From then on it's checked less and less often, but at
+// least every maxLinkCheckBackoff.
+const (
+	linkCheckRetryDelay = 15 * time.Minute
+	maxLinkCheckBackoff = 30 * 24 * time.Hour
+)
+
+// LinkCheckService periodically requests the targets of shortlinks and flags the ones
+// that stopped working
+type LinkCheckService struct {
+	db      *gorm.DB
+	logger  *zap.Logger
+	config  *config.Config
+	fetcher *utils.Fetcher
+	mailer  *mailer.Mailer
+}
+
+func NewLinkCheckService(db *gorm.DB, logger *zap.Logger, config *config.Config) *LinkCheckService {
+	m, err := mailer.New(config)
+	if err != nil {
+		logger.Error("failed to initialize mailer", zap.Error(err))
+	}
+
+	return &LinkCheckService{
+		db:      db,
+		logger:  logger,
+		config:  config,
+		fetcher: utils.NewFetcher(config.Server.Fetch),
+		mailer:  m,
+	}
+}
+
+// RunChecks checks the shortlink targets that are due, at most linkCheckBatch of them,
+// and returns how many were checked
+func (s *LinkCheckService) RunChecks() (int, error) {
+	now := time.Now()
+
+	var shortlinks []models.Shortlink
+	err := s.db.
+		Where("next_check_at IS NULL OR next_check_at <= ?", now).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		// Unchecked targets first; Postgres would sort the NULLs last
+		Order("next_check_at IS NOT NULL, next_check_at").
+		Limit(linkCheckBatch).
+		Find(&shortlinks).Error
+	if err != nil {
+		return 0, err
+	}
+
+	workers := s.config.Server.Shortlinks.LinkCheck.Concurrency
+	if workers <= 0 {
+		workers = defaultLinkCheckWorkers
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i := range shortlinks {
+		wg.Add(1)
+		go func(shortlink *models.Shortlink) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			s.check(shortlink)
+		}(&shortlinks[i])
+	}
+	wg.Wait()
+
+	return len(shortlinks), nil
+}
+
+// StartScheduler starts checking targets in the background
+func (s *LinkCheckService) StartScheduler() {
+	go func() {
+		ticker := time.NewTicker(linkCheckTick)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if count, err := s.RunChecks(); err != nil {
+				s.logger.Error("failed to check shortlink targets", zap.Error(err))
+			} else if count > 0 {
+				s.logger.Info("checked shortlink targets", zap.Int("count", count))
+			}
+		}
+	}()
+
+	s.logger.Info("link checker started", zap.Duration("interval", s.interval()))
+}
+
+// check requests the target of a shortlink and records the outcome
+func (s *LinkCheckService) check(shortlink *models.Shortlink) {
+	check := models.LinkCheck{CheckedAt: time.Now()}
+	status, err := s.fetcher.Check(context.Background(), shortlink.TargetURL)
+	check.Status = status
+
+	failures := 0
+	broken := false
+	switch {
+	case errors.Is(err, utils.ErrFetchBlocked):
+		// Targets the fetcher refuses to request, like intranet hosts, can't be
+		// checked from here. Saying nothing about them beats calling them broken.
+		check.Skipped = err.Error()
+		failures = shortlink.CheckFailures
+		broken = shortlink.Broken
+	case err != nil:
+		check.Error = err.Error()
+		fallthrough
+	case !check.OK():
+		failures = shortlink.CheckFailures + 1
+		broken = failures >= s.threshold()
+	}
+	next := check.CheckedAt.Add(s.backoff(failures))
+
+	// An edit of the target while it was being checked resets its history, so
+	// the outcome is only saved if the target is still the same
+	result := s.db.Model(&models.Shortlink{}).
+		Where("id = ? AND target_url = ?", shortlink.ID, shortlink.TargetURL).
+		UpdateColumns(map[string]any{
+			"checks":         shortlink.Checks.Add(check),
+			"check_failures": failures,
+			"broken":         broken,
+			"next_check_at":  next,
+		})
+	if result.Error != nil {
+		s.logger.Error("failed to save link check", zap.String("id", shortlink.ID), zap.Error(result.Error))
+		return
+	}
+
+	if broken && !shortlink.Broken && result.RowsAffected > 0 {
+		s.logger.Info("shortlink target is broken", zap.String("id", shortlink.ID), zap.Int("status", check.Status), zap.String("error", check.Error))
+		s.notify(shortlink, check)
+	}
+}
+
+// backoff returns how long to wait before checking a target again after the given
+// number of failed checks in a row
+func (s *LinkCheckService) backoff(failures int) time.Duration {
+	interval := s.interval()
+	threshold := s.threshold()
+
+	if failures == 0 {
+		return interval
+	}
+	if failures < threshold {
+		return min(linkCheckRetryDelay<<(failures-1), interval)
+	}
+
+	delay := interval
+	for range failures - threshold {
+		delay *= 2
+		if delay >= maxLinkCheckBackoff {
+			break
+		}
+	}
+	return min(delay, maxLinkCheckBackoff)
+}
+
+// notify emails the owner of a shortlink whose target just broke, if the owner has a
+// verified address and outgoing mail is set up
+func (s *LinkCheckService) notify(shortlink *models.Shortlink, check models.LinkCheck) {
+	if !s.config.Server.Shortlinks.LinkCheck.Notify || !s.config.SMTP.Enabled || s.mailer == nil {
+		return
+	}
+
+	var apiKey models.APIKey
+	err := s.db.Where("key = ? AND verified = ?", shortlink.APIKey, true).First(&apiKey).Error
+	if err != nil || apiKey.Email == "" {
+		return
+	}
+
+	err = s.mailer.SendBrokenLink(apiKey.Email, mailer.BrokenLink{
+		Title:     shortlink.Title,
+		ShortURL:  strings.TrimSuffix(s.config.Server.BaseURL, "/") + "/u/" + shortlink.ID,
+		TargetURL: shortlink.TargetURL,
+		Status:    check.Status,
+		Error:     check.Error,
+	})
+	if err != nil {
+		s.logger.Error("failed to send broken link notification", zap.String("id", shortlink.ID), zap.Error(err))
+	}
+}
+
+// interval is how often a working target is checked
+func (s *LinkCheckService) interval() time.Duration {
+	if interval := s.config.Server.Shortlinks.LinkCheck.Interval; interval > 0 {
+		return interval
+	}
+	return defaultLinkCheckInterval
+}
+
+// threshold is how many failed checks in a row make a target broken
+func (s *LinkCheckService) threshold() int {
+	return max(s.config.Server.Shortlinks.LinkCheck.Threshold, 1)
+}
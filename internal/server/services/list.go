@@ -0,0 +1,256 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/utils"
+	"gorm.io/gorm"
+)
+
+// Page sizes for the list endpoints
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// sortKind is the type of a sortable column, used to encode and decode cursor values
+type sortKind int
+
+const (
+	sortTime sortKind = iota
+	sortInt
+	sortString
+)
+
+// listCursor marks the position after the last item of a page. It carries the sort
+// it was issued for, so it can't be replayed against a different ordering.
+type listCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    string `json:"i"`
+}
+
+// listQuery holds the pagination and sort options of a list request. Results are
+// ordered by the sort column and then by ID, so pages are stable even when many
+// items share a sort value.
+type listQuery struct {
+	sort   string
+	kind   sortKind
+	desc   bool
+	limit  int
+	page   int // only set for offset pagination
+	cursor *listCursor
+}
+
+// parseListQuery reads sort, order, limit, cursor and page from the query string.
+// sortable maps the accepted sort names to their column types. Lists are sorted by
+// creation time, newest first, unless asked otherwise.
+func parseListQuery(c *fiber.Ctx, sortable map[string]sortKind) (*listQuery, error) {
+	q := &listQuery{
+		sort:  c.Query("sort", "created_at"),
+		desc:  true,
+		limit: utils.QueryInt(c, "limit", defaultListLimit),
+	}
+
+	switch strings.ToLower(c.Query("order", "desc")) {
+	case "asc":
+		q.desc = false
+	case "desc":
+		q.desc = true
+	default:
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid order, use asc or desc")
+	}
+
+	kind, ok := sortable[q.sort]
+	if !ok {
+		names := slices.Sorted(maps.Keys(sortable))
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid sort, use one of: "+strings.Join(names, ", "))
+	}
+	q.kind = kind
+
+	if q.limit < 1 {
+		q.limit = defaultListLimit
+	}
+	if q.limit > maxListLimit {
+		q.limit = maxListLimit
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeListCursor(raw)
+		if err != nil || cursor.Sort != q.sort || cursor.Desc != q.desc {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+		}
+		q.cursor = cursor
+	} else if c.Query("page") != "" {
+		q.page = max(utils.QueryInt(c, "page", 1), 1)
+	}
+
+	return q, nil
+}
+
+// paginate applies the cursor or page offset and the ordering to a query. One more
+// item than the limit is requested so callers can tell whether another page exists.
+func (q *listQuery) paginate(db *gorm.DB) (*gorm.DB, error) {
+	if q.cursor != nil {
+		value, err := q.cursorValue()
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+		}
+
+		op := ">"
+		if q.desc {
+			op = "<"
+		}
+		db = db.Where(fmt.Sprintf("(%[1]s %[2]s ?) OR (%[1]s = ? AND id %[2]s ?)", q.sort, op), value, value, q.cursor.ID)
+	} else if q.page > 0 {
+		db = db.Offset((q.page - 1) * q.limit)
+	}
+
+	direction := "ASC"
+	if q.desc {
+		direction = "DESC"
+	}
+	return db.Order(q.sort + " " + direction).Order("id " + direction).Limit(q.limit + 1), nil
+}
+
+// response builds the list envelope. n is the number of items fetched by paginate, and
+// last returns the sort value and ID of the last item that is kept on the page.
+func (q *listQuery) response(items any, n int, total int64, last func() (any, string)) ListResponse {
+	response := ListResponse{
+		Items: items,
+		Total: total,
+		Limit: q.limit,
+		Page:  q.page,
+	}
+
+	if n > q.limit {
+		response.HasMore = true
+		value, id := last()
+		response.NextCursor = encodeListCursor(&listCursor{
+			Sort:  q.sort,
+			Desc:  q.desc,
+			Value: formatCursorValue(value),
+			ID:    id,
+		})
+	}
+
+	return response
+}
+
+// cursorValue converts the cursor's encoded sort value back to the column's type
+func (q *listQuery) cursorValue() (any, error) {
+	switch q.kind {
+	case sortTime:
+		return time.Parse(time.RFC3339Nano, q.cursor.Value)
+	case sortInt:
+		return strconv.ParseInt(q.cursor.Value, 10, 64)
+	default:
+		return q.cursor.Value, nil
+	}
+}
+
+func formatCursorValue(value any) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func encodeListCursor(cursor *listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(raw string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	cursor := new(listCursor)
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// filterTimeRange applies the <prefix>_after and <prefix>_before query parameters to a
+// time column. Values are RFC 3339 timestamps or YYYY-MM-DD dates.
+func filterTimeRange(c *fiber.Ctx, db *gorm.DB, prefix, column string) (*gorm.DB, error) {
+	for _, bound := range []struct {
+		suffix, op string
+	}{{"_after", ">="}, {"_before", "<"}} {
+		raw := c.Query(prefix + bound.suffix)
+		if raw == "" {
+			continue
+		}
+
+		t, err := parseQueryTime(raw)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid %s%s, use RFC 3339 or YYYY-MM-DD", prefix, bound.suffix))
+		}
+		db = db.Where(column+" "+bound.op+" ?", t)
+	}
+	return db, nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, for use with ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// filterContains matches a column case-insensitively against a substring
+func filterContains(db *gorm.DB, column, substring string) *gorm.DB {
+	if substring == "" {
+		return db
+	}
+
+	escaped := likeEscaper.Replace(strings.ToLower(substring))
+	return db.Where("LOWER("+column+") LIKE ? ESCAPE '\\'", "%"+escaped+"%")
+}
+
+// filterTags keeps items carrying every tag of a comma separated list
+func filterTags(db *gorm.DB, column, raw string) (*gorm.DB, error) {
+	tags, err := models.ParseTags(raw).Normalize()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid tag: "+err.Error())
+	}
+
+	// Tags are stored as ",a,b,", so the delimiters keep "go" from matching "golang"
+	for _, tag := range tags {
+		db = db.Where(column+" LIKE ? ESCAPE '\\'", "%,"+likeEscaper.Replace(tag)+",%")
+	}
+	return db, nil
+}
+
+// parseQueryBool reads an optional true/false query parameter
+func parseQueryBool(c *fiber.Ctx, key string) (*bool, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid %s, use true or false", key))
+	}
+	return &value, nil
+}
+
+func parseQueryTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
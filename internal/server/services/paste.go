@@ -2,15 +2,19 @@ package services
 
 import (
 	"bytes"
+	"cmp"
+	"errors"
 	"fmt"
 	"image"
 	_ "image/gif"  // Register GIF format
 	_ "image/jpeg" // Register JPEG format
 	"image/png"
 	"io"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/alecthomas/chroma/v2"
 	"github.com/alecthomas/chroma/v2/formatters/html"
@@ -27,12 +31,22 @@ import (
 	"gorm.io/gorm"
 )
 
+// maxLineageDepth limits how many fork ancestors are resolved when rendering a paste
+const maxLineageDepth = 5
+
+// Limits on the details users can attach to pastes and shortlinks
+const (
+	maxTitleLength       = 255
+	maxDescriptionLength = 2000
+)
+
 type PasteService struct {
 	db        *gorm.DB
 	logger    *zap.Logger
 	config    *config.Config
 	storage   storage.Provider
 	analytics *AnalyticsService
+	fetcher   *utils.Fetcher
 }
 
 func NewPasteService(db *gorm.DB, logger *zap.Logger, config *config.Config) *PasteService {
@@ -42,6 +56,7 @@ func NewPasteService(db *gorm.DB, logger *zap.Logger, config *config.Config) *Pa
 		config:    config,
 		storage:   storage.NewProvider(config),
 		analytics: NewAnalyticsService(db, logger, config),
+		fetcher:   utils.NewFetcher(config.Server.Fetch),
 	}
 }
 
@@ -72,9 +87,16 @@ func (s *PasteService) UploadPaste(c *fiber.Ctx) error {
 		}
 	}
 
+	applyDetailHeaders(c, p)
+
 	s.logger.Debug("Parsed paste options",
 		zap.Any("options", p))
 
+	var apiKey *models.APIKey
+	if key := c.Locals("apiKey"); key != nil {
+		apiKey = key.(*models.APIKey)
+	}
+
 	// Get file content
 	var content []byte
 	var filename string
@@ -100,15 +122,22 @@ func (s *PasteService) UploadPaste(c *fiber.Ctx) error {
 			filename = "paste.txt" // Default filename
 		}
 	} else if p.URL != "" {
-		// Read content from the given URL
-		content, err = utils.GetContentFromURL(p.URL)
+		// Read content from the given URL, stopping at the caller's upload limit
+		result, err := s.fetcher.Fetch(c.UserContext(), p.URL, s.uploadLimit(apiKey))
 		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Failed to fetch URL")
+			return s.fetchError(err, p.URL, apiKey)
 		}
+		content = result.Content
 
-		// Try to get filename from URL if not explicitly provided
+		// Take the filename from the response if not explicitly provided, falling
+		// back to the Content-Type for the extension
 		if p.Filename == "" {
-			filename = utils.GetFilenameFromURL(p.URL)
+			filename = result.Filename
+		}
+		if p.Extension == "" && filepath.Ext(filename) == "" {
+			if m := mimetype.Lookup(result.ContentType); m != nil {
+				p.Extension = strings.TrimPrefix(m.Extension(), ".")
+			}
 		}
 	} else if p.Content != "" {
 		// Use content from the request body
@@ -127,22 +156,176 @@ func (s *PasteService) UploadPaste(c *fiber.Ctx) error {
 		p.Filename = filename
 	}
 
+	// Check if the user is attempting to do something they're not allowed to do
+	if p.Private && apiKey == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Private pastes can only be created with an API key")
+	}
+
+	// Create the paste
+	paste, err := s.createPaste(bytes.NewReader(content), apiKey, int64(len(content)), p)
+	if err != nil {
+		return err
+	}
+
+	return s.respondWithPaste(c, paste)
+}
+
+// UploadRawPaste creates a paste from a raw request body, as sent by `curl -T`. Options
+// come from X- headers and the filename, if any, from the last path segment.
+func (s *PasteService) UploadRawPaste(c *fiber.Ctx, filename string) error {
+	req, err := NewRequestParser(c).parseRawUpload()
+	if err != nil {
+		return err
+	}
+
+	p := &PasteOptions{
+		Filename:  req.Filename,
+		Extension: req.Extension,
+		Private:   req.Private,
+	}
+	applyDetailHeaders(c, p)
+
+	if p.Filename == "" && filename != "" {
+		if unescaped, err := url.PathUnescape(filename); err == nil {
+			filename = unescaped
+		}
+		p.Filename = filepath.Base(filename)
+	}
+
+	if req.ExpiresIn != "" {
+		expiresIn, err := hdur.ParseDuration(req.ExpiresIn)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid X-Expires-In duration")
+		}
+		p.ExpiresIn = &expiresIn
+	}
+
 	var apiKey *models.APIKey
 	if key := c.Locals("apiKey"); key != nil {
 		apiKey = key.(*models.APIKey)
 	}
 
-	// Check if the user is attempting to do something they're not allowed to do
 	if p.Private && apiKey == nil {
 		return fiber.NewError(fiber.StatusUnauthorized, "Private pastes can only be created with an API key")
 	}
 
-	// Create the paste
+	paste, err := s.createPaste(bytes.NewReader(req.Content), apiKey, int64(len(req.Content)), p)
+	if err != nil {
+		return err
+	}
+
+	// Command line clients get the bare URL unless they ask for JSON
+	if strings.Contains(c.Get("Accept"), "application/json") {
+		return s.respondWithPaste(c, paste)
+	}
+
+	baseURL := s.config.Server.BaseURL
+	c.Set("X-Paste-Delete-Url", fmt.Sprintf("%s/p/%s.%s/%s", baseURL, paste.ID, paste.Extension, paste.DeleteKey))
+	return c.SendString(s.PasteURL(paste) + "\n")
+}
+
+// ForkPaste creates a new paste from an existing one, optionally replacing its content
+func (s *PasteService) ForkPaste(c *fiber.Ctx, id string) error {
+	parent, err := s.GetPaste(id)
+	if err != nil {
+		return err
+	}
+
+	p := new(PasteOptions)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(p); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	// Use the edited content if any was sent, otherwise copy the parent
+	var content []byte
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to open uploaded file")
+		}
+		defer f.Close()
+
+		content, err = io.ReadAll(f)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to read file content")
+		}
+	} else if p.Content != "" {
+		content = []byte(p.Content)
+	} else {
+		content, err = s.storage.Get(parent.StoragePath)
+		if err != nil {
+			s.logger.Error("failed to read parent paste content",
+				zap.Error(err),
+				zap.String("id", parent.ID))
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to read paste content")
+		}
+	}
+
+	if len(content) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Empty file")
+	}
+
+	// Inherit the parent's name and type unless new ones were given
+	if p.Filename == "" {
+		p.Filename = parent.Filename
+	}
+	if p.Extension == "" {
+		p.Extension = parent.Extension
+	}
+	if p.Title == "" {
+		p.Title = parent.Title
+	}
+	if p.Description == "" {
+		p.Description = parent.Description
+	}
+	if p.Tags == nil {
+		p.Tags = parent.Tags
+	}
+
+	var apiKey *models.APIKey
+	if key := c.Locals("apiKey"); key != nil {
+		apiKey = key.(*models.APIKey)
+	}
+
+	if p.Private && apiKey == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Private pastes can only be created with an API key")
+	}
+
+	p.Metadata = &models.PasteMetadata{ForkedFrom: parent.ID}
+
 	paste, err := s.createPaste(bytes.NewReader(content), apiKey, int64(len(content)), p)
 	if err != nil {
 		return err
 	}
 
+	return s.respondWithPaste(c, paste)
+}
+
+// GetLineage returns the IDs of the pastes the given paste was forked from, nearest first.
+// Missing or expired ancestors end the chain, and at most limit entries are returned.
+func (s *PasteService) GetLineage(paste *models.Paste, limit int) []string {
+	var lineage []string
+	seen := map[string]bool{paste.ID: true}
+
+	parentID := paste.GetMetadata().ForkedFrom
+	for parentID != "" && len(lineage) < limit && !seen[parentID] {
+		lineage = append(lineage, parentID)
+		seen[parentID] = true
+
+		parent, err := s.GetPaste(parentID)
+		if err != nil {
+			break
+		}
+		parentID = parent.GetMetadata().ForkedFrom
+	}
+
+	return lineage
+}
+
+// respondWithPaste sends the result of a paste creation, redirecting browsers to the paste view
+func (s *PasteService) respondWithPaste(c *fiber.Ctx, paste *models.Paste) error {
 	baseURL := s.config.Server.BaseURL
 	response := &PasteResponse{
 		ID:        paste.ID,
@@ -153,6 +336,10 @@ func (s *PasteService) UploadPaste(c *fiber.Ctx) error {
 		MimeType:  paste.MimeType,
 		Size:      paste.Size,
 		ExpiresAt: paste.ExpiresAt,
+
+		Title:       paste.Title,
+		Description: paste.Description,
+		Tags:        paste.Tags,
 	}
 
 	// If this is a browser form submission, redirect to the paste view
@@ -173,15 +360,72 @@ func (s *PasteService) UploadPaste(c *fiber.Ctx) error {
 	return c.JSON(response)
 }
 
+// CreatePaste creates a paste from content received outside of the HTTP API,
+// such as the raw TCP listener
+func (s *PasteService) CreatePaste(content []byte, apiKey *models.APIKey, opts *PasteOptions) (*models.Paste, error) {
+	if len(content) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Empty file")
+	}
+	return s.createPaste(bytes.NewReader(content), apiKey, int64(len(content)), opts)
+}
+
+// PasteURL returns the public URL of a paste
+func (s *PasteService) PasteURL(paste *models.Paste) string {
+	return fmt.Sprintf("%s/p/%s.%s", s.config.Server.BaseURL, paste.ID, paste.Extension)
+}
+
+// GetContent reads the stored content of a paste
+func (s *PasteService) GetContent(paste *models.Paste) ([]byte, error) {
+	content, err := s.storage.Get(paste.StoragePath)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to read paste content")
+	}
+	return content, nil
+}
+
+// ListByAPIKey returns the most recent unexpired pastes created with an API key
+func (s *PasteService) ListByAPIKey(apiKey *models.APIKey, limit int) ([]models.Paste, error) {
+	var pastes []models.Paste
+	err := s.db.Where("api_key = ? AND (expires_at IS NULL OR expires_at > ?)", apiKey.Key, time.Now()).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&pastes).Error
+	return pastes, err
+}
+
+// DeleteOwned deletes a paste created with the given API key
+func (s *PasteService) DeleteOwned(apiKey *models.APIKey, id string) error {
+	paste, err := s.GetPaste(id)
+	if err != nil {
+		return err
+	}
+
+	if paste.APIKey == "" || paste.APIKey != apiKey.Key {
+		return fiber.NewError(fiber.StatusUnauthorized, "Not authorized to delete this paste")
+	}
+
+	if err := s.storage.Delete(paste.StoragePath); err != nil {
+		s.logger.Error("failed to delete paste content", zap.Error(err))
+	}
+
+	return s.db.Delete(paste).Error
+}
+
 // GetPaste retrieves a paste by ID with expiry checking
 func (s *PasteService) GetPaste(id string) (*models.Paste, error) {
+	return s.getPasteWithDB(s.db, id)
+}
+
+// getPasteWithDB retrieves a paste using the given database handle, so that lookups
+// can happen inside a caller's transaction
+func (s *PasteService) getPasteWithDB(db *gorm.DB, id string) (*models.Paste, error) {
 	// Strip any extension from the ID
 	if idx := strings.LastIndex(id, "."); idx != -1 {
 		id = id[:idx]
 	}
 
 	var paste models.Paste
-	err := s.db.Where("id = ? AND (expires_at IS NULL OR expires_at > ?)", id, time.Now()).First(&paste).Error
+	err := db.Where("id = ? AND (expires_at IS NULL OR expires_at > ?)", id, time.Now()).First(&paste).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fiber.NewError(fiber.StatusNotFound, "Paste not found or expired")
@@ -191,6 +435,11 @@ func (s *PasteService) GetPaste(id string) (*models.Paste, error) {
 	return &paste, nil
 }
 
+// GetPasteQR responds with a QR code of the paste's URL
+func (s *PasteService) GetPasteQR(c *fiber.Ctx, paste *models.Paste) error {
+	return renderQR(c, s.PasteURL(paste))
+}
+
 // GetPasteImage returns an image of the paste suitable for Open Graph
 func (s *PasteService) GetPasteImage(c *fiber.Ctx, paste *models.Paste) error {
 	// Get the content
@@ -320,18 +569,32 @@ func (s *PasteService) RenderPaste(c *fiber.Ctx, paste *models.Paste) error {
 		pasteID = paste.ID + "." + paste.Extension
 	}
 
+	// Resolve where this paste was forked from, if anywhere
+	var forkedFrom []fiber.Map
+	for _, parentID := range s.GetLineage(paste, maxLineageDepth) {
+		forkedFrom = append(forkedFrom, fiber.Map{"id": parentID})
+	}
+
 	return c.Render("paste", fiber.Map{
-		"isPaste":     true,
-		"id":          pasteID,
-		"filename":    paste.Filename,
-		"extension":   paste.Extension,
-		"created":     paste.CreatedAt.Format("2006-01-02 15:04:05"),
-		"expires":     formatExpiryTime(paste.ExpiresAt),
-		"language":    s.getLanguageName(paste.Extension, paste.MimeType),
-		"content":     renderedContent,
-		"rawContent":  string(content),
-		"baseUrl":     s.config.Server.BaseURL,
-		"deletionUrl": deletionUrl,
+		"isPaste":       true,
+		"pasteId":       paste.ID,
+		"forkedFrom":    forkedFrom,
+		"isArchive":     archiveFormat(paste.MimeType) != "",
+		"id":            pasteID,
+		"filename":      paste.Filename,
+		"title":         paste.Title,
+		"description":   paste.Description,
+		"tags":          paste.Tags,
+		"extension":     paste.Extension,
+		"created":       paste.CreatedAt.Format("2006-01-02 15:04:05"),
+		"expires":       formatExpiryTime(paste.ExpiresAt),
+		"language":      s.getLanguageName(paste.Extension, paste.MimeType),
+		"content":       renderedContent,
+		"rawContent":    string(content),
+		"baseUrl":       s.config.Server.BaseURL,
+		"deletionUrl":   deletionUrl,
+		"ogTitle":       cmp.Or(paste.Title, paste.Filename),
+		"ogDescription": paste.Description,
 		"metadata": fiber.Map{
 			"size":      formatSize(paste.Size),
 			"mimeType":  paste.MimeType,
@@ -341,6 +604,27 @@ func (s *PasteService) RenderPaste(c *fiber.Ctx, paste *models.Paste) error {
 	}, "layouts/main")
 }
 
+// RenderForkForm renders the submit page prefilled with the content of the paste being forked
+func (s *PasteService) RenderForkForm(c *fiber.Ctx, paste *models.Paste) error {
+	var content string
+	if s.isTextContent(paste.MimeType) {
+		raw, err := s.storage.Get(paste.StoragePath)
+		if err != nil {
+			return err
+		}
+		content = string(raw)
+	}
+
+	return c.Render("submit", fiber.Map{
+		"baseUrl":  s.config.Server.BaseURL,
+		"forkOf":   paste.ID,
+		"content":  content,
+		"filename": paste.Filename,
+		"title":    paste.Title,
+		"tagList":  strings.Join(paste.Tags, ", "),
+	}, "layouts/main")
+}
+
 // Helper function to get language name
 func (s *PasteService) getLanguageName(extension, mimeType string) string {
 	var lexer chroma.Lexer
@@ -421,16 +705,22 @@ func (s *PasteService) RenderPasteRaw(c *fiber.Ctx, paste *models.Paste) error {
 // in the response. Otherwise only the URL will be included for downloading purposes.
 func (s *PasteService) RenderPasteJSON(c *fiber.Ctx, paste *models.Paste) error {
 	pasteJson := struct {
-		ID       string `json:"id"`
-		Filename string `json:"filename"`
-		MimeType string `json:"mimeType"`
-		URL      string `json:"url"`
-		Content  string `json:"content"`
+		ID          string      `json:"id"`
+		Filename    string      `json:"filename"`
+		Title       string      `json:"title,omitempty"`
+		Description string      `json:"description,omitempty"`
+		Tags        models.Tags `json:"tags"`
+		MimeType    string      `json:"mimeType"`
+		URL         string      `json:"url"`
+		Content     string      `json:"content"`
 	}{
-		ID:       paste.ID,
-		Filename: paste.Filename,
-		MimeType: paste.MimeType,
-		URL:      fmt.Sprintf("%s/p/%s.%s", s.config.Server.BaseURL, paste.ID, paste.Extension),
+		ID:          paste.ID,
+		Filename:    paste.Filename,
+		Title:       paste.Title,
+		Description: paste.Description,
+		Tags:        paste.Tags,
+		MimeType:    paste.MimeType,
+		URL:         fmt.Sprintf("%s/p/%s.%s", s.config.Server.BaseURL, paste.ID, paste.Extension),
 	}
 
 	if s.isTextContent(paste.MimeType) {
@@ -499,6 +789,8 @@ func (s *PasteService) DeleteWithKey(c *fiber.Ctx, id string) error {
 		return c.Render("delete_success", fiber.Map{
 			"isDeleteSuccess": true,
 			"baseUrl":         s.config.Server.BaseURL,
+			"kind":            "paste",
+			"title":           "Paste",
 		}, "layouts/main")
 	}
 
@@ -514,8 +806,9 @@ func (s *PasteService) DeleteWithKey(c *fiber.Ctx, id string) error {
 	return c.Render("delete_confirm", fiber.Map{
 		"isDeleteConfirm": true,
 		"baseUrl":         s.config.Server.BaseURL,
-		"pasteId":         id,
-		"deleteKey":       key,
+		"kind":            "paste",
+		"title":           "Paste",
+		"deleteUrl":       fmt.Sprintf("%s/p/%s/%s", s.config.Server.BaseURL, id, key),
 	}, "layouts/main")
 }
 
@@ -538,30 +831,149 @@ func (s *PasteService) Delete(c *fiber.Ctx, id string) error {
 	return s.db.Delete(paste).Error
 }
 
-// ListPastes returns a paginated list of pastes for the API key
+// pasteSorts are the columns pastes can be listed by
+var pasteSorts = map[string]sortKind{
+	"created_at": sortTime,
+	"size":       sortInt,
+	"filename":   sortString,
+}
+
+// ListPastes returns a filtered, paginated list of pastes for the API key
 func (s *PasteService) ListPastes(c *fiber.Ctx) error {
 	apiKey := c.Locals("apiKey").(*models.APIKey)
 
-	var pastes []models.Paste
-	query := s.db.Where("api_key = ?", apiKey.Key)
+	list, err := parseListQuery(c, pasteSorts)
+	if err != nil {
+		return err
+	}
 
-	// Add pagination
-	page := utils.QueryInt(c, "page", 1)
-	limit := utils.QueryInt(c, "limit", 20)
-	offset := (page - 1) * limit
+	query, err := s.filterPastes(c, s.db.Model(&models.Paste{}).Where("api_key = ?", apiKey.Key))
+	if err != nil {
+		return err
+	}
 
 	var total int64
-	if err := query.Count(&total).Error; err != nil {
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return err
+	}
+
+	query, err = list.paginate(query)
+	if err != nil {
+		return err
+	}
+
+	var pastes []models.Paste
+	if err := query.Find(&pastes).Error; err != nil {
+		return err
+	}
+
+	n := len(pastes)
+	pastes = pastes[:min(n, list.limit)]
+
+	items := make([]PasteResponse, len(pastes))
+	for i := range pastes {
+		items[i] = NewPasteResponse(&pastes[i], s.config.Server.BaseURL)
+	}
+
+	return c.JSON(list.response(items, n, total, func() (any, string) {
+		last := pastes[len(pastes)-1]
+		switch list.sort {
+		case "size":
+			return last.Size, last.ID
+		case "filename":
+			return last.Filename, last.ID
+		default:
+			return last.CreatedAt, last.ID
+		}
+	}))
+}
+
+// filterPastes applies the list filters from the query string
+func (s *PasteService) filterPastes(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	// A trailing wildcard matches a whole MIME family, e.g. image/*
+	if mimeType := c.Query("mime_type"); mimeType != "" {
+		if prefix, ok := strings.CutSuffix(mimeType, "*"); ok {
+			query = query.Where("mime_type LIKE ? ESCAPE '\\'", likeEscaper.Replace(prefix)+"%")
+		} else {
+			query = query.Where("mime_type = ?", mimeType)
+		}
+	}
+
+	if extension := strings.TrimPrefix(c.Query("extension"), "."); extension != "" {
+		query = query.Where("extension = ?", extension)
+	}
+
+	private, err := parseQueryBool(c, "private")
+	if err != nil {
+		return nil, err
+	}
+	if private != nil {
+		query = query.Where("private = ?", *private)
+	}
+
+	query = filterContains(query, "filename", c.Query("filename"))
+
+	if query, err = filterTags(query, "tags", c.Query("tag")); err != nil {
+		return nil, err
+	}
+
+	if query, err = filterTimeRange(c, query, "created", "created_at"); err != nil {
+		return nil, err
+	}
+	return filterTimeRange(c, query, "expires", "expires_at")
+}
+
+// UpdateDetails edits the title, description and tags of a paste owned by the API key
+func (s *PasteService) UpdateDetails(c *fiber.Ctx, id string) error {
+	// Strip any extension from the ID
+	if idx := strings.LastIndex(id, "."); idx != -1 {
+		id = id[:idx]
+	}
+
+	paste, err := s.GetPaste(id)
+	if err != nil {
 		return err
 	}
 
-	if err := query.Offset(offset).Limit(limit).Find(&pastes).Error; err != nil {
+	apiKey := c.Locals("apiKey").(*models.APIKey)
+	if paste.APIKey == "" || paste.APIKey != apiKey.Key {
+		return fiber.NewError(fiber.StatusUnauthorized, "Not authorized to edit this paste")
+	}
+
+	req := new(UpdatePasteRequest)
+	if err := c.BodyParser(req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := normalizeDetails(req.Title, req.Description, req.Tags); err != nil {
 		return err
 	}
 
-	// Convert pastes to response format
-	respose := NewListPastesResponse(pastes, s.config.Server.BaseURL)
-	return c.JSON(respose)
+	if req.Title != nil {
+		paste.Title = *req.Title
+	}
+	if req.Description != nil {
+		paste.Description = *req.Description
+	}
+	if req.Tags != nil {
+		paste.Tags = *req.Tags
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(paste).Select("title", "description", "tags").Updates(paste).Error; err != nil {
+			return err
+		}
+
+		content, err := s.searchContent(paste)
+		if err != nil {
+			return err
+		}
+		return indexPaste(tx, paste, content)
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update paste")
+	}
+
+	return c.JSON(NewPasteResponse(paste, s.config.Server.BaseURL))
 }
 
 // UpdateExpiration updates a paste's expiration time
@@ -656,6 +1068,47 @@ func (s *PasteService) CleanupExpired() (int64, error) {
 
 // Helper functions
 
+// applyDetailHeaders fills in the title, description and tags from the X-Title,
+// X-Description and X-Tags headers, unless they were sent in the body
+func applyDetailHeaders(c *fiber.Ctx, p *PasteOptions) {
+	if p.Title == "" {
+		p.Title = c.Get("X-Title")
+	}
+	if p.Description == "" {
+		p.Description = c.Get("X-Description")
+	}
+	if p.Tags == nil {
+		p.Tags = models.ParseTags(c.Get("X-Tags"))
+	}
+}
+
+// normalizeDetails trims and validates user supplied details in place. Nil fields are skipped.
+func normalizeDetails(title, description *string, tags *models.Tags) error {
+	if title != nil {
+		*title = strings.TrimSpace(*title)
+		if utf8.RuneCountInString(*title) > maxTitleLength {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Title must be at most %d characters", maxTitleLength))
+		}
+	}
+
+	if description != nil {
+		*description = strings.TrimSpace(*description)
+		if utf8.RuneCountInString(*description) > maxDescriptionLength {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Description must be at most %d characters", maxDescriptionLength))
+		}
+	}
+
+	if tags != nil {
+		normalized, err := tags.Normalize()
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid tags: "+err.Error())
+		}
+		*tags = normalized
+	}
+
+	return nil
+}
+
 // validateFileSize checks if the file size is within the allowed limits
 func (s *PasteService) validateFileSize(size int64, apiKey *models.APIKey) error {
 	// First check against absolute maximum size for security
@@ -677,7 +1130,35 @@ func (s *PasteService) validateFileSize(size int64, apiKey *models.APIKey) error
 	return nil
 }
 
+// uploadLimit returns the largest upload allowed for the given API key
+func (s *PasteService) uploadLimit(apiKey *models.APIKey) int64 {
+	limit := s.config.Server.DefaultUploadSize
+	if apiKey != nil {
+		limit = s.config.Server.APIUploadSize
+	}
+	return int64(min(limit, s.config.Server.MaxUploadSize))
+}
+
+// fetchError turns a failed remote fetch into a client error
+func (s *PasteService) fetchError(err error, url string, apiKey *models.APIKey) error {
+	switch {
+	case errors.Is(err, utils.ErrFetchTooLarge):
+		return s.validateFileSize(s.uploadLimit(apiKey)+1, apiKey)
+	case errors.Is(err, utils.ErrFetchBlocked), errors.Is(err, utils.ErrFetchScheme), errors.Is(err, utils.ErrFetchTooManyRedirects):
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to fetch URL: "+err.Error())
+	default:
+		s.logger.Debug("failed to fetch url", zap.String("url", url), zap.Error(err))
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to fetch URL")
+	}
+}
+
 func (s *PasteService) createPaste(content io.Reader, apiKey *models.APIKey, size int64, opts *PasteOptions) (*models.Paste, error) {
+	return s.createPasteWithDB(s.db, content, apiKey, size, opts)
+}
+
+// createPasteWithDB creates a paste using the given database handle, so that callers
+// can group several pastes into a single transaction
+func (s *PasteService) createPasteWithDB(db *gorm.DB, content io.Reader, apiKey *models.APIKey, size int64, opts *PasteOptions) (*models.Paste, error) {
 	// Read content for MIME type detection
 	contentBytes, err := io.ReadAll(content)
 	if err != nil {
@@ -689,6 +1170,10 @@ func (s *PasteService) createPaste(content io.Reader, apiKey *models.APIKey, siz
 		return nil, err
 	}
 
+	if err := normalizeDetails(&opts.Title, &opts.Description, &opts.Tags); err != nil {
+		return nil, err
+	}
+
 	// Detect MIME type if not provided
 	mime := mimetype.Detect(contentBytes)
 	contentType := mime.String()
@@ -710,6 +1195,18 @@ func (s *PasteService) createPaste(content io.Reader, apiKey *models.APIKey, siz
 		Size:      size,
 		Extension: opts.Extension,
 		Private:   opts.Private,
+
+		Title:       opts.Title,
+		Description: opts.Description,
+		Tags:        opts.Tags,
+
+		CollectionID: opts.CollectionID,
+	}
+
+	if opts.Metadata != nil {
+		if err := paste.SetMetadata(*opts.Metadata); err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to encode paste metadata")
+		}
 	}
 
 	// Set extension in order of precedence
@@ -748,9 +1245,17 @@ func (s *PasteService) createPaste(content io.Reader, apiKey *models.APIKey, siz
 		paste.APIKey = apiKey.Key
 	}
 
+	// Use the requested slug as the ID. Pastes and collections share the /p/ namespace.
+	if opts.Slug != "" {
+		paste.ID, err = resolveSlug(db, apiKey, opts.Slug, &models.Paste{}, &models.Collection{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Use a transaction for the entire creation process
 	var storagePath string
-	err = s.db.Transaction(func(tx *gorm.DB) error {
+	err = db.Transaction(func(tx *gorm.DB) error {
 		// Set the default storage configuration
 		for _, storage := range s.config.Storage {
 			if storage.IsDefault {
@@ -765,7 +1270,10 @@ func (s *PasteService) createPaste(content io.Reader, apiKey *models.APIKey, siz
 		}
 
 		// Create the initial database record
-		if err := tx.Create(paste).Error; err != nil {
+		if err := createWithGeneratedID(tx, paste, &paste.ID, s.config.IDs.Paste, models.PasteIDLength, &models.Collection{}); err != nil {
+			if opts.Slug != "" && errors.Is(err, gorm.ErrDuplicatedKey) {
+				return slugTakenError(paste.ID)
+			}
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to save paste")
 		}
 
@@ -790,6 +1298,18 @@ func (s *PasteService) createPaste(content io.Reader, apiKey *models.APIKey, siz
 			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update paste")
 		}
 
+		// Index pastes of API keys so their owners can search them. A failed index
+		// entry shouldn't lose the upload; the backfill command can add it later.
+		if paste.APIKey != "" {
+			var text []byte
+			if s.isTextContent(paste.MimeType) {
+				text = contentBytes
+			}
+			if err := indexPaste(tx, paste, text); err != nil {
+				s.logger.Warn("failed to index paste", zap.String("id", paste.ID), zap.Error(err))
+			}
+		}
+
 		return nil
 	})
 
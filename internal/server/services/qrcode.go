@@ -0,0 +1,292 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	// QR code sizes in pixels
+	defaultQRSize = 256
+	minQRSize     = 32
+	maxQRSize     = 2048
+
+	// Quiet zone around QR codes in modules. Scanners want at least four.
+	defaultQRMargin = 4
+	maxQRMargin     = 16
+
+	// The logo badge covers 30% of the code's width and 45% of that in height, about
+	// 4% of the modules, which error correction level Q or H restores comfortably
+	qrLogoWidth  = 0.3
+	qrLogoHeight = 0.45
+)
+
+// qrLevels maps the error correction levels of the QR spec to those of the encoder,
+// which names them differently
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// QROptions control how a QR code is rendered
+type QROptions struct {
+	Format     string // "png" or "svg"
+	Size       int    // Width and height in pixels
+	Level      qrcode.RecoveryLevel
+	Margin     int // Quiet zone in modules
+	Foreground color.RGBA
+	Background color.RGBA
+	Logo       bool // Put the app name in the middle, like the watermark of OG images
+}
+
+// parseQROptions reads QR code options from the query string
+func parseQROptions(c *fiber.Ctx) (*QROptions, error) {
+	opts := &QROptions{
+		Format:     strings.ToLower(c.Query("format", "png")),
+		Size:       defaultQRSize,
+		Margin:     defaultQRMargin,
+		Foreground: color.RGBA{0, 0, 0, 255},
+		Background: color.RGBA{255, 255, 255, 255},
+	}
+	if opts.Format != "png" && opts.Format != "svg" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid format, must be png or svg")
+	}
+
+	if raw := c.Query("size"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < minQRSize || size > maxQRSize {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid size, must be between %d and %d pixels", minQRSize, maxQRSize))
+		}
+		opts.Size = size
+	}
+
+	if raw := c.Query("margin"); raw != "" {
+		margin, err := strconv.Atoi(raw)
+		if err != nil || margin < 0 || margin > maxQRMargin {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid margin, must be between 0 and %d modules", maxQRMargin))
+		}
+		opts.Margin = margin
+	}
+
+	var err error
+	if opts.Foreground, err = parseQRColor(c, "fg", opts.Foreground); err != nil {
+		return nil, err
+	}
+	if opts.Background, err = parseQRColor(c, "bg", opts.Background); err != nil {
+		return nil, err
+	}
+
+	logo, err := parseQueryBool(c, "logo")
+	if err != nil {
+		return nil, err
+	}
+	opts.Logo = logo != nil && *logo
+
+	// The logo hides modules, so it needs the higher levels of error correction
+	level := strings.ToUpper(c.Query("level"))
+	switch {
+	case level == "" && opts.Logo:
+		level = "H"
+	case level == "":
+		level = "M"
+	case opts.Logo && level != "Q" && level != "H":
+		return nil, fiber.NewError(fiber.StatusBadRequest, "QR codes with a logo need error correction level Q or H")
+	}
+	var ok bool
+	if opts.Level, ok = qrLevels[level]; !ok {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid level, must be L, M, Q or H")
+	}
+
+	return opts, nil
+}
+
+// parseQRColor reads a color from the query string, falling back to a default
+func parseQRColor(c *fiber.Ctx, key string, fallback color.RGBA) (color.RGBA, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return fallback, nil
+	}
+	clr, err := parseHexColor(raw)
+	if err != nil {
+		return fallback, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid %s color %q, must be hex like 000000 or 000000ff", key, raw))
+	}
+	return clr, nil
+}
+
+// parseHexColor parses RGB or RGBA colors written as 3, 6 or 8 hex digits, with or
+// without a leading "#"
+func parseHexColor(raw string) (color.RGBA, error) {
+	raw = strings.TrimPrefix(raw, "#")
+	if len(raw) == 3 {
+		raw = string([]byte{raw[0], raw[0], raw[1], raw[1], raw[2], raw[2]})
+	}
+	if len(raw) == 6 {
+		raw += "ff"
+	}
+
+	b, err := hex.DecodeString(raw)
+	if err != nil || len(b) != 4 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", raw)
+	}
+	// color.RGBA is alpha premultiplied
+	a := uint32(b[3])
+	return color.RGBA{
+		R: uint8(uint32(b[0]) * a / 255),
+		G: uint8(uint32(b[1]) * a / 255),
+		B: uint8(uint32(b[2]) * a / 255),
+		A: b[3],
+	}, nil
+}
+
+// renderQR responds with a QR code of the content, rendered as the query string asks.
+// Codes only depend on the content and the query, so they're cached like other
+// immutable assets.
+func renderQR(c *fiber.Ctx, content string) error {
+	opts, err := parseQROptions(c)
+	if err != nil {
+		return err
+	}
+
+	code, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Failed to encode QR code: "+err.Error())
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+
+	var data []byte
+	if opts.Format == "svg" {
+		data = renderQRSVG(modules, opts)
+		c.Set("Content-Type", "image/svg+xml")
+	} else {
+		if data, err = renderQRPNG(modules, opts); err != nil {
+			return err
+		}
+		c.Set("Content-Type", "image/png")
+	}
+
+	c.Set("Cache-Control", "public, max-age=31536000, immutable")
+	return c.Send(data)
+}
+
+// renderQRPNG draws the modules with square pixels. Each module gets a whole number
+// of pixels where the size allows, so codes stay sharp instead of being smoothed.
+func renderQRPNG(modules [][]bool, opts *QROptions) ([]byte, error) {
+	n := len(modules) + 2*opts.Margin
+	size := max(opts.Size, n)
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for py := 0; py < size; py++ {
+		y := py*n/size - opts.Margin
+		for px := 0; px < size; px++ {
+			x := px*n/size - opts.Margin
+			clr := opts.Background
+			if y >= 0 && y < len(modules) && x >= 0 && x < len(modules) && modules[y][x] {
+				clr = opts.Foreground
+			}
+			img.SetRGBA(px, py, clr)
+		}
+	}
+
+	if opts.Logo {
+		codeWidth := float64(len(modules)) * float64(size) / float64(n)
+		if err := drawQRLogo(gg.NewContextForRGBA(img), codeWidth, opts); err != nil {
+			return nil, fmt.Errorf("failed to draw logo: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawQRLogo puts the watermark text on a badge in the middle of a QR code
+func drawQRLogo(dc *gg.Context, codeWidth float64, opts *QROptions) error {
+	watermark := DefaultWatermarkConfig()
+	w := codeWidth * qrLogoWidth
+	h := w * qrLogoHeight
+	x := float64(dc.Width()) / 2
+	y := float64(dc.Height()) / 2
+
+	dc.SetColor(opts.Background)
+	dc.DrawRoundedRectangle(x-w/2, y-h/2, w, h, h*0.2)
+	dc.Fill()
+
+	if err := dc.LoadFontFace(watermark.FontPath, h*0.6); err != nil {
+		return fmt.Errorf("failed to load watermark font: %w", err)
+	}
+	dc.SetColor(opts.Foreground)
+	dc.DrawStringAnchored(watermark.Text, x, y, 0.5, 0.5)
+	return nil
+}
+
+// renderQRSVG draws the modules as a single path in a viewBox one unit per module,
+// merging runs of dark modules in a row to keep the document small
+func renderQRSVG(modules [][]bool, opts *QROptions) []byte {
+	n := len(modules) + 2*opts.Margin
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`, n, n, opts.Size, opts.Size)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" %s/>`, n, n, svgFill(opts.Background))
+
+	fmt.Fprintf(&b, `<path %s d="`, svgFill(opts.Foreground))
+	for y, row := range modules {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", start+opts.Margin, y+opts.Margin, x-start, x-start)
+		}
+	}
+	b.WriteString(`"/>`)
+
+	if opts.Logo {
+		watermark := DefaultWatermarkConfig()
+		w := float64(len(modules)) * qrLogoWidth
+		h := w * qrLogoHeight
+		center := float64(n) / 2
+		fmt.Fprintf(&b, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" rx="%.2f" shape-rendering="auto" %s/>`,
+			center-w/2, center-h/2, w, h, h*0.2, svgFill(opts.Background))
+		fmt.Fprintf(&b, `<text x="%.2f" y="%.2f" font-family="'Go Mono', monospace" font-weight="bold" font-size="%.2f" text-anchor="middle" dominant-baseline="central" %s>%s</text>`,
+			center, center, h*0.6, svgFill(opts.Foreground), html.EscapeString(watermark.Text))
+	}
+
+	b.WriteString("</svg>")
+	return []byte(b.String())
+}
+
+// svgFill returns the fill attributes for a color
+func svgFill(clr color.RGBA) string {
+	if clr.A == 0 {
+		return `fill="none"`
+	}
+	// Undo the premultiplication of color.RGBA
+	r := uint32(clr.R) * 255 / uint32(clr.A)
+	g := uint32(clr.G) * 255 / uint32(clr.A)
+	b := uint32(clr.B) * 255 / uint32(clr.A)
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, r, g, b)
+	if clr.A < 255 {
+		fill += fmt.Sprintf(` fill-opacity="%.3f"`, float64(clr.A)/255)
+	}
+	return fill
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxIndexedContent bounds how much of a paste is indexed. Postgres limits a
+	// tsvector to 1MB, and the start of a paste is what people search for anyway.
+	maxIndexedContent = 256 << 10
+
+	// maxSearchTerms bounds the number of words in a search query
+	maxSearchTerms = 10
+
+	// backfillBatchSize is the number of pastes indexed per batch by Backfill
+	backfillBatchSize = 100
+)
+
+// SearchService searches the filenames, details and text content of the pastes created
+// with an API key. Pastes are indexed when they're created and removed from the index when
+// they're deleted; Backfill indexes pastes that were created before the index existed.
+type SearchService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	config *config.Config
+	paste  *PasteService
+}
+
+func NewSearchService(db *gorm.DB, logger *zap.Logger, config *config.Config, paste *PasteService) *SearchService {
+	return &SearchService{
+		db:     db,
+		logger: logger,
+		config: config,
+		paste:  paste,
+	}
+}
+
+// Search returns the pastes of the requesting API key matching the q parameter, best
+// matches first. Every word of the query has to match, either in full or as a prefix.
+func (s *SearchService) Search(c *fiber.Ctx) error {
+	apiKey := c.Locals("apiKey").(*models.APIKey)
+
+	terms := searchTerms(c.Query("q"))
+	if len(terms) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Missing search query")
+	}
+
+	limit := min(max(utils.QueryInt(c, "limit", defaultListLimit), 1), maxListLimit)
+	page := max(utils.QueryInt(c, "page", 1), 1)
+
+	query := s.db.Model(&models.Paste{}).
+		Joins("JOIN "+models.PasteSearchTable+" ON "+models.PasteSearchTable+".paste_id = pastes.id").
+		Where("pastes.api_key = ?", apiKey.Key).
+		Where("pastes.expires_at IS NULL OR pastes.expires_at > ?", time.Now())
+
+	var rank clause.Expr
+	if s.db.Dialector.Name() == "postgres" {
+		// Every term is matched as a prefix, e.g. "conf:* & prod:*"
+		tsquery := strings.Join(terms, ":* & ") + ":*"
+		query = query.Where(models.PasteSearchTable+".document @@ to_tsquery('simple', ?)", tsquery)
+		rank = clause.Expr{SQL: "ts_rank(" + models.PasteSearchTable + ".document, to_tsquery('simple', ?)) DESC", Vars: []any{tsquery}}
+	} else {
+		// Terms are letters and digits only, so quoting them can't break the FTS5 syntax
+		match := `"` + strings.Join(terms, `"* AND "`) + `"*`
+		query = query.Where(models.PasteSearchTable+" MATCH ?", match)
+		// Lower bm25 scores are better. Filename matches weigh the most, then titles,
+		// descriptions and tags, then content.
+		rank = clause.Expr{SQL: "bm25(" + models.PasteSearchTable + ", 0, 0, 10.0, 1.0, 5.0)"}
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return err
+	}
+
+	var pastes []models.Paste
+	err := query.Select("pastes.*").
+		Order(clause.OrderBy{Expression: rank}).
+		Order("pastes.created_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&pastes).Error
+	if err != nil {
+		return err
+	}
+
+	items := make([]PasteResponse, len(pastes))
+	for i := range pastes {
+		items[i] = NewPasteResponse(&pastes[i], s.config.Server.BaseURL)
+	}
+
+	return c.JSON(ListResponse{
+		Items:   items,
+		Total:   total,
+		Limit:   limit,
+		Page:    page,
+		HasMore: int64(page*limit) < total,
+	})
+}
+
+// Backfill indexes the pastes of API keys that aren't in the search index yet, such as
+// pastes created before search was added. It returns the number of pastes indexed.
+func (s *SearchService) Backfill(ctx context.Context) (int, error) {
+	var pastes []models.Paste
+	indexed := 0
+	result := s.db.WithContext(ctx).
+		Where("api_key <> ''").
+		Where("id NOT IN (SELECT paste_id FROM "+models.PasteSearchTable+")").
+		FindInBatches(&pastes, backfillBatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range pastes {
+				paste := &pastes[i]
+
+				content, err := s.paste.searchContent(paste)
+				if err != nil {
+					s.logger.Warn("failed to read paste content for indexing", zap.String("id", paste.ID), zap.Error(err))
+					continue
+				}
+
+				if err := indexPaste(s.db.WithContext(ctx), paste, content); err != nil {
+					return err
+				}
+				indexed++
+			}
+
+			s.logger.Info("indexed pastes", zap.Int("batch", batch), zap.Int("total", indexed))
+			return nil
+		})
+
+	return indexed, result.Error
+}
+
+// searchContent returns the content of a paste to index, or nil for binary pastes
+func (s *PasteService) searchContent(paste *models.Paste) ([]byte, error) {
+	if !s.isTextContent(paste.MimeType) {
+		return nil, nil
+	}
+	return s.storage.Get(paste.StoragePath)
+}
+
+// indexPaste adds a paste to the search index, replacing any previous entry. content
+// is nil for binary pastes, which are only found by their filename and details.
+func indexPaste(db *gorm.DB, paste *models.Paste, content []byte) error {
+	if len(content) > maxIndexedContent {
+		content = content[:maxIndexedContent]
+	}
+	filename := searchText(paste.Filename)
+	details := searchText(strings.Join(append([]string{paste.Title, paste.Description}, paste.Tags...), " "))
+	text := searchText(string(content))
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM "+models.PasteSearchTable+" WHERE paste_id = ?", paste.ID).Error; err != nil {
+			return err
+		}
+
+		if tx.Dialector.Name() == "postgres" {
+			return tx.Exec("INSERT INTO "+models.PasteSearchTable+" (paste_id, api_key, document) VALUES (?, ?, "+
+				"setweight(to_tsvector('simple', ?), 'A') || setweight(to_tsvector('simple', ?), 'B') || setweight(to_tsvector('simple', ?), 'C'))",
+				paste.ID, paste.APIKey, filename, details, text).Error
+		}
+		return tx.Exec("INSERT INTO "+models.PasteSearchTable+" (paste_id, api_key, filename, content, details) VALUES (?, ?, ?, ?, ?)",
+			paste.ID, paste.APIKey, filename, text, details).Error
+	})
+}
+
+// searchText reduces text to lowercase words separated by spaces. Splitting on
+// punctuation ourselves makes both databases tokenize names like build.log or
+// my_config the same way, and drops anything Postgres won't store, like NUL bytes.
+func searchText(text string) string {
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, " ")
+	}
+	return strings.ToLower(strings.Join(strings.FieldsFunc(text, isSearchSeparator), " "))
+}
+
+// searchTerms splits a search query into the words to match
+func searchTerms(query string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(query), isSearchSeparator)
+	return terms[:min(len(terms), maxSearchTerms)]
+}
+
+func isSearchSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
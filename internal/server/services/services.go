@@ -4,30 +4,64 @@ import (
 	"time"
 
 	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/geoip"
+	"github.com/watzon/0x45/internal/reputation"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
 // Services holds all service instances
 type Services struct {
-	Paste     *PasteService
-	URL       *URLService
-	APIKey    *APIKeyService
-	Analytics *AnalyticsService
-	Stats     *StatsService
-	Cleanup   *CleanupService
+	Paste      *PasteService
+	Collection *CollectionService
+	Archive    *ArchiveService
+	Tus        *TusService
+	Inbound    *InboundService
+	URL        *URLService
+	Batch      *BatchService
+	Search     *SearchService
+	APIKey     *APIKeyService
+	Analytics  *AnalyticsService
+	Stats      *StatsService
+	LinkCheck  *LinkCheckService
+
+	// Reputation checks shortlink destinations against the operator's blocklists
+	Reputation *reputation.Checker
+	Cleanup    *CleanupService
 }
 
 // NewServices creates a new Services instance with all service dependencies
 func NewServices(db *gorm.DB, logger *zap.Logger, config *config.Config) *Services {
+	blocklists, err := reputation.New(config.Server.Shortlinks.Reputation, logger)
+	if err != nil {
+		logger.Error("failed to load URL blocklists", zap.Error(err))
+	}
+
+	locator, err := geoip.New(config.Server.Shortlinks.GeoIP, logger)
+	if err != nil {
+		logger.Error("failed to load GeoIP database, country rules won't match", zap.Error(err))
+	}
+
 	services := &Services{
-		Paste:     NewPasteService(db, logger, config),
-		URL:       NewURLService(db, logger, config),
-		APIKey:    NewAPIKeyService(db, logger, config),
-		Analytics: NewAnalyticsService(db, logger, config),
-		Stats:     NewStatsService(db, logger, config),
+		Paste:      NewPasteService(db, logger, config),
+		URL:        NewURLService(db, logger, config, blocklists, locator),
+		Reputation: blocklists,
+		APIKey:     NewAPIKeyService(db, logger, config),
+		Analytics:  NewAnalyticsService(db, logger, config),
+		Stats:      NewStatsService(db, logger, config),
+		LinkCheck:  NewLinkCheckService(db, logger, config),
 	}
 
+	// Collections, archive browsing, resumable uploads, inbound email and search build on pastes, so they share the paste service
+	services.Collection = NewCollectionService(db, logger, config, services.Paste)
+	services.Archive = NewArchiveService(db, logger, config, services.Paste)
+	services.Tus = NewTusService(db, logger, config, services.Paste)
+	services.Inbound = NewInboundService(db, logger, config, services.Paste)
+	services.Search = NewSearchService(db, logger, config, services.Paste)
+
+	// Batch requests create and delete both pastes and shortlinks
+	services.Batch = NewBatchService(db, logger, config, services.Paste, services.URL)
+
 	// Create cleanup service last since it depends on other services
 	services.Cleanup = NewCleanupService(db, logger, config, services)
 
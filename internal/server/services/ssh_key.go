@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/models"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+// AddSSHKey links an SSH public key to the requesting API key
+func (s *APIKeyService) AddSSHKey(c *fiber.Ctx) error {
+	var req SSHKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid SSH public key")
+	}
+	if req.Comment != "" {
+		comment = req.Comment
+	}
+	if len(comment) > 255 {
+		comment = comment[:255]
+	}
+
+	apiKey := c.Locals("apiKey").(*models.APIKey)
+	key := &models.SSHKey{
+		APIKey:      apiKey.Key,
+		Fingerprint: ssh.FingerprintSHA256(pub),
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))),
+		Comment:     comment,
+	}
+
+	if err := s.db.Create(key).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return fiber.NewError(fiber.StatusConflict, "SSH key is already linked to an API key")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save SSH key")
+	}
+
+	return c.JSON(key.ToResponse())
+}
+
+// ListSSHKeys returns the SSH keys linked to the requesting API key
+func (s *APIKeyService) ListSSHKeys(c *fiber.Ctx) error {
+	apiKey := c.Locals("apiKey").(*models.APIKey)
+
+	var keys []models.SSHKey
+	if err := s.db.Where("api_key = ?", apiKey.Key).Order("created_at").Find(&keys).Error; err != nil {
+		return err
+	}
+
+	response := make([]fiber.Map, len(keys))
+	for i, key := range keys {
+		response[i] = key.ToResponse()
+	}
+
+	return c.JSON(fiber.Map{"keys": response})
+}
+
+// DeleteSSHKey unlinks one of the requesting API key's SSH keys
+func (s *APIKeyService) DeleteSSHKey(c *fiber.Ctx) error {
+	apiKey := c.Locals("apiKey").(*models.APIKey)
+
+	result := s.db.Where("id = ? AND api_key = ?", c.Params("id"), apiKey.Key).Delete(&models.SSHKey{})
+	if result.Error != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete SSH key")
+	}
+	if result.RowsAffected == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "SSH key not found")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// FindBySSHKey returns the verified API key an SSH public key is linked to, or nil
+// if the key isn't linked to any
+func (s *APIKeyService) FindBySSHKey(pub ssh.PublicKey) (*models.APIKey, error) {
+	var key models.SSHKey
+	if err := s.db.Where("fingerprint = ?", ssh.FingerprintSHA256(pub)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	apiKey, err := s.FindVerifiedKey(key.APIKey)
+	if err != nil || apiKey == nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(&key).Update("last_used_at", time.Now()).Error; err != nil {
+		s.logger.Error("failed to update SSH key usage", zap.Uint("id", key.ID), zap.Error(err))
+	}
+
+	return apiKey, nil
+}
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/utils"
+	"github.com/watzon/hdur"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Supported tus protocol version and extensions
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,termination,expiration"
+)
+
+// tusChunkContentType is the only content type accepted for upload data
+const tusChunkContentType = "application/offset+octet-stream"
+
+// defaultTusExpiry is used when the tus section of the config is left empty
+const defaultTusExpiry = 24 * time.Hour
+
+// TusService implements resumable uploads following the tus 1.0 protocol. Chunks are
+// staged in the default store and turned into a regular paste once complete.
+type TusService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	config *config.Config
+	paste  *PasteService
+}
+
+func NewTusService(db *gorm.DB, logger *zap.Logger, config *config.Config, paste *PasteService) *TusService {
+	return &TusService{
+		db:     db,
+		logger: logger,
+		config: config,
+		paste:  paste,
+	}
+}
+
+// Options describes the protocol version, extensions and the size limit that applies
+// to the requesting API key
+func (s *TusService) Options(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Tus-Version", tusVersion)
+	c.Set("Tus-Extension", tusExtensions)
+	c.Set("Tus-Max-Size", strconv.FormatInt(s.paste.uploadLimit(s.apiKey(c)), 10))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Create starts a new upload. Paste options are read from the Upload-Metadata header,
+// and data sent along with the request is stored as the first chunk.
+func (s *TusService) Create(c *fiber.Ctx) error {
+	if err := s.checkResumable(c); err != nil {
+		return err
+	}
+
+	length, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Upload-Length must be a positive integer")
+	}
+
+	apiKey := s.apiKey(c)
+	if err := s.paste.validateFileSize(length, apiKey); err != nil {
+		c.Set("Tus-Max-Size", strconv.FormatInt(s.paste.uploadLimit(apiKey), 10))
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, err.Error())
+	}
+
+	// Validate the paste options up front so clients don't upload data that can't be used
+	opts, err := parseTusMetadata(c.Get("Upload-Metadata"))
+	if err != nil {
+		return err
+	}
+	if err := normalizeDetails(&opts.Title, &opts.Description, &opts.Tags); err != nil {
+		return err
+	}
+	if opts.Private && apiKey == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Private pastes can only be created with an API key")
+	}
+	if opts.Slug != "" {
+		if _, err := resolveSlug(s.db, apiKey, opts.Slug, &models.Paste{}, &models.Collection{}); err != nil {
+			return err
+		}
+	}
+
+	upload := &models.Upload{
+		Length:    length,
+		Metadata:  c.Get("Upload-Metadata"),
+		ExpiresAt: time.Now().Add(s.expiry()),
+	}
+	if apiKey != nil {
+		upload.APIKey = apiKey.Key
+	}
+
+	if err := s.db.Create(upload).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create upload")
+	}
+
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Location", fmt.Sprintf("%s/p/tus/%s", s.config.Server.BaseURL, upload.ID))
+	c.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	// creation-with-upload: the request body holds the first chunk
+	if len(c.Body()) > 0 && c.Get("Content-Type") == tusChunkContentType {
+		if err := s.appendChunk(c, upload, 0, c.Body()); err != nil {
+			return err
+		}
+	}
+
+	c.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+// Head reports how many bytes of an upload have been received
+func (s *TusService) Head(c *fiber.Ctx, id string) error {
+	if err := s.checkResumable(c); err != nil {
+		return err
+	}
+
+	upload, err := s.findUpload(id)
+	if err != nil {
+		return err
+	}
+
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Cache-Control", "no-store")
+	c.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.Metadata != "" {
+		c.Set("Upload-Metadata", upload.Metadata)
+	}
+
+	if upload.PasteID != "" {
+		if paste, err := s.paste.GetPaste(upload.PasteID); err == nil {
+			c.Set("X-Paste-Url", s.paste.PasteURL(paste))
+		}
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// Patch appends a chunk at the given offset, creating the paste once all bytes are in
+func (s *TusService) Patch(c *fiber.Ctx, id string) error {
+	if err := s.checkResumable(c); err != nil {
+		return err
+	}
+
+	if c.Get("Content-Type") != tusChunkContentType {
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, "Content-Type must be "+tusChunkContentType)
+	}
+
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Upload-Offset must be a non-negative integer")
+	}
+
+	upload, err := s.findUpload(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.appendChunk(c, upload, offset, c.Body()); err != nil {
+		return err
+	}
+
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Delete terminates an upload and discards the chunks received so far
+func (s *TusService) Delete(c *fiber.Ctx, id string) error {
+	if err := s.checkResumable(c); err != nil {
+		return err
+	}
+
+	upload, err := s.findUpload(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.removeUpload(upload); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete upload")
+	}
+
+	c.Set("Tus-Resumable", tusVersion)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CleanupExpired removes uploads that were not finished in time, along with their chunks
+func (s *TusService) CleanupExpired() (int64, error) {
+	var uploads []models.Upload
+	if err := s.db.Where("expires_at < ?", time.Now()).Find(&uploads).Error; err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for i := range uploads {
+		if err := s.removeUpload(&uploads[i]); err != nil {
+			s.logger.Error("failed to cleanup upload",
+				zap.String("id", uploads[i].ID),
+				zap.Error(err))
+			continue
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Helper functions
+
+// checkResumable rejects requests made with an unsupported protocol version
+func (s *TusService) checkResumable(c *fiber.Ctx) error {
+	if c.Get("Tus-Resumable") != tusVersion {
+		c.Set("Tus-Version", tusVersion)
+		return fiber.NewError(fiber.StatusPreconditionFailed, "Unsupported Tus-Resumable version")
+	}
+	return nil
+}
+
+func (s *TusService) apiKey(c *fiber.Ctx) *models.APIKey {
+	if key := c.Locals("apiKey"); key != nil {
+		return key.(*models.APIKey)
+	}
+	return nil
+}
+
+func (s *TusService) expiry() time.Duration {
+	if s.config.Server.Tus.Expiry > 0 {
+		return s.config.Server.Tus.Expiry
+	}
+	return defaultTusExpiry
+}
+
+// findUpload retrieves an upload by ID, reporting uploads past their expiry as gone
+func (s *TusService) findUpload(id string) (*models.Upload, error) {
+	var upload models.Upload
+	if err := s.db.Where("id = ?", id).First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Upload not found")
+		}
+		return nil, err
+	}
+
+	if upload.ExpiresAt.Before(time.Now()) {
+		return nil, fiber.NewError(fiber.StatusGone, "Upload has expired")
+	}
+
+	return &upload, nil
+}
+
+// appendChunk stores data at the given offset and finalizes the upload once it is complete
+func (s *TusService) appendChunk(c *fiber.Ctx, upload *models.Upload, offset int64, data []byte) error {
+	if upload.PasteID != "" || offset != upload.Offset {
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Upload-Offset does not match the current offset of %d", upload.Offset))
+	}
+	if offset+int64(len(data)) > upload.Length {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Chunk exceeds the declared Upload-Length")
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	// Each attempt gets its own path, so a PATCH losing the race below can't overwrite
+	// or delete the chunk of the one that won
+	name := fmt.Sprintf("tus-%s-%d-%s", upload.ID, offset, utils.MustGenerateID(8))
+	path, err := s.paste.storage.Put(name, bytes.NewReader(data))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to store chunk")
+	}
+
+	chunks := append(upload.GetChunks(), path)
+	if err := upload.SetChunks(chunks); err != nil {
+		_ = s.paste.storage.Delete(path)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to store chunk")
+	}
+
+	// Only advance from the offset we read, so concurrent PATCHes can't both succeed
+	newOffset := offset + int64(len(data))
+	result := s.db.Model(&models.Upload{}).
+		Where("id = ? AND upload_offset = ?", upload.ID, offset).
+		Updates(map[string]any{"upload_offset": newOffset, "chunks": upload.Chunks})
+	if result.Error != nil || result.RowsAffected == 0 {
+		_ = s.paste.storage.Delete(path)
+		if result.Error != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to update upload")
+		}
+		return fiber.NewError(fiber.StatusConflict, "Upload was modified by another request")
+	}
+	upload.Offset = newOffset
+
+	if upload.Offset < upload.Length {
+		return nil
+	}
+
+	paste, err := s.finalize(upload)
+	if err != nil {
+		// The data can't become a paste, so there is nothing left to resume
+		if rerr := s.removeUpload(upload); rerr != nil {
+			s.logger.Error("failed to remove upload", zap.String("id", upload.ID), zap.Error(rerr))
+		}
+		return err
+	}
+
+	c.Set("X-Paste-Id", paste.ID)
+	c.Set("X-Paste-Url", s.paste.PasteURL(paste))
+	c.Set("X-Paste-Delete-Url", fmt.Sprintf("%s/p/%s.%s/%s", s.config.Server.BaseURL, paste.ID, paste.Extension, paste.DeleteKey))
+	return nil
+}
+
+// finalize joins the staged chunks into a paste and releases them
+func (s *TusService) finalize(upload *models.Upload) (*models.Paste, error) {
+	opts, err := parseTusMetadata(upload.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	var apiKey *models.APIKey
+	if upload.APIKey != "" {
+		apiKey = &models.APIKey{}
+		if err := s.db.Where("key = ?", upload.APIKey).First(apiKey).Error; err != nil {
+			return nil, fiber.NewError(fiber.StatusUnauthorized, "API key used to create the upload is no longer valid")
+		}
+	}
+
+	readers := make([]io.Reader, 0, len(upload.GetChunks()))
+	for _, path := range upload.GetChunks() {
+		chunk, err := s.paste.storage.Open(path)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to read upload")
+		}
+		defer chunk.Close()
+		readers = append(readers, chunk)
+	}
+
+	paste, err := s.paste.createPaste(io.MultiReader(readers...), apiKey, upload.Length, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.deleteChunks(upload)
+	if err := s.db.Model(upload).Updates(map[string]any{"paste_id": paste.ID, "chunks": nil}).Error; err != nil {
+		s.logger.Error("failed to mark upload as finished", zap.String("id", upload.ID), zap.Error(err))
+	}
+	upload.PasteID = paste.ID
+
+	return paste, nil
+}
+
+// removeUpload deletes an upload record and any chunks it still holds
+func (s *TusService) removeUpload(upload *models.Upload) error {
+	s.deleteChunks(upload)
+	return s.db.Delete(upload).Error
+}
+
+func (s *TusService) deleteChunks(upload *models.Upload) {
+	for _, path := range upload.GetChunks() {
+		if err := s.paste.storage.Delete(path); err != nil {
+			s.logger.Warn("failed to delete upload chunk",
+				zap.String("id", upload.ID),
+				zap.String("path", path),
+				zap.Error(err))
+		}
+	}
+}
+
+// parseTusMetadata reads paste options from an Upload-Metadata header, which holds
+// comma-separated "key base64value" pairs
+func parseTusMetadata(header string) (*PasteOptions, error) {
+	opts := &PasteOptions{}
+	if strings.TrimSpace(header) == "" {
+		return opts, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid Upload-Metadata value for %q", key))
+		}
+
+		switch key {
+		case "filename":
+			opts.Filename = string(value)
+		case "extension":
+			opts.Extension = string(value)
+		case "private":
+			opts.Private = string(value) == "true" || string(value) == "1"
+		case "slug":
+			opts.Slug = string(value)
+		case "title":
+			opts.Title = string(value)
+		case "description":
+			opts.Description = string(value)
+		case "tags":
+			opts.Tags = models.ParseTags(string(value))
+		case "expires_in":
+			expiresIn, err := hdur.ParseDuration(string(value))
+			if err != nil {
+				return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid expires_in in Upload-Metadata")
+			}
+			opts.ExpiresIn = &expiresIn
+		}
+	}
+
+	return opts, nil
+}
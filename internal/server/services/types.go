@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"net/url"
 	"reflect"
 	"time"
 
@@ -15,6 +16,12 @@ type APIKeyRequest struct {
 	Name  string `json:"name" xml:"name" form:"name"`
 }
 
+// SSHKeyRequest represents the request structure for linking an SSH public key to an API key
+type SSHKeyRequest struct {
+	PublicKey string `json:"public_key" xml:"public_key" form:"public_key"` // authorized_keys line, e.g. the contents of ~/.ssh/id_ed25519.pub
+	Comment   string `json:"comment" xml:"comment" form:"comment"`          // Optional label, defaults to the key's own comment
+}
+
 // APIKeyResponse represents the response sent after an API key is requested
 type APIKeyResponse struct {
 	Message string `json:"message" xml:"message" form:"message"`
@@ -30,6 +37,14 @@ type PasteOptions struct {
 	URL       string         `json:"url" xml:"url" form:"url"`                      // URL to be pasted
 	ExpiresIn *hdur.Duration `json:"expires_in" xml:"expires_in" form:"expires_in"` // Duration string for paste expiry (e.g. "24h")
 	ExpiresAt *time.Time     `json:"expires_at" xml:"expires_at" form:"expires_at"` // Expiration time for the paste
+	Slug      string         `json:"slug" xml:"slug" form:"slug"`                   // Custom ID for the paste (requires an API key)
+
+	Title       string      `json:"title" xml:"title" form:"title"`                   // Display title, shown instead of the filename
+	Description string      `json:"description" xml:"description" form:"description"` // Longer description of the paste
+	Tags        models.Tags `json:"tags" xml:"tags" form:"tags"`                      // Tags, as an array or a comma separated list
+
+	Metadata     *models.PasteMetadata `json:"-" xml:"-" form:"-"` // Server-side metadata, never read from the request
+	CollectionID string                `json:"-" xml:"-" form:"-"` // Collection the paste is created in, if any
 }
 
 // PasteResponse represents the response structure for creating a new paste
@@ -42,6 +57,42 @@ type PasteResponse struct {
 	Size      int64      `json:"size" xml:"size" form:"size"`
 	ExpiresAt *time.Time `json:"expires_at" xml:"expires_at" form:"expires_at"`
 	Private   bool       `json:"private" xml:"private" form:"private"`
+
+	Title       string      `json:"title,omitempty" xml:"title,omitempty" form:"title"`
+	Description string      `json:"description,omitempty" xml:"description,omitempty" form:"description"`
+	Tags        models.Tags `json:"tags,omitempty" xml:"tags,omitempty" form:"tags"`
+}
+
+// UpdatePasteRequest represents the request structure for editing a paste's details.
+// Fields that are left out are not changed.
+type UpdatePasteRequest struct {
+	Title       *string      `json:"title" xml:"title" form:"title"`
+	Description *string      `json:"description" xml:"description" form:"description"`
+	Tags        *models.Tags `json:"tags" xml:"tags" form:"tags"`
+}
+
+// UpdateShortlinkRequest represents the request structure for editing a shortlink.
+// Fields that are left out are not changed.
+type UpdateShortlinkRequest struct {
+	URL            *string                   `json:"url" xml:"url" form:"url"`
+	Title          *string                   `json:"title" xml:"title" form:"title"`
+	Tags           *models.Tags              `json:"tags" xml:"tags" form:"tags"`
+	Rules          *models.ShortlinkRules    `json:"rules" xml:"rules" form:"rules"`
+	Variants       *models.ShortlinkVariants `json:"variants" xml:"variants" form:"variants"`
+	Interstitial   *bool                     `json:"interstitial" xml:"interstitial" form:"interstitial"`
+	RedirectStatus *int                      `json:"redirect_status" xml:"redirect_status" form:"redirect_status"`
+	Passthrough    *bool                     `json:"passthrough" xml:"passthrough" form:"passthrough"`
+	UTM            *models.UTMParams         `json:"utm" xml:"utm" form:"utm"`
+	Password       *string                   `json:"password" xml:"password" form:"password"`       // An empty password removes the protection
+	MaxClicks      *int                      `json:"max_clicks" xml:"max_clicks" form:"max_clicks"` // 0 removes the limit
+	NotBefore      *string                   `json:"not_before" xml:"not_before" form:"not_before"` // An empty time removes the bound
+	NotAfter       *string                   `json:"not_after" xml:"not_after" form:"not_after"`
+}
+
+// RollbackShortlinkRequest represents the request structure for rolling a shortlink
+// back to the target it had before one of its changes
+type RollbackShortlinkRequest struct {
+	ChangeID uint `json:"change_id" xml:"change_id" form:"change_id"`
 }
 
 // UpdatePasteExpirationRequest represents the request structure for updating a paste's expiration time
@@ -66,36 +117,172 @@ func NewPasteResponse(paste *models.Paste, baseURL string) PasteResponse {
 		MimeType:  paste.MimeType,
 		Size:      paste.Size,
 		ExpiresAt: paste.ExpiresAt,
+
+		Title:       paste.Title,
+		Description: paste.Description,
+		Tags:        paste.Tags,
 	}
 }
 
-// ListPastesResponse represents the response structure for listing pastes
-type ListPastesResponse struct {
-	Pastes []PasteResponse `json:"pastes"`
-	Total  int64           `json:"total"`
-	Page   int             `json:"page"`
-	Limit  int             `json:"limit"`
+// ListResponse is the envelope shared by the list endpoints
+type ListResponse struct {
+	Items      any    `json:"items"`
+	Total      int64  `json:"total"`                 // Items matching the filters, across all pages
+	Limit      int    `json:"limit"`                 // Maximum items per page
+	Page       int    `json:"page,omitempty"`        // Only set when paginating with ?page=
+	HasMore    bool   `json:"has_more"`              // Whether another page follows
+	NextCursor string `json:"next_cursor,omitempty"` // Pass as ?cursor= to get the next page
+}
+
+// CollectionFileOptions describes a single file in a JSON collection upload
+type CollectionFileOptions struct {
+	Filename  string `json:"filename" xml:"filename" form:"filename"`    // Name of the file within the collection
+	Extension string `json:"extension" xml:"extension" form:"extension"` // File extension (optional)
+	Content   string `json:"content" xml:"content" form:"content"`       // Content of the file
 }
 
-// NewListPastesResponse creates a new ListPastesResponse from a list of pastes
-func NewListPastesResponse(pastes []models.Paste, baseURL string) ListPastesResponse {
-	respose := ListPastesResponse{
-		Pastes: make([]PasteResponse, len(pastes)),
-		Total:  int64(len(pastes)),
+// CollectionOptions contains configuration options for creating a new collection
+type CollectionOptions struct {
+	Files     []CollectionFileOptions `json:"files" xml:"files" form:"-"`                    // Files to include in the collection
+	Private   bool                    `json:"private" xml:"private" form:"private"`          // Whether the collection is private
+	ExpiresIn *hdur.Duration          `json:"expires_in" xml:"expires_in" form:"expires_in"` // Duration string for collection expiry (e.g. "24h")
+	ExpiresAt *time.Time              `json:"expires_at" xml:"expires_at" form:"expires_at"` // Expiration time for the collection
+}
+
+// CollectionFileResponse represents a single file in a collection response
+type CollectionFileResponse struct {
+	ID       string `json:"id" xml:"id" form:"id"`
+	Filename string `json:"filename" xml:"filename" form:"filename"`
+	URL      string `json:"url" xml:"url" form:"url"`
+	RawURL   string `json:"raw_url" xml:"raw_url" form:"raw_url"`
+	MimeType string `json:"mime_type" xml:"mime_type" form:"mime_type"`
+	Size     int64  `json:"size" xml:"size" form:"size"`
+}
+
+// CollectionResponse represents the response structure for creating a new collection
+type CollectionResponse struct {
+	ID          string                   `json:"id" xml:"id" form:"id"`
+	URL         string                   `json:"url" xml:"url" form:"url"`
+	DownloadURL string                   `json:"download_url" xml:"download_url" form:"download_url"`
+	DeleteURL   string                   `json:"delete_url" xml:"delete_url" form:"delete_url"`
+	Files       []CollectionFileResponse `json:"files" xml:"files" form:"files"`
+	Size        int64                    `json:"size" xml:"size" form:"size"`
+	ExpiresAt   *time.Time               `json:"expires_at" xml:"expires_at" form:"expires_at"`
+	Private     bool                     `json:"private" xml:"private" form:"private"`
+}
+
+// NewCollectionResponse creates a new CollectionResponse from a collection and its files
+func NewCollectionResponse(collection *models.Collection, files []models.Paste, baseURL string) CollectionResponse {
+	response := CollectionResponse{
+		ID:          collection.ID,
+		URL:         fmt.Sprintf("%s/p/%s", baseURL, collection.ID),
+		DownloadURL: fmt.Sprintf("%s/p/%s/download", baseURL, collection.ID),
+		DeleteURL:   fmt.Sprintf("%s/p/%s/%s", baseURL, collection.ID, collection.DeleteKey),
+		Files:       make([]CollectionFileResponse, len(files)),
+		ExpiresAt:   collection.ExpiresAt,
+		Private:     collection.Private,
 	}
 
-	for i, paste := range pastes {
-		respose.Pastes[i] = NewPasteResponse(&paste, baseURL)
+	for i, file := range files {
+		response.Size += file.Size
+		response.Files[i] = CollectionFileResponse{
+			ID:       file.ID,
+			Filename: file.Filename,
+			URL:      fmt.Sprintf("%s/p/%s", baseURL, file.ID),
+			RawURL:   fmt.Sprintf("%s/p/%s/files/%s", baseURL, collection.ID, url.PathEscape(file.Filename)),
+			MimeType: file.MimeType,
+			Size:     file.Size,
+		}
 	}
 
-	return respose
+	return response
+}
+
+// ArchiveEntryResponse represents a single file or directory inside an archive paste
+type ArchiveEntryResponse struct {
+	Path     string    `json:"path" xml:"path" form:"path"`
+	Size     int64     `json:"size" xml:"size" form:"size"`
+	IsDir    bool      `json:"is_dir" xml:"is_dir" form:"is_dir"`
+	Modified time.Time `json:"modified" xml:"modified" form:"modified"`
+	URL      string    `json:"url,omitempty" xml:"url,omitempty" form:"url"`
+	RawURL   string    `json:"raw_url,omitempty" xml:"raw_url,omitempty" form:"raw_url"`
+}
+
+// ArchiveResponse represents the listing of an archive paste
+type ArchiveResponse struct {
+	ID        string                 `json:"id" xml:"id" form:"id"`
+	Format    string                 `json:"format" xml:"format" form:"format"`
+	Entries   []ArchiveEntryResponse `json:"entries" xml:"entries" form:"entries"`
+	Truncated bool                   `json:"truncated" xml:"truncated" form:"truncated"`
 }
 
 // ShortlinkOptions contains configuration options for creating a new shortlink
 type ShortlinkOptions struct {
-	URL       string         `json:"url" xml:"url" form:"url"`                      // URL to be shortened
-	Title     string         `json:"title" xml:"title" form:"title"`                // Display title for the shortlink
-	ExpiresIn *hdur.Duration `json:"expires_in" xml:"expires_in" form:"expires_in"` // Duration string for shortlink expiry (e.g. "24h")
+	URL            string                   `json:"url" xml:"url" form:"url"`                                     // URL to be shortened
+	Title          string                   `json:"title" xml:"title" form:"title"`                               // Display title for the shortlink
+	Tags           models.Tags              `json:"tags" xml:"tags" form:"tags"`                                  // Tags, as an array or a comma separated list
+	Rules          models.ShortlinkRules    `json:"rules" xml:"rules" form:"rules"`                               // Routing rules, evaluated in order
+	Variants       models.ShortlinkVariants `json:"variants" xml:"variants" form:"variants"`                      // Weighted split test destinations
+	Interstitial   bool                     `json:"interstitial" xml:"interstitial" form:"interstitial"`          // Show a warning page before redirecting
+	RedirectStatus int                      `json:"redirect_status" xml:"redirect_status" form:"redirect_status"` // 301, 302, 307 (default) or 308
+	Passthrough    bool                     `json:"passthrough" xml:"passthrough" form:"passthrough"`             // Forward the path suffix and query string to the target
+	UTM            models.UTMParams         `json:"utm" xml:"utm" form:"utm"`                                     // UTM parameter templates appended to the target
+	Password       string                   `json:"password" xml:"password" form:"password"`                      // Password visitors have to enter
+	MaxClicks      int                      `json:"max_clicks" xml:"max_clicks" form:"max_clicks"`                // Number of redirects before the link is gone
+	NotBefore      string                   `json:"not_before" xml:"not_before" form:"not_before"`                // RFC 3339 time or date the link starts working
+	NotAfter       string                   `json:"not_after" xml:"not_after" form:"not_after"`                   // RFC 3339 time or date the link stops working
+	ExpiresIn      *hdur.Duration           `json:"expires_in" xml:"expires_in" form:"expires_in"`                // Duration string for shortlink expiry (e.g. "24h")
+	Slug           string                   `json:"slug" xml:"slug" form:"slug"`                                  // Custom ID for the shortlink
+}
+
+// BatchPasteItem describes a single paste in a batch upload. In multipart requests the
+// content comes from the file part at the same position instead.
+type BatchPasteItem struct {
+	Content   string         `json:"content" xml:"content" form:"content"`          // Content to be pasted
+	Filename  string         `json:"filename" xml:"filename" form:"filename"`       // Original filename
+	Extension string         `json:"extension" xml:"extension" form:"extension"`    // File extension (optional)
+	Private   bool           `json:"private" xml:"private" form:"private"`          // Whether the paste is private
+	ExpiresIn *hdur.Duration `json:"expires_in" xml:"expires_in" form:"expires_in"` // Duration string for paste expiry (e.g. "24h")
+	ExpiresAt *time.Time     `json:"expires_at" xml:"expires_at" form:"expires_at"` // Expiration time for the paste
+	Slug      string         `json:"slug" xml:"slug" form:"slug"`                   // Custom ID for the paste (requires an API key)
+
+	Title       string      `json:"title" xml:"title" form:"title"`                   // Display title, shown instead of the filename
+	Description string      `json:"description" xml:"description" form:"description"` // Longer description of the paste
+	Tags        models.Tags `json:"tags" xml:"tags" form:"tags"`                      // Tags, as an array or a comma separated list
+}
+
+// BatchPasteRequest represents the request structure for uploading several pastes at once
+type BatchPasteRequest struct {
+	Items []BatchPasteItem `json:"items" xml:"items" form:"-"`
+}
+
+// BatchShortlinkRequest represents the request structure for creating several shortlinks at once.
+// URLs is a shorthand for items that only carry a URL.
+type BatchShortlinkRequest struct {
+	Items []ShortlinkOptions `json:"items" xml:"items" form:"-"`
+	URLs  []string           `json:"urls" xml:"urls" form:"-"`
+}
+
+// BatchDeleteRequest represents the request structure for deleting several pastes at once
+type BatchDeleteRequest struct {
+	IDs []string `json:"ids" xml:"ids" form:"ids"`
+}
+
+// BatchResult is the outcome of a single item in a batch request
+type BatchResult struct {
+	Index     int            `json:"index"`
+	Status    int            `json:"status"`
+	Error     string         `json:"error,omitempty"`
+	ID        string         `json:"id,omitempty"`
+	Paste     *PasteResponse `json:"paste,omitempty"`
+	Shortlink map[string]any `json:"shortlink,omitempty"`
+}
+
+// BatchResponse represents the response structure for batch requests
+type BatchResponse struct {
+	Results   []BatchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
 }
 
 // ShortlinkResponse represents the response structure for creating a new shortlink
@@ -150,6 +337,7 @@ type AnalyticsStats struct {
 	TopReferrers map[string]int64 `json:"top_referrers"`
 	TopCountries map[string]int64 `json:"top_countries"`
 	TopBrowsers  map[string]int64 `json:"top_browsers"`
+	Variants     map[string]int64 `json:"variants,omitempty"` // Clicks per split test variant
 }
 
 // ExpiryOptions contains parameters for calculating paste expiration
@@ -1,33 +1,88 @@
 package services
 
 import (
-	"net/http"
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/mileusna/useragent"
 	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/geoip"
 	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/reputation"
 	"github.com/watzon/0x45/internal/utils"
+	"github.com/watzon/hdur"
 	"go.uber.org/zap"
 	"golang.org/x/net/html"
 	"gorm.io/gorm"
 )
 
+// shortlinkSorts are the columns shortlinks can be listed by
+var shortlinkSorts = map[string]sortKind{
+	"created_at": sortTime,
+	"title":      sortString,
+}
+
+// Interstitial modes of the shortlinks config
+const (
+	interstitialNewKeys = "new_keys"
+	interstitialAll     = "all"
+)
+
+// Split test assignments are remembered in a cookie per shortlink
+const (
+	variantCookiePrefix = "variant_"
+	variantCookieMaxAge = 30 * 24 * time.Hour
+)
+
+// Password protected shortlinks take the password from this header, so scripts don't
+// need the prompt page. bcrypt only looks at the first 72 bytes of a password.
+const (
+	shortlinkPasswordHeader    = "X-Shortlink-Password"
+	maxShortlinkPasswordLength = 72
+)
+
+// errShortlinkExhausted is returned for shortlinks that used up their clicks
+var errShortlinkExhausted = fiber.NewError(fiber.StatusGone, "Shortlink has reached its click limit")
+
+// errDestinationBlocked is returned for destinations on the operator's blocklists. It
+// doesn't say which list matched, so the lists can't be probed.
+var errDestinationBlocked = fiber.NewError(fiber.StatusForbidden, "Destination is blocked on this instance")
+
+// maxTitleScan bounds how much of a page is read while looking for its title
+const maxTitleScan = 1 << 20
+
 type URLService struct {
 	db        *gorm.DB
 	logger    *zap.Logger
 	config    *config.Config
 	analytics *AnalyticsService
+	fetcher   *utils.Fetcher
+
+	// reputation blocks destinations listed by the operator
+	reputation *reputation.Checker
+
+	// geoip looks up the countries of visitors for country rules
+	geoip *geoip.Locator
 }
 
-func NewURLService(db *gorm.DB, logger *zap.Logger, config *config.Config) *URLService {
+func NewURLService(db *gorm.DB, logger *zap.Logger, config *config.Config, reputation *reputation.Checker, geoip *geoip.Locator) *URLService {
 	return &URLService{
-		db:        db,
-		logger:    logger,
-		config:    config,
-		analytics: NewAnalyticsService(db, logger, config),
+		db:         db,
+		logger:     logger,
+		config:     config,
+		analytics:  NewAnalyticsService(db, logger, config),
+		fetcher:    utils.NewFetcher(config.Server.Fetch),
+		reputation: reputation,
+		geoip:      geoip,
 	}
 }
 
@@ -38,13 +93,32 @@ func (s *URLService) CreateShortlink(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
 	}
 
-	apiKey := c.Locals("apiKey").(*models.APIKey)
+	opts := &ShortlinkOptions{
+		URL:            u.URL,
+		Title:          u.Title,
+		Tags:           u.Tags,
+		Rules:          u.Rules,
+		Variants:       u.Variants,
+		Interstitial:   u.Interstitial,
+		RedirectStatus: u.RedirectStatus,
+		Passthrough:    u.Passthrough,
+		UTM:            u.UTM,
+		Password:       u.Password,
+		MaxClicks:      u.MaxClicks,
+		NotBefore:      u.NotBefore,
+		NotAfter:       u.NotAfter,
+		ExpiresIn:      u.ExpiresIn,
+		Slug:           u.Slug,
+	}
 
-	shortlink, err := s.createShortlink(apiKey, &ShortlinkOptions{
-		URL:       u.URL,
-		Title:     u.Title,
-		ExpiresIn: u.ExpiresIn,
-	})
+	apiKey, _ := c.Locals("apiKey").(*models.APIKey)
+	if apiKey == nil {
+		if err := s.limitAnonymous(opts); err != nil {
+			return err
+		}
+	}
+
+	shortlink, err := s.createShortlink(apiKey, opts)
 	if err != nil {
 		return err
 	}
@@ -52,6 +126,27 @@ func (s *URLService) CreateShortlink(c *fiber.Ctx) error {
 	return c.JSON(shortlink.ToResponse(s.config.Server.BaseURL))
 }
 
+// limitAnonymous applies the limits of shortlinks created without an API key, if the
+// instance allows them at all. They always expire, and since nobody answers for them
+// they're only allowed while their destinations are checked against blocklists.
+func (s *URLService) limitAnonymous(opts *ShortlinkOptions) error {
+	cfg := s.config.Server.Shortlinks
+	if !cfg.Anonymous.Enabled || !cfg.Reputation.Enabled {
+		return fiber.NewError(fiber.StatusUnauthorized, "API key required")
+	}
+
+	if opts.ExpiresIn == nil {
+		expiresIn := hdur.FromStandard(cfg.Anonymous.Expiry)
+		opts.ExpiresIn = &expiresIn
+	}
+	now := time.Now()
+	if opts.ExpiresIn.Add(now).After(now.Add(cfg.Anonymous.MaxExpiry)) {
+		return fiber.NewError(fiber.StatusBadRequest,
+			fmt.Sprintf("Shortlinks created without an API key can expire after at most %s", hdur.FromStandard(cfg.Anonymous.MaxExpiry)))
+	}
+	return nil
+}
+
 // GetStats returns statistics for a shortened URL
 func (s *URLService) GetStats(c *fiber.Ctx) error {
 	shortlinkID := c.Params("id")
@@ -59,7 +154,7 @@ func (s *URLService) GetStats(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Shortlink ID is required")
 	}
 
-	shortlink, err := s.FindShortlink(shortlinkID)
+	shortlink, err := s.findShortlink(shortlinkID)
 	if err != nil {
 		return err
 	}
@@ -99,6 +194,20 @@ func (s *URLService) GetStats(c *fiber.Ctx) error {
 		return err
 	}
 
+	if len(shortlink.Variants) > 0 {
+		clicks, err := s.analytics.GetVariantClicks(shortlink.ID, timeframe)
+		if err != nil {
+			return err
+		}
+		// List every current variant, including those nobody was sent to yet
+		for _, variant := range shortlink.Variants {
+			if _, ok := clicks[variant.Name]; !ok {
+				clicks[variant.Name] = 0
+			}
+		}
+		stats.Variants = clicks
+	}
+
 	return c.JSON(stats)
 }
 
@@ -106,35 +215,62 @@ func (s *URLService) GetStats(c *fiber.Ctx) error {
 func (s *URLService) ListURLs(c *fiber.Ctx) error {
 	apiKey := c.Locals("apiKey").(*models.APIKey)
 
-	var shortlinks []models.Shortlink
-	query := s.db.Where("api_key = ?", apiKey.Key)
+	list, err := parseListQuery(c, shortlinkSorts)
+	if err != nil {
+		return err
+	}
 
-	// Add pagination
-	page := utils.QueryInt(c, "page", 1)
-	limit := utils.QueryInt(c, "limit", 20)
-	offset := (page - 1) * limit
+	query := s.db.Model(&models.Shortlink{}).Where("api_key = ?", apiKey.Key)
+	query = filterContains(query, "title", c.Query("title"))
+	query = filterContains(query, "target_url", c.Query("url"))
+	if query, err = filterTags(query, "tags", c.Query("tag")); err != nil {
+		return err
+	}
+	if query, err = filterTimeRange(c, query, "created", "created_at"); err != nil {
+		return err
+	}
+	if query, err = filterTimeRange(c, query, "expires", "expires_at"); err != nil {
+		return err
+	}
+
+	broken, err := parseQueryBool(c, "broken")
+	if err != nil {
+		return err
+	}
+	if broken != nil {
+		query = query.Where("broken = ?", *broken)
+	}
 
 	var total int64
-	if err := query.Count(&total).Error; err != nil {
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return err
+	}
+
+	query, err = list.paginate(query)
+	if err != nil {
 		return err
 	}
 
-	if err := query.Offset(offset).Limit(limit).Find(&shortlinks).Error; err != nil {
+	var shortlinks []models.Shortlink
+	if err := query.Find(&shortlinks).Error; err != nil {
 		return err
 	}
 
-	// Convert shortlinks to response format
-	shortlinkResponses := make([]fiber.Map, len(shortlinks))
-	for i, shortlink := range shortlinks {
-		shortlinkResponses[i] = shortlink.ToResponse(s.config.Server.BaseURL)
+	n := len(shortlinks)
+	shortlinks = shortlinks[:min(n, list.limit)]
+
+	items := make([]fiber.Map, len(shortlinks))
+	for i := range shortlinks {
+		items[i] = shortlinks[i].ToResponse(s.config.Server.BaseURL)
 	}
 
-	return c.JSON(fiber.Map{
-		"shortlinks": shortlinkResponses,
-		"total":      total,
-		"page":       page,
-		"limit":      limit,
-	})
+	return c.JSON(list.response(items, n, total, func() (any, string) {
+		last := shortlinks[len(shortlinks)-1]
+		if list.sort == "title" {
+			return last.Title, last.ID
+		}
+		return last.CreatedAt, last.ID
+	}))
 }
 
 // UpdateExpiration updates a URL's expiration time
@@ -148,7 +284,7 @@ func (s *URLService) UpdateExpiration(c *fiber.Ctx) error {
 	}
 
 	shortlinkID := c.Params("id")
-	shortlink, err := s.FindShortlink(shortlinkID)
+	shortlink, err := s.findShortlink(shortlinkID)
 	if err != nil {
 		return err
 	}
@@ -162,17 +298,144 @@ func (s *URLService) UpdateExpiration(c *fiber.Ctx) error {
 	expiryTime := time.Now().Add(expiry)
 	shortlink.ExpiresAt = &expiryTime
 
-	if err := s.db.Save(shortlink).Error; err != nil {
+	if err := s.db.Model(shortlink).UpdateColumn("expires_at", shortlink.ExpiresAt).Error; err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update expiration")
 	}
 
 	return c.JSON(shortlink.ToResponse(s.config.Server.BaseURL))
 }
 
+// Update edits the target URL, title and tags of a shortlink owned by the API key.
+// Changes of the target URL or title are recorded in the shortlink's history.
+func (s *URLService) Update(c *fiber.Ctx) error {
+	shortlink, err := s.findOwnedShortlink(c, "edit")
+	if err != nil {
+		return err
+	}
+
+	req := new(UpdateShortlinkRequest)
+	if err := c.BodyParser(req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if err := normalizeDetails(req.Title, nil, req.Tags); err != nil {
+		return err
+	}
+
+	targetURL, title := shortlink.TargetURL, shortlink.Title
+	if req.URL != nil {
+		if err := validateTargetURL(*req.URL); err != nil {
+			return err
+		}
+		targetURL = *req.URL
+	}
+	if req.Title != nil {
+		title = *req.Title
+	}
+	if req.Tags != nil {
+		shortlink.Tags = *req.Tags
+	}
+	if req.Rules != nil {
+		if shortlink.Rules, err = normalizeRules(*req.Rules); err != nil {
+			return err
+		}
+	}
+	if req.Variants != nil {
+		if shortlink.Variants, err = normalizeVariants(*req.Variants); err != nil {
+			return err
+		}
+	}
+	if req.Interstitial != nil {
+		shortlink.Interstitial = *req.Interstitial
+	}
+	if req.RedirectStatus != nil {
+		if err := validateRedirectStatus(*req.RedirectStatus); err != nil {
+			return err
+		}
+		shortlink.RedirectStatus = *req.RedirectStatus
+	}
+	if req.Passthrough != nil {
+		shortlink.Passthrough = *req.Passthrough
+	}
+	if req.UTM != nil {
+		if shortlink.UTM, err = normalizeUTM(*req.UTM); err != nil {
+			return err
+		}
+	}
+	if err := setRestrictions(shortlink, req.Password, req.MaxClicks, req.NotBefore, req.NotAfter); err != nil {
+		return err
+	}
+	if err := s.checkDestinations(shortlink, targetURL); err != nil {
+		return err
+	}
+
+	if err := s.saveChange(shortlink, targetURL, title, models.ShortlinkChangeEdit); err != nil {
+		return err
+	}
+
+	return c.JSON(shortlink.ToResponse(s.config.Server.BaseURL))
+}
+
+// History lists the changes made to a shortlink, newest first
+func (s *URLService) History(c *fiber.Ctx) error {
+	shortlink, err := s.findOwnedShortlink(c, "view")
+	if err != nil {
+		return err
+	}
+
+	var changes []models.ShortlinkChange
+	if err := s.db.Where("shortlink_id = ?", shortlink.ID).Order("id DESC").Find(&changes).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load shortlink history")
+	}
+
+	items := make([]fiber.Map, len(changes))
+	for i := range changes {
+		items[i] = changes[i].ToResponse()
+	}
+
+	response := shortlink.ToResponse(s.config.Server.BaseURL)
+	response["changes"] = items
+	return c.JSON(response)
+}
+
+// Rollback restores the target URL and title a shortlink had before one of its
+// changes. The rollback is itself recorded, so it can be undone too.
+func (s *URLService) Rollback(c *fiber.Ctx) error {
+	shortlink, err := s.findOwnedShortlink(c, "edit")
+	if err != nil {
+		return err
+	}
+
+	req := new(RollbackShortlinkRequest)
+	if err := c.BodyParser(req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.ChangeID == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "change_id is required")
+	}
+
+	var change models.ShortlinkChange
+	err = s.db.Where("id = ? AND shortlink_id = ?", req.ChangeID, shortlink.ID).First(&change).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "Change not found")
+		}
+		return err
+	}
+
+	if err := s.checkDestinations(shortlink, change.PreviousURL); err != nil {
+		return err
+	}
+	if err := s.saveChange(shortlink, change.PreviousURL, change.PreviousTitle, models.ShortlinkChangeRollback); err != nil {
+		return err
+	}
+
+	return c.JSON(shortlink.ToResponse(s.config.Server.BaseURL))
+}
+
 // Delete deletes a URL (requires API key ownership)
 func (s *URLService) Delete(c *fiber.Ctx) error {
 	shortlinkID := c.Params("id")
-	shortlink, err := s.FindShortlink(shortlinkID)
+	shortlink, err := s.findShortlink(shortlinkID)
 	if err != nil {
 		return err
 	}
@@ -189,6 +452,70 @@ func (s *URLService) Delete(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// HasDeleteKey reports whether key is the deletion key of a shortlink
+func (s *URLService) HasDeleteKey(id, key string) bool {
+	shortlink, err := s.findShortlink(id)
+	if err != nil || shortlink.DeleteKey == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(shortlink.DeleteKey), []byte(key)) == 1
+}
+
+// DeleteWithKey deletes a shortlink using the deletion key from its delete URL, so
+// shortlinks created without an API key can be removed too. GET requests only confirm.
+func (s *URLService) DeleteWithKey(c *fiber.Ctx, id string) error {
+	key := c.Params("key")
+	if key == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Deletion key is required")
+	}
+
+	shortlink, err := s.findShortlink(id)
+	if err != nil {
+		return err
+	}
+
+	if !s.HasDeleteKey(shortlink.ID, key) {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid deletion key")
+	}
+
+	// For DELETE requests, delete the shortlink
+	if c.Method() == fiber.MethodDelete {
+		if err := s.db.Delete(shortlink).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete shortlink")
+		}
+
+		if strings.Contains(c.Get("Accept"), "application/json") {
+			return c.JSON(fiber.Map{
+				"message": "Shortlink deleted successfully",
+				"id":      shortlink.ID,
+			})
+		}
+
+		return c.Render("delete_success", fiber.Map{
+			"isDeleteSuccess": true,
+			"baseUrl":         s.config.Server.BaseURL,
+			"kind":            "shortlink",
+			"title":           "Shortlink",
+		}, "layouts/main")
+	}
+
+	// For GET requests, show a confirmation page
+	if strings.Contains(c.Get("Accept"), "application/json") {
+		return c.JSON(fiber.Map{
+			"message": "Shortlink found and will be deleted",
+			"id":      shortlink.ID,
+		})
+	}
+
+	return c.Render("delete_confirm", fiber.Map{
+		"isDeleteConfirm": true,
+		"baseUrl":         s.config.Server.BaseURL,
+		"kind":            "shortlink",
+		"title":           "Shortlink",
+		"deleteUrl":       fmt.Sprintf("%s/u/%s/%s", s.config.Server.BaseURL, shortlink.ID, key),
+	}, "layouts/main")
+}
+
 // CleanupExpired removes expired shortlinks
 func (s *URLService) CleanupExpired() (int64, error) {
 	result := s.db.Where("expires_at < ? AND expires_at IS NOT NULL", time.Now()).Delete(&models.Shortlink{})
@@ -201,15 +528,61 @@ func (s *URLService) CleanupExpired() (int64, error) {
 // Helper functions
 
 func (s *URLService) createShortlink(apiKey *models.APIKey, opts *ShortlinkOptions) (*models.Shortlink, error) {
+	shortlink, err := s.prepareShortlink(apiKey, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.saveShortlink(s.db, apiKey, shortlink, opts.Slug != ""); err != nil {
+		return nil, err
+	}
+
+	return shortlink, nil
+}
+
+// prepareShortlink validates the options and builds a shortlink, fetching the page title
+// if none was given. Nothing is written, so the network work stays outside any transaction.
+func (s *URLService) prepareShortlink(apiKey *models.APIKey, opts *ShortlinkOptions) (*models.Shortlink, error) {
 	// Check if the URL is empty
 	if opts.URL == "" {
 		return nil, fiber.NewError(fiber.StatusBadRequest, "URL cannot be empty")
 	}
 
-	// Validate URL
-	parsedURL, err := url.Parse(opts.URL)
-	if err != nil || !parsedURL.IsAbs() || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
-		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid URL. Must be a valid absolute HTTP(S) URL")
+	if err := validateTargetURL(opts.URL); err != nil {
+		return nil, err
+	}
+
+	tags, err := opts.Tags.Normalize()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid tags: "+err.Error())
+	}
+
+	rules, err := normalizeRules(opts.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := normalizeVariants(opts.Variants)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateRedirectStatus(opts.RedirectStatus); err != nil {
+		return nil, err
+	}
+
+	utm, err := normalizeUTM(opts.UTM)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the custom slug before doing any network work
+	var id string
+	if opts.Slug != "" {
+		id, err = resolveSlug(s.db, apiKey, opts.Slug, &models.Shortlink{})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if opts.Title == "" {
@@ -226,9 +599,27 @@ func (s *URLService) createShortlink(apiKey *models.APIKey, opts *ShortlinkOptio
 	}
 
 	shortlink := &models.Shortlink{
-		TargetURL: opts.URL,
-		Title:     opts.Title,
-		APIKey:    apiKey.Key,
+		ID:             id,
+		TargetURL:      opts.URL,
+		Title:          opts.Title,
+		Tags:           tags,
+		Rules:          rules,
+		Variants:       variants,
+		Interstitial:   opts.Interstitial,
+		RedirectStatus: opts.RedirectStatus,
+		Passthrough:    opts.Passthrough,
+		UTM:            utm,
+	}
+	if apiKey != nil {
+		shortlink.APIKey = apiKey.Key
+	}
+
+	if err := setRestrictions(shortlink, &opts.Password, &opts.MaxClicks, &opts.NotBefore, &opts.NotAfter); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkDestinations(shortlink, shortlink.TargetURL); err != nil {
+		return nil, err
 	}
 
 	if opts.ExpiresIn != nil {
@@ -236,15 +627,561 @@ func (s *URLService) createShortlink(apiKey *models.APIKey, opts *ShortlinkOptio
 		shortlink.ExpiresAt = &expiryTime
 	}
 
-	if err := s.db.Create(shortlink).Error; err != nil {
-		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to create shortlink")
+	return shortlink, nil
+}
+
+// saveShortlink inserts a prepared shortlink using the given database handle, enforcing
+// the API key's shortlink quota
+func (s *URLService) saveShortlink(db *gorm.DB, apiKey *models.APIKey, shortlink *models.Shortlink, customSlug bool) error {
+	if apiKey != nil && apiKey.ShortlinkQuota > 0 {
+		var count int64
+		if err := db.Model(&models.Shortlink{}).Where("api_key = ?", apiKey.Key).Count(&count).Error; err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to check shortlink quota")
+		}
+		if count >= int64(apiKey.ShortlinkQuota) {
+			return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("Shortlink quota of %d reached", apiKey.ShortlinkQuota))
+		}
+	}
+
+	if err := createWithGeneratedID(db, shortlink, &shortlink.ID, s.config.IDs.Shortlink, models.ShortlinkIDLength); err != nil {
+		if customSlug && errors.Is(err, gorm.ErrDuplicatedKey) {
+			return slugTakenError(shortlink.ID)
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create shortlink")
+	}
+
+	return nil
+}
+
+// editableColumns are the shortlink columns saveChange writes. Counters such as clicks
+// and the link check state are updated while the edit is in flight, so saving the
+// whole row would overwrite them with stale values.
+var editableColumns = []string{
+	"target_url", "title", "tags", "rules", "variants", "interstitial", "redirect_status",
+	"passthrough", "utm", "password_hash", "max_clicks", "not_before", "not_after", "updated_at",
+}
+
+// checkColumns hold the link check state, which is reset when the target URL changes
+var checkColumns = []string{"checks", "check_failures", "broken", "next_check_at"}
+
+// saveChange saves a shortlink with a new target URL and title, recording the change
+// in its history if either of them differs
+func (s *URLService) saveChange(shortlink *models.Shortlink, targetURL, title, kind string) error {
+	change := &models.ShortlinkChange{
+		ShortlinkID:   shortlink.ID,
+		Kind:          kind,
+		PreviousURL:   shortlink.TargetURL,
+		TargetURL:     targetURL,
+		PreviousTitle: shortlink.Title,
+		Title:         title,
+	}
+	columns := editableColumns
+	if targetURL != shortlink.TargetURL {
+		shortlink.ResetChecks()
+		columns = append(slices.Clip(columns), checkColumns...)
 	}
+	shortlink.TargetURL = targetURL
+	shortlink.Title = title
 
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(shortlink).Select(columns).Updates(shortlink).Error; err != nil {
+			return err
+		}
+		if change.PreviousURL == change.TargetURL && change.PreviousTitle == change.Title {
+			return nil
+		}
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update shortlink")
+	}
+	return nil
+}
+
+// findOwnedShortlink retrieves the shortlink named in the route, making sure it belongs
+// to the requesting API key
+func (s *URLService) findOwnedShortlink(c *fiber.Ctx, action string) (*models.Shortlink, error) {
+	shortlink, err := s.findShortlink(c.Params("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := c.Locals("apiKey").(*models.APIKey)
+	if shortlink.APIKey != apiKey.Key {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Not authorized to "+action+" this shortlink")
+	}
 	return shortlink, nil
 }
 
-// FindShortlink retrieves a shortlink by ID with expiry checking
+// validateTargetURL checks that a shortlink target is an absolute HTTP(S) URL
+func validateTargetURL(target string) error {
+	if target == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "URL cannot be empty")
+	}
+
+	parsedURL, err := url.Parse(target)
+	if err != nil || !parsedURL.IsAbs() || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid URL. Must be a valid absolute HTTP(S) URL")
+	}
+	return nil
+}
+
+// normalizeRules checks the routing rules of a shortlink, including their target URLs
+func normalizeRules(rules models.ShortlinkRules) (models.ShortlinkRules, error) {
+	rules, err := rules.Normalize()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid rules: "+err.Error())
+	}
+	for i, rule := range rules {
+		if err := validateTargetURL(rule.URL); err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid rules: rule %d: invalid URL", i+1))
+		}
+	}
+	return rules, nil
+}
+
+// QR responds with a QR code of the short URL. Used up or restricted shortlinks still
+// get one, since the code only carries the short URL.
+func (s *URLService) QR(c *fiber.Ctx, id string) error {
+	shortlink, err := s.findShortlink(id)
+	if err != nil {
+		return err
+	}
+	return renderQR(c, s.shortURL(shortlink))
+}
+
+// Preview shows where a shortlink leads without redirecting. Browsers get a page, other
+// clients JSON. Nothing only the owner should see, like the delete URL, is included.
+func (s *URLService) Preview(c *fiber.Ctx, id string) error {
+	shortlink, err := s.FindShortlink(id)
+	if err != nil {
+		return err
+	}
+	if !s.Unlocked(c, shortlink) {
+		return s.RenderPasswordPrompt(c, shortlink)
+	}
+
+	var clicks int64
+	err = s.db.Model(&models.AnalyticsEvent{}).
+		Where("event_type = ? AND resource_id = ?", models.EventShortlinkClick, shortlink.ID).
+		Count(&clicks).Error
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(c.Get("Accept"), "application/xhtml+xml") {
+		return c.JSON(fiber.Map{
+			"id":          shortlink.ID,
+			"url":         shortlink.TargetURL,
+			"title":       shortlink.Title,
+			"tags":        shortlink.Tags,
+			"conditional": isConditional(shortlink),
+			"clicks":      clicks,
+			"created_at":  shortlink.CreatedAt,
+			"expires_at":  shortlink.ExpiresAt,
+			"short_url":   s.shortURL(shortlink),
+		})
+	}
+
+	return s.renderShortlink(c, shortlink, fiber.Map{"clicks": clicks})
+}
+
+// NeedsInterstitial reports whether visitors have to confirm the destination of a
+// shortlink before they're sent there, either because its owner asked for it or
+// because the instance warns about links from new keys
+func (s *URLService) NeedsInterstitial(shortlink *models.Shortlink) bool {
+	if shortlink.Interstitial {
+		return true
+	}
+
+	switch s.config.Server.Shortlinks.Interstitial {
+	case interstitialAll:
+		return true
+	case interstitialNewKeys:
+		if shortlink.APIKey == "" {
+			return true
+		}
+		var apiKey models.APIKey
+		if err := s.db.Select("created_at").Where("key = ?", shortlink.APIKey).First(&apiKey).Error; err != nil {
+			return true
+		}
+		return time.Since(apiKey.CreatedAt) < s.config.Server.Shortlinks.NewKeyAge
+	}
+	return false
+}
+
+// RenderInterstitial shows the warning page for a shortlink. Continuing from it goes
+// through the redirect again, with confirm set, so the click is counted as usual. For
+// password protected shortlinks the password entered on the prompt is posted along.
+func (s *URLService) RenderInterstitial(c *fiber.Ctx, shortlink *models.Shortlink) error {
+	continueURL := strings.TrimSuffix(s.config.Server.BaseURL, "/") + c.OriginalURL()
+	if strings.Contains(continueURL, "?") {
+		continueURL += "&confirm=1"
+	} else {
+		continueURL += "?confirm=1"
+	}
+
+	data := fiber.Map{
+		"interstitial": true,
+		"continueUrl":  continueURL,
+	}
+	if shortlink.HasPassword() {
+		data["password"] = ShortlinkPassword(c)
+	}
+	return s.renderShortlink(c, shortlink, data)
+}
+
+// Unlocked reports whether the visitor gave the password of a protected shortlink.
+// Shortlinks without a password are always unlocked.
+func (s *URLService) Unlocked(c *fiber.Ctx, shortlink *models.Shortlink) bool {
+	if !shortlink.HasPassword() {
+		return true
+	}
+	password := ShortlinkPassword(c)
+	if password == "" {
+		return false
+	}
+	if !shortlink.CheckPassword(password) {
+		// Counted by the rate limiter against the visitor's IP
+		c.Locals("wrongPassword", true)
+		return false
+	}
+	return true
+}
+
+// RenderPasswordPrompt asks for the password of a protected shortlink. Browsers get a
+// form that posts back to the same URL, other clients a 401 pointing at the header.
+func (s *URLService) RenderPasswordPrompt(c *fiber.Ctx, shortlink *models.Shortlink) error {
+	wrong := ShortlinkPassword(c) != ""
+
+	if !strings.Contains(c.Get("Accept"), "application/xhtml+xml") {
+		if wrong {
+			return fiber.NewError(fiber.StatusUnauthorized, "Wrong password")
+		}
+		return fiber.NewError(fiber.StatusUnauthorized, "Password required, send it in the "+shortlinkPasswordHeader+" header")
+	}
+
+	return c.Status(fiber.StatusUnauthorized).Render("shortlink_password", fiber.Map{
+		"baseUrl":  s.config.Server.BaseURL,
+		"shortUrl": s.shortURL(shortlink),
+		"action":   strings.TrimSuffix(s.config.Server.BaseURL, "/") + c.OriginalURL(),
+		"wrong":    wrong,
+	}, "layouts/main")
+}
+
+// ShortlinkPassword returns the password the visitor sent for a shortlink, either in the
+// header or posted from the prompt page
+func ShortlinkPassword(c *fiber.Ctx) string {
+	if password := c.Get(shortlinkPasswordHeader); password != "" {
+		return password
+	}
+	if c.Method() == fiber.MethodPost {
+		return c.FormValue("password")
+	}
+	return ""
+}
+
+// renderShortlink renders the page describing a shortlink, used by both the preview
+// and the interstitial
+func (s *URLService) renderShortlink(c *fiber.Ctx, shortlink *models.Shortlink, data fiber.Map) error {
+	data["baseUrl"] = s.config.Server.BaseURL
+	data["id"] = shortlink.ID
+	data["shortUrl"] = s.shortURL(shortlink)
+	data["url"] = shortlink.TargetURL
+	data["title"] = shortlink.Title
+	data["tags"] = shortlink.Tags
+	data["conditional"] = isConditional(shortlink)
+	data["created"] = shortlink.CreatedAt.Format("2006-01-02 15:04:05")
+	data["expires"] = formatExpiryTime(shortlink.ExpiresAt)
+	data["ogTitle"] = cmp.Or(shortlink.Title, shortlink.TargetURL)
+	data["ogDescription"] = "Short link to " + shortlink.TargetURL
+	return c.Render("shortlink", data, "layouts/main")
+}
+
+// shortURL returns the public URL of a shortlink
+func (s *URLService) shortURL(shortlink *models.Shortlink) string {
+	return strings.TrimSuffix(s.config.Server.BaseURL, "/") + "/u/" + shortlink.ID
+}
+
+// isConditional reports whether some visitors of a shortlink are sent somewhere other
+// than its target URL
+func isConditional(shortlink *models.Shortlink) bool {
+	return len(shortlink.Rules) > 0 || len(shortlink.Variants) > 0
+}
+
+// Target returns the URL a visitor of the shortlink is sent to, with the visitor's path
+// suffix and query string forwarded if the shortlink passes them through, and its UTM
+// parameters added. The name of the split test variant is returned as well when one
+// was picked.
+func (s *URLService) Target(c *fiber.Ctx, shortlink *models.Shortlink) (string, string) {
+	target, variant := s.destination(c, shortlink)
+	if !shortlink.Passthrough && shortlink.UTM.IsZero() {
+		return target, variant
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return target, variant
+	}
+	query := u.Query()
+
+	if shortlink.Passthrough {
+		if suffix, err := url.PathUnescape(c.Params("*")); err == nil && suffix != "" {
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/" + suffix
+			u.RawPath = ""
+		}
+
+		// Parameters of the visitor replace those of the target with the same name
+		incoming, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+		incoming.Del("confirm")
+		for name, values := range incoming {
+			query[name] = values
+		}
+	}
+
+	var referrer string
+	if ref, err := url.Parse(c.Get(fiber.HeaderReferer)); err == nil {
+		referrer = ref.Hostname()
+	}
+	shortlink.UTM.Apply(query, models.UTMContext{
+		ID:       shortlink.ID,
+		Variant:  variant,
+		Referrer: referrer,
+		Time:     time.Now(),
+	})
+
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), variant
+}
+
+// destination picks where a visitor of the shortlink goes: the URL of its first routing
+// rule matching the request, else its split test variant for the visitor, else its
+// target URL
+func (s *URLService) destination(c *fiber.Ctx, shortlink *models.Shortlink) (string, string) {
+	if len(shortlink.Rules) > 0 {
+		visitor := &models.RedirectVisitor{
+			UserAgent: useragent.Parse(c.Get(fiber.HeaderUserAgent)),
+			Languages: models.ParseAcceptLanguage(c.Get(fiber.HeaderAcceptLanguage)),
+			Time:      time.Now(),
+		}
+		if shortlink.Rules.NeedsCountry() {
+			visitor.Country = s.geoip.Country(c.IP())
+		}
+
+		if target, ok := shortlink.Rules.Match(visitor); ok {
+			return target, ""
+		}
+	}
+
+	if variant := s.assignVariant(c, shortlink); variant != nil {
+		return variant.URL, variant.Name
+	}
+	return shortlink.TargetURL, ""
+}
+
+// assignVariant picks the split test variant for a visitor. Visitors keep the variant
+// stored in their cookie; new visitors are assigned by a hash of their IP address, so
+// they land on the same variant even if they don't keep cookies.
+func (s *URLService) assignVariant(c *fiber.Ctx, shortlink *models.Shortlink) *models.ShortlinkVariant {
+	if len(shortlink.Variants) == 0 {
+		return nil
+	}
+
+	cookie := variantCookiePrefix + shortlink.ID
+	if variant := shortlink.Variants.Find(c.Cookies(cookie)); variant != nil {
+		return variant
+	}
+
+	variant := shortlink.Variants.Pick(shortlink.ID + "|" + c.IP())
+	if variant != nil {
+		c.Cookie(&fiber.Cookie{
+			Name:     cookie,
+			Value:    variant.Name,
+			Path:     "/u/" + shortlink.ID,
+			MaxAge:   int(variantCookieMaxAge / time.Second),
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+		})
+	}
+	return variant
+}
+
+// checkDestinations refuses to send visitors of a shortlink anywhere the operator's
+// blocklists name: the target URL, or the URL of any of its rules or variants.
+// Shortlinks of trusted API keys aren't checked.
+func (s *URLService) checkDestinations(shortlink *models.Shortlink, targetURL string) error {
+	if s.reputation.Trusted(shortlink.APIKey) {
+		return nil
+	}
+
+	destinations := []string{targetURL}
+	for _, rule := range shortlink.Rules {
+		destinations = append(destinations, rule.URL)
+	}
+	for _, variant := range shortlink.Variants {
+		destinations = append(destinations, variant.URL)
+	}
+
+	for _, destination := range destinations {
+		if s.blocked(destination) {
+			return errDestinationBlocked
+		}
+	}
+	return nil
+}
+
+// Blocked reports whether a visitor of a shortlink may not be sent on to the target.
+// Destinations are checked when shortlinks are saved; checking them on every redirect
+// as well, if the operator asks for it, catches links saved before a list was updated.
+// Anonymous shortlinks are always checked again.
+func (s *URLService) Blocked(shortlink *models.Shortlink, target string) bool {
+	if shortlink.APIKey != "" && !s.config.Server.Shortlinks.Reputation.CheckRedirects {
+		return false
+	}
+	if s.reputation.Trusted(shortlink.APIKey) {
+		return false
+	}
+	return s.blocked(target)
+}
+
+// blocked looks a destination up in the blocklists, logging what matched
+func (s *URLService) blocked(destination string) bool {
+	verdict := s.reputation.Check(destination)
+	if verdict == nil {
+		return false
+	}
+	s.logger.Warn("blocked shortlink destination",
+		zap.String("url", destination),
+		zap.String("list", verdict.Source),
+		zap.String("match", verdict.Match))
+	return true
+}
+
+// validateRedirectStatus checks that a shortlink redirects with a redirect status that
+// keeps working for links, 0 picking the default
+func validateRedirectStatus(status int) error {
+	switch status {
+	case 0, fiber.StatusMovedPermanently, fiber.StatusFound, fiber.StatusTemporaryRedirect, fiber.StatusPermanentRedirect:
+		return nil
+	}
+	return fiber.NewError(fiber.StatusBadRequest, "Invalid redirect_status. Must be 301, 302, 307 or 308")
+}
+
+// normalizeUTM checks the UTM parameter templates of a shortlink
+func normalizeUTM(utm models.UTMParams) (models.UTMParams, error) {
+	utm, err := utm.Normalize()
+	if err != nil {
+		return models.UTMParams{}, fiber.NewError(fiber.StatusBadRequest, "Invalid utm: "+err.Error())
+	}
+	return utm, nil
+}
+
+// normalizeVariants checks the split test variants of a shortlink, including their target URLs
+func normalizeVariants(variants models.ShortlinkVariants) (models.ShortlinkVariants, error) {
+	variants, err := variants.Normalize()
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid variants: "+err.Error())
+	}
+	for _, variant := range variants {
+		if err := validateTargetURL(variant.URL); err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid variants: variant %q: invalid URL", variant.Name))
+		}
+	}
+	return variants, nil
+}
+
+// setRestrictions applies the password, click limit and activation window of a create
+// or edit request to a shortlink. Nil values are left unchanged.
+func setRestrictions(shortlink *models.Shortlink, password *string, maxClicks *int, notBefore, notAfter *string) error {
+	if password != nil {
+		if len(*password) > maxShortlinkPasswordLength {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Password must be at most %d bytes", maxShortlinkPasswordLength))
+		}
+		if err := shortlink.SetPassword(*password); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to hash password")
+		}
+	}
+
+	if maxClicks != nil {
+		if *maxClicks < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "max_clicks cannot be negative")
+		}
+		shortlink.MaxClicks = *maxClicks
+	}
+
+	var err error
+	if notBefore != nil {
+		if shortlink.NotBefore, err = parseActivationTime("not_before", *notBefore); err != nil {
+			return err
+		}
+	}
+	if notAfter != nil {
+		if shortlink.NotAfter, err = parseActivationTime("not_after", *notAfter); err != nil {
+			return err
+		}
+	}
+	if shortlink.NotBefore != nil && shortlink.NotAfter != nil && !shortlink.NotAfter.After(*shortlink.NotBefore) {
+		return fiber.NewError(fiber.StatusBadRequest, "not_after must be later than not_before")
+	}
+	return nil
+}
+
+// parseActivationTime reads one end of a shortlink's activation window, an empty value
+// leaving that end open
+func parseActivationTime(name, raw string) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := parseQueryTime(raw)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid "+name+". Must be an RFC 3339 time or a date")
+	}
+	return &t, nil
+}
+
+// CountClick counts a redirect against the click limit of a shortlink, failing once the
+// limit is used up. Checking and counting is one statement, so visitors arriving at the
+// same time can't go over the limit.
+func (s *URLService) CountClick(shortlink *models.Shortlink) error {
+	result := s.db.Model(&models.Shortlink{}).
+		Where("id = ? AND (max_clicks = 0 OR clicks < max_clicks)", shortlink.ID).
+		UpdateColumn("clicks", gorm.Expr("clicks + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errShortlinkExhausted
+	}
+	shortlink.Clicks++
+	return nil
+}
+
+// FindShortlink retrieves a shortlink visitors can follow. Links that used up their
+// clicks or whose activation window has passed are gone, links whose window hasn't
+// started yet can't be followed yet.
 func (s *URLService) FindShortlink(id string) (*models.Shortlink, error) {
+	shortlink, err := s.findShortlink(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch {
+	case shortlink.Exhausted():
+		return nil, errShortlinkExhausted
+	case shortlink.NotAfter != nil && !now.Before(*shortlink.NotAfter):
+		return nil, fiber.NewError(fiber.StatusGone, "Shortlink is no longer active")
+	case shortlink.NotBefore != nil && now.Before(*shortlink.NotBefore):
+		return nil, fiber.NewError(fiber.StatusForbidden, "Shortlink is not active yet")
+	}
+	return shortlink, nil
+}
+
+// findShortlink retrieves a shortlink by ID with expiry checking, whether or not
+// visitors can follow it. Used by the owner's management routes.
+func (s *URLService) findShortlink(id string) (*models.Shortlink, error) {
 	var shortlink models.Shortlink
 	err := s.db.Where("id = ? AND (expires_at IS NULL OR expires_at > ?)", id, time.Now()).First(&shortlink).Error
 	if err != nil {
@@ -256,12 +1193,9 @@ func (s *URLService) FindShortlink(id string) (*models.Shortlink, error) {
 	return &shortlink, nil
 }
 
+// fetchURLTitle reads the <title> of an HTML page, looking at no more than maxTitleScan bytes
 func (s *URLService) fetchURLTitle(url string) (string, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	resp, err := client.Get(url)
+	resp, err := s.fetcher.Open(context.Background(), url)
 	if err != nil {
 		return "", err
 	}
@@ -272,7 +1206,7 @@ func (s *URLService) fetchURLTitle(url string) (string, error) {
 		return "", nil
 	}
 
-	tokenizer := html.NewTokenizer(resp.Body)
+	tokenizer := html.NewTokenizer(io.LimitReader(resp.Body, maxTitleScan))
 	for {
 		tokenType := tokenizer.Next()
 		switch tokenType {
@@ -0,0 +1,173 @@
+// Package smtpd receives email and turns it into pastes:
+//
+//	mail -A notes.txt x8k2...@paste.example.com < /dev/null
+//
+// The local part of the recipient is the inbound token of an API key (see
+// GET /keys/inbound). Every attachment becomes a paste, or the body does when
+// there are none, and the paste URLs are mailed back to the sender.
+package smtpd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/server/services"
+	"go.uber.org/zap"
+)
+
+// defaultMaxMessageSize is used when the inbound section of the config is left empty
+const defaultMaxMessageSize = 25 << 20
+
+// RateLimiter is satisfied by the server's HTTP rate limiter, so senders share its limits
+type RateLimiter interface {
+	Check(ip string) error
+}
+
+// Server is an embedded SMTP receiver for inbound pastes
+type Server struct {
+	logger  *zap.Logger
+	config  *config.Config
+	inbound *services.InboundService
+	limiter RateLimiter
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closed   bool
+}
+
+func NewServer(logger *zap.Logger, config *config.Config, inbound *services.InboundService, limiter RateLimiter) *Server {
+	return &Server{
+		logger:  logger,
+		config:  config,
+		inbound: inbound,
+		limiter: limiter,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen binds the configured address. Connections are accepted once Serve is called.
+func (s *Server) Listen() error {
+	ln, err := net.Listen("tcp", s.config.SMTP.Inbound.Address)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+	return nil
+}
+
+// Addr returns the address the server is bound to
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Serve accepts connections until Shutdown is called
+func (s *Server) Serve() error {
+	s.mu.Lock()
+	ln := s.listener
+	s.mu.Unlock()
+	if ln == nil {
+		return errors.New("smtpd: Serve called before Listen")
+	}
+
+	s.logger.Info("smtp server started", zap.String("address", ln.Addr().String()))
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+
+		go func() {
+			defer s.untrack(conn)
+			newSession(s, conn).serve()
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and waits for active sessions to finish.
+// Connections still open when ctx is done are closed forcibly.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (s *Server) maxMessageSize() int64 {
+	if s.config.SMTP.Inbound.MaxMessageSize > 0 {
+		return int64(s.config.SMTP.Inbound.MaxMessageSize)
+	}
+	return defaultMaxMessageSize
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// track registers an active connection, refusing it once shutdown has begun
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.wg.Done()
+}
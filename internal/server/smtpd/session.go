@@ -0,0 +1,316 @@
+package smtpd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// commandTimeout bounds how long the server waits for the next command (RFC 5321 4.5.3.2.7)
+	commandTimeout = 5 * time.Minute
+
+	// dataTimeout bounds how long a client may take to transfer a message
+	dataTimeout = 10 * time.Minute
+
+	// maxLineLength is the longest command line accepted, including CRLF (RFC 5321 4.5.3.1.4)
+	maxLineLength = 512
+
+	// maxErrors is the number of bad commands tolerated before the connection is dropped
+	maxErrors = 10
+)
+
+// errLineTooLong is returned when a command line exceeds maxLineLength
+var errLineTooLong = errors.New("line too long")
+
+// session holds the state of a single SMTP connection
+type session struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *textproto.Writer
+	ip     string
+	errors int
+
+	greeted bool
+	from    string
+	hasFrom bool
+	apiKey  *models.APIKey // the recipient; set once RCPT succeeds
+}
+
+func newSession(server *Server, conn net.Conn) *session {
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		ip = conn.RemoteAddr().String()
+	}
+
+	return &session{
+		server: server,
+		conn:   conn,
+		reader: bufio.NewReaderSize(conn, maxLineLength),
+		writer: textproto.NewWriter(bufio.NewWriter(conn)),
+		ip:     ip,
+	}
+}
+
+// serve runs the command loop until the client quits or misbehaves
+func (sess *session) serve() {
+	defer sess.conn.Close()
+
+	sess.reply(220, sess.server.inbound.Domain()+" ESMTP ready")
+
+	for {
+		_ = sess.conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := sess.readLine()
+		switch {
+		case errors.Is(err, errLineTooLong):
+			sess.fail(500, "Line too long")
+		case err != nil:
+			return
+		default:
+			verb, arg, _ := strings.Cut(line, " ")
+			if !sess.handle(strings.ToUpper(verb), strings.TrimSpace(arg)) {
+				return
+			}
+		}
+
+		if sess.errors >= maxErrors {
+			sess.reply(421, "Too many errors, closing connection")
+			return
+		}
+	}
+}
+
+// handle runs a single command, returning false when the connection should be closed
+func (sess *session) handle(verb, arg string) bool {
+	switch verb {
+	case "HELO":
+		sess.reset()
+		sess.greeted = true
+		sess.reply(250, sess.server.inbound.Domain())
+	case "EHLO":
+		sess.reset()
+		sess.greeted = true
+		sess.reply(250,
+			sess.server.inbound.Domain(),
+			fmt.Sprintf("SIZE %d", sess.server.maxMessageSize()),
+			"8BITMIME",
+			"PIPELINING")
+	case "MAIL":
+		sess.mail(arg)
+	case "RCPT":
+		sess.rcpt(arg)
+	case "DATA":
+		return sess.data()
+	case "RSET":
+		sess.reset()
+		sess.reply(250, "OK")
+	case "NOOP":
+		sess.reply(250, "OK")
+	case "VRFY":
+		sess.reply(252, "Cannot verify user, but will accept message")
+	case "QUIT":
+		sess.reply(221, "Bye")
+		return false
+	default:
+		sess.fail(502, "Command not implemented")
+	}
+	return true
+}
+
+func (sess *session) mail(arg string) {
+	if !sess.greeted {
+		sess.fail(503, "Send HELO or EHLO first")
+		return
+	}
+	if sess.hasFrom {
+		sess.fail(503, "Sender already specified")
+		return
+	}
+
+	path, params, ok := parsePath(arg, "FROM:")
+	if !ok {
+		sess.fail(501, "Syntax: MAIL FROM:<address>")
+		return
+	}
+
+	for _, param := range params {
+		key, value, _ := strings.Cut(param, "=")
+		if strings.EqualFold(key, "SIZE") {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				sess.fail(501, "Invalid SIZE parameter")
+				return
+			}
+			if size > sess.server.maxMessageSize() {
+				sess.fail(552, "Message exceeds maximum size")
+				return
+			}
+		}
+	}
+
+	sess.from = path
+	sess.hasFrom = true
+	sess.reply(250, "OK")
+}
+
+func (sess *session) rcpt(arg string) {
+	if !sess.hasFrom {
+		sess.fail(503, "Send MAIL first")
+		return
+	}
+	if sess.apiKey != nil {
+		sess.reply(452, "Too many recipients")
+		return
+	}
+
+	path, _, ok := parsePath(arg, "TO:")
+	if !ok || path == "" {
+		sess.fail(501, "Syntax: RCPT TO:<address>")
+		return
+	}
+
+	apiKey, err := sess.server.inbound.FindKeyByAddress(path)
+	if err != nil {
+		sess.server.logger.Error("failed to look up inbound address", zap.Error(err))
+		sess.reply(451, "Temporary failure, try again later")
+		return
+	}
+	if apiKey == nil {
+		sess.fail(550, "No such mailbox")
+		return
+	}
+
+	sess.apiKey = apiKey
+	sess.reply(250, "OK")
+}
+
+// data receives the message and creates its pastes
+func (sess *session) data() bool {
+	if sess.apiKey == nil {
+		sess.fail(503, "Send RCPT first")
+		return true
+	}
+
+	sess.reply(354, "End data with <CR><LF>.<CR><LF>")
+	_ = sess.conn.SetDeadline(time.Now().Add(dataTimeout))
+
+	// Read one byte past the limit so oversized messages can be told apart, then
+	// drain the rest so the connection stays in sync for the next command
+	limit := sess.server.maxMessageSize()
+	dot := textproto.NewReader(sess.reader).DotReader()
+	message, err := io.ReadAll(io.LimitReader(dot, limit+1))
+	if err == nil {
+		_, err = io.Copy(io.Discard, dot)
+	}
+	if err != nil {
+		return false
+	}
+
+	apiKey, from := sess.apiKey, sess.from
+	sess.reset()
+
+	if int64(len(message)) > limit {
+		sess.reply(552, "Message exceeds maximum size")
+		return true
+	}
+
+	if err := sess.server.limiter.Check(sess.ip); err != nil {
+		sess.reply(451, "Rate limit exceeded, try again later")
+		return true
+	}
+
+	pastes, err := sess.server.inbound.Receive(apiKey, from, message)
+	if err != nil {
+		var fe *fiber.Error
+		if errors.As(err, &fe) && fe.Code < fiber.StatusInternalServerError {
+			sess.reply(554, fe.Message)
+		} else {
+			sess.server.logger.Error("failed to create pastes from email", zap.Error(err))
+			sess.reply(451, "Failed to store message, try again later")
+		}
+		return true
+	}
+
+	sess.server.logger.Debug("created pastes from email",
+		zap.Int("pastes", len(pastes)),
+		zap.String("ip", sess.ip),
+		zap.Int("size", len(message)))
+
+	sess.reply(250, fmt.Sprintf("OK, %d paste(s) created", len(pastes)))
+	return true
+}
+
+// reset clears the mail transaction
+func (sess *session) reset() {
+	sess.from = ""
+	sess.hasFrom = false
+	sess.apiKey = nil
+}
+
+// reply writes a single or multiline response
+func (sess *session) reply(code int, lines ...string) {
+	for i, line := range lines {
+		sep := " "
+		if i < len(lines)-1 {
+			sep = "-"
+		}
+		if err := sess.writer.PrintfLine("%d%s%s", code, sep, line); err != nil {
+			return
+		}
+	}
+}
+
+// fail replies with an error caused by the client and counts it towards maxErrors
+func (sess *session) fail(code int, message string) {
+	sess.errors++
+	sess.reply(code, message)
+}
+
+// readLine reads a CRLF or LF terminated command line
+func (sess *session) readLine() (string, error) {
+	line, err := sess.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		// Skip the rest of the oversized line
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = sess.reader.ReadSlice('\n')
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// parsePath parses the argument of MAIL and RCPT, e.g. "FROM:<a@b.c> SIZE=123",
+// returning the address between the angle brackets and any ESMTP parameters
+func parsePath(arg, prefix string) (string, []string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", nil, false
+	}
+	end := strings.IndexByte(arg, '>')
+	if end < 0 {
+		return "", nil, false
+	}
+
+	return arg[1:end], strings.Fields(arg[end+1:]), true
+}
@@ -0,0 +1,372 @@
+// Package sshd serves pastes over SSH:
+//
+//	ssh -p 2222 host < file.log
+//	ssh -p 2222 host get abc12345
+//
+// Clients authenticate with public keys linked to an API key (see POST /keys/ssh),
+// getting that key's quotas and the right to list and delete their pastes. Other
+// keys are refused unless anonymous access is enabled, in which case they upload
+// anonymously.
+package sshd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/server/services"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// apiKeyExtension carries the linked API key from authentication to the session
+const apiKeyExtension = "api-key"
+
+// handshakeTimeout bounds how long a client may take to authenticate
+const handshakeTimeout = 30 * time.Second
+
+// Defaults used when the ssh section of the config is left empty
+const (
+	defaultIdleTimeout    = time.Minute
+	defaultTimeout        = 10 * time.Minute
+	defaultMaxConnections = 100
+)
+
+// RateLimiter is satisfied by the server's HTTP rate limiter, so SSH clients share its limits
+type RateLimiter interface {
+	Check(ip string) error
+}
+
+// Server is an embedded SSH server exposing paste commands
+type Server struct {
+	logger    *zap.Logger
+	config    *config.Config
+	services  *services.Services
+	limiter   RateLimiter
+	sshConfig *ssh.ServerConfig
+
+	// slots holds a token for every connection being handled, capping how many
+	// slow clients can tie up sockets and goroutines at once
+	slots chan struct{}
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	closed   bool
+}
+
+// NewServer creates an SSH server, loading the host key from the configured path
+// or generating one there if it doesn't exist yet
+func NewServer(logger *zap.Logger, config *config.Config, services *services.Services, limiter RateLimiter) (*Server, error) {
+	maxConnections := config.Server.SSH.MaxConnections
+	if maxConnections <= 0 {
+		maxConnections = defaultMaxConnections
+	}
+
+	s := &Server{
+		logger:   logger,
+		config:   config,
+		services: services,
+		limiter:  limiter,
+		slots:    make(chan struct{}, maxConnections),
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	hostKey, err := loadHostKey(config.Server.SSH.HostKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ssh host key: %w", err)
+	}
+
+	s.sshConfig = &ssh.ServerConfig{PublicKeyCallback: s.authenticate}
+	s.sshConfig.AddHostKey(hostKey)
+
+	return s, nil
+}
+
+// Listen binds the configured address. Connections are accepted once Serve is called.
+func (s *Server) Listen() error {
+	ln, err := net.Listen("tcp", s.config.Server.SSH.Address)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+	return nil
+}
+
+// Addr returns the address the server is bound to
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Serve accepts connections until Shutdown is called
+func (s *Server) Serve() error {
+	s.mu.Lock()
+	ln := s.listener
+	s.mu.Unlock()
+	if ln == nil {
+		return errors.New("sshd: Serve called before Listen")
+	}
+
+	s.logger.Info("ssh server started", zap.String("address", ln.Addr().String()))
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			s.logger.Debug("refused ssh connection, too many open",
+				zap.String("remote", conn.RemoteAddr().String()))
+			conn.Close()
+			continue
+		}
+
+		if !s.track(conn) {
+			<-s.slots
+			conn.Close()
+			return nil
+		}
+
+		go func() {
+			defer func() { <-s.slots }()
+			defer s.untrack(conn)
+			s.handleConn(conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and waits for active sessions to finish.
+// Connections still open when ctx is done are closed forcibly.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// authenticate accepts public keys linked to an API key, remembering the key. Unlinked
+// keys are only accepted when anonymous access is enabled.
+func (s *Server) authenticate(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	apiKey, err := s.services.APIKey.FindBySSHKey(key)
+	if err != nil {
+		s.logger.Error("failed to look up ssh key", zap.Error(err))
+		return nil, errors.New("authentication failed")
+	}
+	if apiKey == nil && !s.config.Server.SSH.Anonymous {
+		s.logger.Debug("rejected unlinked ssh key",
+			zap.String("fingerprint", ssh.FingerprintSHA256(key)),
+			zap.String("remote", meta.RemoteAddr().String()))
+		return nil, errors.New("public key is not linked to an API key")
+	}
+
+	perms := &ssh.Permissions{Extensions: map[string]string{}}
+	if apiKey != nil {
+		perms.Extensions[apiKeyExtension] = apiKey.Key
+	}
+	return perms, nil
+}
+
+// handleConn performs the handshake and serves the session channels of a connection.
+// The connection is closed once it has been quiet for the idle timeout, during the
+// handshake after handshakeTimeout, and in any case after the overall timeout.
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.timeout())
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		return
+	}
+	conn = &idleConn{Conn: conn, timeout: s.idleTimeout(), deadline: deadline}
+
+	handshake := time.AfterFunc(handshakeTimeout, func() { conn.Close() })
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.sshConfig)
+	handshake.Stop()
+	if err != nil {
+		s.logger.Debug("ssh handshake failed", zap.Error(err))
+		return
+	}
+	defer sconn.Close()
+
+	go ssh.DiscardRequests(reqs)
+
+	sess := &session{
+		server: s,
+		ip:     remoteIP(sconn.RemoteAddr()),
+	}
+	if key := sconn.Permissions.Extensions[apiKeyExtension]; key != "" {
+		sess.apiKey, err = s.services.APIKey.FindVerifiedKey(key)
+		if err != nil {
+			s.logger.Error("failed to load api key for ssh session", zap.Error(err))
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			s.logger.Debug("failed to accept ssh channel", zap.Error(err))
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sess.serve(channel, requests)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.config.Server.SSH.IdleTimeout > 0 {
+		return s.config.Server.SSH.IdleTimeout
+	}
+	return defaultIdleTimeout
+}
+
+func (s *Server) timeout() time.Duration {
+	if s.config.Server.SSH.Timeout > 0 {
+		return s.config.Server.SSH.Timeout
+	}
+	return defaultTimeout
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// track registers an active connection, refusing it once shutdown has begun
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// loadHostKey reads a PEM encoded private key, generating an ed25519 key if the file is missing
+func loadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ssh.ParsePrivateKey(data)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+
+	return ssh.NewSignerFromKey(priv)
+}
+
+// idleConn pushes the read deadline forward before every read, so connections end
+// after a pause in the client's traffic, but never past their overall deadline
+type idleConn struct {
+	net.Conn
+	timeout  time.Duration
+	deadline time.Time
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	next := time.Now().Add(c.timeout)
+	if next.After(c.deadline) {
+		next = c.deadline
+	}
+	if err := c.Conn.SetReadDeadline(next); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
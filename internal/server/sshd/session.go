@@ -0,0 +1,238 @@
+package sshd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gofiber/fiber/v2"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/services"
+	"github.com/watzon/hdur"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultListLimit is the number of pastes shown by the list command, and
+// maxListLimit the most it can be asked to show
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+const usage = `Usage:
+  ssh HOST < file                     Upload a paste (same as "upload")
+  ssh HOST upload [flags] [filename]  Upload a paste read from stdin
+      --expires DURATION              Expire the paste after e.g. 24h or 7d
+      --private                       Make the paste private (linked key required)
+  ssh HOST get ID                     Print the content of a paste
+  ssh HOST list [--limit N]           List up to 100 of your pastes (linked key required)
+  ssh HOST delete ID                  Delete one of your pastes (linked key required)
+  ssh HOST help                       Show this help
+`
+
+// session runs commands for a single authenticated connection
+type session struct {
+	server *Server
+	ip     string
+	apiKey *models.APIKey // nil for keys that aren't linked to an API key
+}
+
+// serve waits for the shell or exec request of a channel and runs the command
+func (sess *session) serve(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	pty := false
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			pty = true
+			_ = req.Reply(true, nil)
+		case "env":
+			_ = req.Reply(true, nil)
+		case "shell", "exec":
+			var command string
+			if req.Type == "exec" {
+				var payload struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+					_ = req.Reply(false, nil)
+					return
+				}
+				command = payload.Command
+			}
+			_ = req.Reply(true, nil)
+
+			// An interactive login without a command would wait on stdin forever
+			if command == "" && pty {
+				command = "help"
+			}
+
+			status := sess.run(channel, strings.Fields(command))
+			_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		default:
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+// run executes a command, returning its exit status
+func (sess *session) run(channel ssh.Channel, args []string) uint32 {
+	name := "upload"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	var err error
+	switch name {
+	case "upload":
+		err = sess.upload(channel, args)
+	case "get":
+		err = sess.get(channel, args)
+	case "list":
+		err = sess.list(channel, args)
+	case "delete":
+		err = sess.delete(channel, args)
+	case "help":
+		_, _ = io.WriteString(channel, usage)
+	default:
+		err = fmt.Errorf("unknown command %q, run \"help\" for usage", name)
+	}
+
+	if err != nil {
+		var fe *fiber.Error
+		message := err.Error()
+		if errors.As(err, &fe) {
+			message = fe.Message
+		} else if !errors.Is(err, errUsage) {
+			sess.server.logger.Debug("ssh command failed", zap.String("command", name), zap.Error(err))
+		}
+		if !errors.Is(err, errUsage) {
+			_, _ = fmt.Fprintf(channel.Stderr(), "error: %s\n", message)
+		}
+		return 1
+	}
+	return 0
+}
+
+// errUsage is returned when flag parsing already reported the problem
+var errUsage = errors.New("usage")
+
+func (sess *session) upload(channel ssh.Channel, args []string) error {
+	if err := sess.server.limiter.Check(sess.ip); err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("upload", flag.ContinueOnError)
+	flags.SetOutput(channel.Stderr())
+	expires := flags.String("expires", "", "expire the paste after this duration")
+	private := flags.Bool("private", false, "make the paste private")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	opts := &services.PasteOptions{
+		Filename: flags.Arg(0),
+		Private:  *private,
+	}
+	if *expires != "" {
+		expiresIn, err := hdur.ParseDuration(*expires)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", *expires)
+		}
+		opts.ExpiresIn = &expiresIn
+	}
+	if opts.Private && sess.apiKey == nil {
+		return errors.New("private pastes require an SSH key linked to an API key")
+	}
+
+	// Read one byte past the largest allowed upload so oversized input is rejected
+	// by the usual size check instead of being silently truncated
+	limit := int64(sess.server.config.Server.MaxUploadSize) + 1
+	content, err := io.ReadAll(io.LimitReader(channel, limit))
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	paste, err := sess.server.services.Paste.CreatePaste(content, sess.apiKey, opts)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(channel, sess.server.services.Paste.PasteURL(paste))
+	return nil
+}
+
+func (sess *session) get(channel ssh.Channel, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: get ID")
+	}
+
+	paste, err := sess.server.services.Paste.GetPaste(args[0])
+	if err != nil {
+		return err
+	}
+
+	content, err := sess.server.services.Paste.GetContent(paste)
+	if err != nil {
+		return err
+	}
+
+	_, err = channel.Write(content)
+	return err
+}
+
+func (sess *session) list(channel ssh.Channel, args []string) error {
+	if sess.apiKey == nil {
+		return errors.New("listing pastes requires an SSH key linked to an API key")
+	}
+
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.SetOutput(channel.Stderr())
+	limit := flags.Int("limit", defaultListLimit, "number of pastes to show")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	pastes, err := sess.server.services.Paste.ListByAPIKey(sess.apiKey, min(max(*limit, 1), maxListLimit))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(channel, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tSIZE\tCREATED\tEXPIRES\tURL")
+	for i := range pastes {
+		paste := &pastes[i]
+		expires := "never"
+		if paste.ExpiresAt != nil {
+			expires = humanize.Time(*paste.ExpiresAt)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			paste.ID,
+			humanize.Bytes(uint64(paste.Size)),
+			humanize.Time(paste.CreatedAt),
+			expires,
+			sess.server.services.Paste.PasteURL(paste))
+	}
+	return w.Flush()
+}
+
+func (sess *session) delete(channel ssh.Channel, args []string) error {
+	if sess.apiKey == nil {
+		return errors.New("deleting pastes requires an SSH key linked to an API key")
+	}
+	if len(args) != 1 {
+		return errors.New("usage: delete ID")
+	}
+
+	if err := sess.server.services.Paste.DeleteOwned(sess.apiKey, args[0]); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(channel, "deleted %s\n", args[0])
+	return nil
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/server/services"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestArchiveBrowsing(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	files := map[string]string{
+		"README.md":        "# logs",
+		"logs/app.log":     "started\nstopped\n",
+		"logs/old/err.log": "boom",
+	}
+
+	zipBuf := &bytes.Buffer{}
+	zw := zip.NewWriter(zipBuf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	// Highly compressible entry that trips the compression ratio limit
+	w, err := zw.Create("bomb.bin")
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, 1024*1024))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	tarBuf := &bytes.Buffer{}
+	gw := gzip.NewWriter(tarBuf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+
+	upload := func(filename string, content []byte) services.PasteResponse {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest("POST", "/p/", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var paste services.PasteResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&paste))
+		return paste
+	}
+
+	testData := []struct {
+		name     string
+		filename string
+		content  []byte
+		format   string
+		entries  int
+	}{
+		{name: "zip", filename: "logs.zip", content: zipBuf.Bytes(), format: "zip", entries: 4},
+		{name: "tar.gz", filename: "logs.tar.gz", content: tarBuf.Bytes(), format: "tar.gz", entries: 3},
+	}
+
+	for _, tt := range testData {
+		t.Run(tt.name, func(t *testing.T) {
+			paste := upload(tt.filename, tt.content)
+
+			resp, err := env.App.Test(httptest.NewRequest("GET", "/p/"+paste.ID+"/archive", nil))
+			require.NoError(t, err)
+			require.Equal(t, 200, resp.StatusCode)
+
+			var listing services.ArchiveResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&listing))
+			assert.Equal(t, tt.format, listing.Format)
+			assert.Len(t, listing.Entries, tt.entries)
+			assert.False(t, listing.Truncated)
+
+			for name, expected := range files {
+				resp, err := env.App.Test(httptest.NewRequest("GET", "/p/"+paste.ID+"/archive/raw/"+name, nil))
+				require.NoError(t, err)
+				require.Equal(t, 200, resp.StatusCode, name)
+				content, _ := io.ReadAll(resp.Body)
+				assert.Equal(t, expected, string(content))
+			}
+
+			req := httptest.NewRequest("GET", "/p/"+paste.ID+"/archive", nil)
+			req.Header.Set("Accept", "text/html,application/xhtml+xml")
+			resp, err = env.App.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, 200, resp.StatusCode)
+			tree, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(tree), "/archive/view/logs/old/err.log")
+
+			req = httptest.NewRequest("GET", "/p/"+paste.ID+"/archive/view/logs/app.log", nil)
+			req.Header.Set("Accept", "text/html,application/xhtml+xml")
+			resp, err = env.App.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, 200, resp.StatusCode)
+			html, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(html), "logs/app.log")
+
+			resp, err = env.App.Test(httptest.NewRequest("GET", "/p/"+paste.ID+"/archive/raw/missing.txt", nil))
+			require.NoError(t, err)
+			assert.Equal(t, 404, resp.StatusCode)
+		})
+	}
+
+	t.Run("compression ratio limit", func(t *testing.T) {
+		paste := upload("bomb.zip", zipBuf.Bytes())
+		resp, err := env.App.Test(httptest.NewRequest("GET", "/p/"+paste.ID+"/archive/raw/bomb.bin", nil))
+		require.NoError(t, err)
+		assert.Equal(t, 413, resp.StatusCode)
+	})
+
+	t.Run("not an archive", func(t *testing.T) {
+		paste := upload("notes.txt", []byte("just some text"))
+		resp, err := env.App.Test(httptest.NewRequest("GET", "/p/"+paste.ID+"/archive", nil))
+		require.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode)
+	})
+}
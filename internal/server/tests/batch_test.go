@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/services"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestBatchEndpoints(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	send := func(method, path, contentType string, body []byte, auth bool) (int, services.BatchResponse) {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if auth {
+			req.Header.Set("Authorization", "Bearer test-api-key")
+		}
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+
+		var response services.BatchResponse
+		if resp.StatusCode == 200 || resp.StatusCode == 207 {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		}
+		return resp.StatusCode, response
+	}
+
+	var created []string
+
+	t.Run("multipart upload with per-file options", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for _, file := range []struct{ name, content string }{
+			{"build.log", "build output"},
+			{"report.xml", "<report/>"},
+		} {
+			part, err := writer.CreateFormFile("file", file.name)
+			require.NoError(t, err)
+			_, err = part.Write([]byte(file.content))
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.WriteField("items", `[{"expires_in": "1h"}, {"private": true, "filename": "renamed.xml"}]`))
+		require.NoError(t, writer.Close())
+
+		status, response := send("POST", "/p/batch", writer.FormDataContentType(), body.Bytes(), true)
+		require.Equal(t, 200, status)
+		require.Len(t, response.Results, 2)
+		assert.Equal(t, 2, response.Succeeded)
+
+		first, err := env.Server.GetServices().Paste.GetPaste(response.Results[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "build.log", first.Filename)
+		assert.NotNil(t, first.ExpiresAt)
+
+		second, err := env.Server.GetServices().Paste.GetPaste(response.Results[1].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "renamed.xml", second.Filename)
+		assert.True(t, second.Private)
+
+		created = append(created, first.ID, second.ID)
+	})
+
+	t.Run("json upload reports failures per item", func(t *testing.T) {
+		body := `{"items": [
+			{"content": "first", "filename": "a.txt"},
+			{"content": ""},
+			{"content": "secret", "private": true}
+		]}`
+
+		// Without an API key the private item fails, the others don't
+		status, response := send("POST", "/p/batch", "application/json", []byte(body), false)
+		require.Equal(t, 207, status)
+		require.Len(t, response.Results, 3)
+		assert.Equal(t, 1, response.Succeeded)
+		assert.Equal(t, 2, response.Failed)
+
+		assert.Equal(t, 200, response.Results[0].Status)
+		require.NotNil(t, response.Results[0].Paste)
+		assert.Equal(t, "a.txt", response.Results[0].Paste.Filename)
+		assert.Equal(t, 400, response.Results[1].Status)
+		assert.Equal(t, "Empty file", response.Results[1].Error)
+		assert.Equal(t, 401, response.Results[2].Status)
+	})
+
+	t.Run("too many items", func(t *testing.T) {
+		items := strings.Repeat(`{"content": "x"},`, 101)
+		status, _ := send("POST", "/p/batch", "application/json", []byte(`{"items": [`+strings.TrimSuffix(items, ",")+`]}`), true)
+		assert.Equal(t, 400, status)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		// A paste created without an API key can't be deleted in a batch
+		anonymous, err := env.Server.GetServices().Paste.CreatePaste([]byte("anonymous"), nil, &services.PasteOptions{})
+		require.NoError(t, err)
+
+		ids := append(append([]string{}, created...), anonymous.ID, "missing1")
+		body, err := json.Marshal(map[string]any{"ids": ids})
+		require.NoError(t, err)
+
+		status, _ := send("DELETE", "/p/batch", "application/json", body, false)
+		assert.Equal(t, 401, status)
+
+		status, response := send("DELETE", "/p/batch", "application/json", body, true)
+		require.Equal(t, 207, status)
+		assert.Equal(t, 2, response.Succeeded)
+		assert.Equal(t, 401, response.Results[2].Status)
+		assert.Equal(t, 404, response.Results[3].Status)
+
+		for _, id := range created {
+			_, err := env.Server.GetServices().Paste.GetPaste(id)
+			assert.Error(t, err)
+		}
+		_, err = env.Server.GetServices().Paste.GetPaste(anonymous.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("shortlinks respect the key's quota", func(t *testing.T) {
+		require.NoError(t, env.DB.Model(&models.APIKey{}).Where("key = ?", "test-api-key").Update("shortlink_quota", 2).Error)
+
+		body := `{"items": [
+			{"url": "https://example.com/one", "title": "One"},
+			{"url": "not a url"},
+			{"url": "https://example.com/two", "title": "Two", "slug": "batch-two"},
+			{"url": "https://example.com/three", "title": "Three"}
+		]}`
+		status, response := send("POST", "/u/batch", "application/json", []byte(body), true)
+		require.Equal(t, 207, status)
+		require.Len(t, response.Results, 4)
+
+		assert.Equal(t, 200, response.Results[0].Status)
+		assert.Equal(t, "One", response.Results[0].Shortlink["title"])
+		assert.Equal(t, 400, response.Results[1].Status)
+		assert.Equal(t, 200, response.Results[2].Status)
+		assert.Equal(t, "batch-two", response.Results[2].ID)
+		assert.Equal(t, 403, response.Results[3].Status)
+		assert.Contains(t, response.Results[3].Error, "quota")
+
+		var count int64
+		require.NoError(t, env.DB.Model(&models.Shortlink{}).Where("api_key = ?", "test-api-key").Count(&count).Error)
+		assert.Equal(t, int64(2), count)
+	})
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/server/services"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestCollectionUpload(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	multipartBody := func(files map[string]string) (*bytes.Buffer, string) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for name, content := range files {
+			part, err := writer.CreateFormFile("file", name)
+			require.NoError(t, err)
+			_, err = part.Write([]byte(content))
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.Close())
+		return body, writer.FormDataContentType()
+	}
+
+	testData := []struct {
+		name           string
+		body           func() (io.Reader, string)
+		expectedStatus int
+		expectedFiles  map[string]string
+	}{
+		{
+			name: "multipart with several files",
+			body: func() (io.Reader, string) {
+				return multipartBody(map[string]string{"main.go": "package main", "go.mod": "module example"})
+			},
+			expectedStatus: 200,
+			expectedFiles:  map[string]string{"main.go": "package main", "go.mod": "module example"},
+		},
+		{
+			name: "json array",
+			body: func() (io.Reader, string) {
+				return strings.NewReader(`[{"filename": "a.txt", "content": "first"}, {"filename": "a.txt", "content": "second"}]`), "application/json"
+			},
+			expectedStatus: 200,
+			expectedFiles:  map[string]string{"a.txt": "first", "a-1.txt": "second"},
+		},
+		{
+			name: "json object with files",
+			body: func() (io.Reader, string) {
+				return strings.NewReader(`{"files": [{"filename": "x.md", "content": "# x"}], "expires_in": "1d"}`), "application/json"
+			},
+			expectedStatus: 200,
+			expectedFiles:  map[string]string{"x.md": "# x"},
+		},
+		{
+			name: "files named like paste routes",
+			body: func() (io.Reader, string) {
+				return strings.NewReader(`[{"filename": "raw", "content": "r"}, {"filename": "download.zip", "content": "d"}]`), "application/json"
+			},
+			expectedStatus: 200,
+			expectedFiles:  map[string]string{"raw": "r", "download.zip": "d"},
+		},
+		{
+			name: "empty file in collection",
+			body: func() (io.Reader, string) {
+				return strings.NewReader(`[{"filename": "a.txt", "content": "first"}, {"filename": "b.txt", "content": ""}]`), "application/json"
+			},
+			expectedStatus: 400,
+		},
+	}
+
+	for _, tt := range testData {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := tt.body()
+			req := httptest.NewRequest("POST", "/p/", body)
+			req.Header.Set("Content-Type", contentType)
+
+			resp, err := env.App.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			if tt.expectedStatus != 200 {
+				return
+			}
+
+			var collection services.CollectionResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&collection))
+			assert.NotEmpty(t, collection.ID)
+			assert.NotEmpty(t, collection.DeleteURL)
+			require.Len(t, collection.Files, len(tt.expectedFiles))
+
+			// Every file is reachable through the collection by name
+			for filename, expected := range tt.expectedFiles {
+				resp, err := env.App.Test(httptest.NewRequest("GET", "/p/"+collection.ID+"/files/"+filename, nil))
+				require.NoError(t, err)
+				require.Equal(t, 200, resp.StatusCode)
+				content, _ := io.ReadAll(resp.Body)
+				assert.Equal(t, expected, string(content))
+			}
+
+			// The zip download contains the same files
+			resp, err = env.App.Test(httptest.NewRequest("GET", "/p/"+collection.ID+"/download", nil))
+			require.NoError(t, err)
+			require.Equal(t, 200, resp.StatusCode)
+			data, _ := io.ReadAll(resp.Body)
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			require.NoError(t, err)
+			assert.Len(t, zr.File, len(tt.expectedFiles))
+
+			// Deleting with the key removes the collection
+			deleteKey := collection.DeleteURL[strings.LastIndex(collection.DeleteURL, "/")+1:]
+			req = httptest.NewRequest("DELETE", "/p/"+collection.ID+"/"+deleteKey, nil)
+			req.Header.Set("Accept", "application/json")
+			resp, err = env.App.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+
+			resp, err = env.App.Test(httptest.NewRequest("GET", "/p/"+collection.ID, nil))
+			require.NoError(t, err)
+			assert.Equal(t, 404, resp.StatusCode)
+		})
+	}
+}
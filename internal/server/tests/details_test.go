@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/services"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestPasteAndShortlinkDetails(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	send := func(method, path, contentType string, body io.Reader, headers map[string]string) (int, []byte) {
+		req := httptest.NewRequest(method, path, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, data
+	}
+	auth := map[string]string{"Authorization": "Bearer test-api-key"}
+
+	decodePaste := func(data []byte) services.PasteResponse {
+		var response services.PasteResponse
+		require.NoError(t, json.Unmarshal(data, &response))
+		return response
+	}
+
+	var ids []string
+
+	t.Run("form upload", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("file", "deploy.log")
+		require.NoError(t, err)
+		_, err = part.Write([]byte("deploy output"))
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteField("title", "  Friday deploy  "))
+		require.NoError(t, writer.WriteField("description", "Logs from the release"))
+		require.NoError(t, writer.WriteField("tags", "Logs, CI, logs"))
+		require.NoError(t, writer.Close())
+
+		status, data := send("POST", "/p/", writer.FormDataContentType(), body, auth)
+		require.Equal(t, 200, status, string(data))
+
+		response := decodePaste(data)
+		assert.Equal(t, "Friday deploy", response.Title)
+		assert.Equal(t, "Logs from the release", response.Description)
+		assert.Equal(t, models.Tags{"logs", "ci"}, response.Tags)
+		ids = append(ids, response.ID)
+	})
+
+	t.Run("json upload", func(t *testing.T) {
+		status, data := send("POST", "/p/", "application/json",
+			strings.NewReader(`{"content": "SELECT 1;", "title": "Query", "tags": ["sql", "ci"]}`), auth)
+		require.Equal(t, 200, status, string(data))
+		assert.Equal(t, models.Tags{"sql", "ci"}, decodePaste(data).Tags)
+		ids = append(ids, decodePaste(data).ID)
+	})
+
+	t.Run("headers on raw upload", func(t *testing.T) {
+		status, data := send("PUT", "/notes.txt", "", strings.NewReader("some notes"), map[string]string{
+			"Authorization": "Bearer test-api-key",
+			"Accept":        "application/json",
+			"X-Title":       "Notes",
+			"X-Tags":        "notes",
+		})
+		require.Equal(t, 200, status, string(data))
+		response := decodePaste(data)
+		assert.Equal(t, "Notes", response.Title)
+		assert.Equal(t, models.Tags{"notes"}, response.Tags)
+		ids = append(ids, response.ID)
+	})
+
+	t.Run("invalid details", func(t *testing.T) {
+		for _, body := range []string{
+			`{"content": "x", "tags": ["no spaces"]}`,
+			`{"content": "x", "tags": "a,b,c,d,e,f,g,h,i,j,k"}`,
+			`{"content": "x", "title": "` + strings.Repeat("t", 256) + `"}`,
+		} {
+			status, _ := send("POST", "/p/", "application/json", strings.NewReader(body), auth)
+			assert.Equal(t, 400, status, body)
+		}
+	})
+
+	t.Run("owners can edit pastes", func(t *testing.T) {
+		body := `{"title": "Renamed", "tags": ["release"]}`
+		status, _ := send("PATCH", "/p/"+ids[0], "application/json", strings.NewReader(body), nil)
+		assert.Equal(t, 401, status)
+
+		// Pastes of other keys can't be edited
+		other, err := env.Server.GetServices().Paste.CreatePaste([]byte("anonymous"), nil, &services.PasteOptions{})
+		require.NoError(t, err)
+		status, _ = send("PATCH", "/p/"+other.ID, "application/json", strings.NewReader(body), auth)
+		assert.Equal(t, 401, status)
+
+		status, data := send("PATCH", "/p/"+ids[0], "application/json", strings.NewReader(body), auth)
+		require.Equal(t, 200, status, string(data))
+		response := decodePaste(data)
+		assert.Equal(t, "Renamed", response.Title)
+		assert.Equal(t, "Logs from the release", response.Description, "fields left out are kept")
+		assert.Equal(t, models.Tags{"release"}, response.Tags)
+	})
+
+	t.Run("list by tag", func(t *testing.T) {
+		var response struct {
+			Items []services.PasteResponse `json:"items"`
+		}
+
+		status, data := send("GET", "/p/list?tag=ci", "", nil, auth)
+		require.Equal(t, 200, status)
+		require.NoError(t, json.Unmarshal(data, &response))
+		require.Len(t, response.Items, 1)
+		assert.Equal(t, ids[1], response.Items[0].ID)
+
+		status, data = send("GET", "/p/list?tag=release,notes", "", nil, auth)
+		require.Equal(t, 200, status)
+		require.NoError(t, json.Unmarshal(data, &response))
+		assert.Empty(t, response.Items)
+	})
+
+	t.Run("html view and open graph", func(t *testing.T) {
+		status, data := send("GET", "/p/"+ids[0], "", nil, map[string]string{"Accept": "application/xhtml+xml"})
+		require.Equal(t, 200, status)
+		html := string(data)
+		assert.Contains(t, html, `<meta property="og:title" content="Renamed">`)
+		assert.Contains(t, html, `<meta property="og:description" content="Logs from the release">`)
+		assert.Contains(t, html, `#release`)
+	})
+
+	t.Run("shortlinks", func(t *testing.T) {
+		status, data := send("POST", "/u/", "application/json",
+			strings.NewReader(`{"url": "https://example.com/docs", "title": "Docs", "tags": "docs,Reference"}`), auth)
+		require.Equal(t, 200, status, string(data))
+
+		var shortlink map[string]any
+		require.NoError(t, json.Unmarshal(data, &shortlink))
+		assert.Equal(t, []any{"docs", "reference"}, shortlink["tags"])
+		id := shortlink["id"].(string)
+
+		status, data = send("PATCH", "/u/"+id, "application/json", strings.NewReader(`{"tags": ["handbook"]}`), auth)
+		require.Equal(t, 200, status, string(data))
+		require.NoError(t, json.Unmarshal(data, &shortlink))
+		assert.Equal(t, "Docs", shortlink["title"])
+		assert.Equal(t, []any{"handbook"}, shortlink["tags"])
+
+		var list struct {
+			Total int64 `json:"total"`
+		}
+		status, data = send("GET", "/u/list?tag=handbook", "", nil, auth)
+		require.Equal(t, 200, status)
+		require.NoError(t, json.Unmarshal(data, &list))
+		assert.Equal(t, int64(1), list.Total)
+	})
+}
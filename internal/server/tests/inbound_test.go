@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/smtpd"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestInboundSMTP(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	cfg := *env.Server.GetConfig()
+	cfg.SMTP.Inbound.Address = "127.0.0.1:0"
+
+	server := smtpd.NewServer(env.Logger, &cfg, env.Server.GetServices().Inbound, env.Server.GetMiddleware().RateLimit)
+	require.NoError(t, server.Listen())
+	go func() { _ = server.Serve() }()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	getAddress := func(method string) string {
+		req := httptest.NewRequest(method, "/keys/inbound", nil)
+		req.Header.Set("Authorization", "Bearer test-api-key")
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+
+		var result struct {
+			Address string `json:"address"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result.Address
+	}
+
+	address := getAddress("GET")
+	require.Contains(t, address, "@")
+	assert.Equal(t, address, getAddress("GET"), "address should be stable")
+
+	send := func(to, message string) error {
+		return smtp.SendMail(server.Addr().String(), nil, "sender@example.com", []string{to},
+			[]byte(strings.ReplaceAll(message, "\n", "\r\n")))
+	}
+
+	t.Run("body becomes a paste", func(t *testing.T) {
+		err := send(address, `From: Sender <sender@example.com>
+To: `+address+`
+Subject: hello
+
+just some text
+`)
+		require.NoError(t, err)
+
+		var pastes []models.Paste
+		require.NoError(t, env.DB.Where("api_key = ? AND filename = ?", "test-api-key", "message.txt").Find(&pastes).Error)
+		require.Len(t, pastes, 1)
+		assert.Equal(t, "message.txt", pastes[0].Filename)
+
+		content, err := env.Server.GetServices().Paste.GetContent(&pastes[0])
+		require.NoError(t, err)
+		assert.Equal(t, "just some text\n", string(content))
+	})
+
+	t.Run("attachments become pastes", func(t *testing.T) {
+		err := send(address, `From: sender@example.com
+To: `+address+`
+Subject: logs
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+see attached
+--b1
+Content-Type: text/plain; name="app.log"
+Content-Disposition: attachment; filename="app.log"
+Content-Transfer-Encoding: base64
+
+bG9nIGxpbmUK
+--b1
+Content-Type: application/json
+Content-Disposition: attachment; filename="../data.json"
+
+{"ok":true}
+--b1--
+`)
+		require.NoError(t, err)
+
+		var pastes []models.Paste
+		require.NoError(t, env.DB.Where("api_key = ? AND filename IN ?", "test-api-key", []string{"app.log", "data.json"}).Find(&pastes).Error)
+		require.Len(t, pastes, 2)
+
+		for _, paste := range pastes {
+			content, err := env.Server.GetServices().Paste.GetContent(&paste)
+			require.NoError(t, err)
+			if paste.Filename == "app.log" {
+				assert.Equal(t, "log line\n", string(content))
+			} else {
+				assert.Equal(t, `{"ok":true}`, string(content))
+			}
+		}
+	})
+
+	t.Run("unknown recipient is rejected", func(t *testing.T) {
+		err := send("nobody00000000000000000@example.com", "Subject: hi\n\nhello\n")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "550")
+	})
+
+	t.Run("rotated address replaces the old one", func(t *testing.T) {
+		rotated := getAddress("POST")
+		assert.NotEqual(t, address, rotated)
+
+		err := send(address, "Subject: hi\n\nhello\n")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "550")
+
+		require.NoError(t, send(rotated, "Subject: hi\n\nhello again\n"))
+	})
+}
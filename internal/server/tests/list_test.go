@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestListPagination(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	// Several pastes share a creation time, so the ID tie-breaker is exercised
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 25; i++ {
+		paste := models.Paste{
+			Filename:    fmt.Sprintf("file-%02d.txt", i),
+			MimeType:    "text/plain",
+			Extension:   "txt",
+			Size:        int64(100 + i),
+			APIKey:      "test-api-key",
+			StorageName: "local",
+			CreatedAt:   base.Add(time.Duration(i/3) * time.Hour),
+		}
+		if i%5 == 0 {
+			paste.Filename = fmt.Sprintf("image-%02d.png", i)
+			paste.MimeType = "image/png"
+			paste.Extension = "png"
+			paste.Private = true
+		}
+		// LIKE wildcards in a MIME prefix match literally
+		switch i {
+		case 1:
+			paste.MimeType = "text/x_log"
+		case 2:
+			paste.MimeType = "text/xylog"
+		}
+		require.NoError(t, env.DB.Create(&paste).Error)
+	}
+	// Pastes of other keys are never listed
+	require.NoError(t, env.DB.Create(&models.Paste{Filename: "other.txt", APIKey: "other-key", StorageName: "local"}).Error)
+
+	type listResponse struct {
+		Items []struct {
+			ID       string `json:"id"`
+			Filename string `json:"filename"`
+			Size     int64  `json:"size"`
+		} `json:"items"`
+		Total      int64  `json:"total"`
+		Limit      int    `json:"limit"`
+		HasMore    bool   `json:"has_more"`
+		NextCursor string `json:"next_cursor"`
+	}
+
+	list := func(path string, params url.Values) (int, listResponse) {
+		req := httptest.NewRequest("GET", path+"?"+params.Encode(), nil)
+		req.Header.Set("Authorization", "Bearer test-api-key")
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+
+		var response listResponse
+		if resp.StatusCode == 200 {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		}
+		return resp.StatusCode, response
+	}
+
+	t.Run("cursor pages cover every paste once", func(t *testing.T) {
+		seen := map[string]bool{}
+		params := url.Values{"limit": {"7"}}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 5, "too many pages")
+
+			status, response := list("/p/list", params)
+			require.Equal(t, 200, status)
+			assert.Equal(t, int64(25), response.Total)
+			assert.Equal(t, 7, response.Limit)
+
+			for _, item := range response.Items {
+				assert.False(t, seen[item.ID], "duplicate paste %s", item.ID)
+				seen[item.ID] = true
+			}
+			if !response.HasMore {
+				assert.Empty(t, response.NextCursor)
+				break
+			}
+			params.Set("cursor", response.NextCursor)
+		}
+		assert.Len(t, seen, 25)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		status, response := list("/p/list", url.Values{"mime_type": {"image/*"}})
+		require.Equal(t, 200, status)
+		assert.Equal(t, int64(5), response.Total)
+
+		status, response = list("/p/list", url.Values{"mime_type": {"text/x_*"}})
+		require.Equal(t, 200, status)
+		assert.Equal(t, int64(1), response.Total)
+
+		status, response = list("/p/list", url.Values{"private": {"false"}, "extension": {".txt"}})
+		require.Equal(t, 200, status)
+		assert.Equal(t, int64(20), response.Total)
+
+		status, response = list("/p/list", url.Values{"filename": {"FILE-1"}})
+		require.Equal(t, 200, status)
+		assert.Equal(t, int64(8), response.Total)
+
+		status, response = list("/p/list", url.Values{
+			"created_after":  {base.Add(2 * time.Hour).Format(time.RFC3339)},
+			"created_before": {base.Add(4 * time.Hour).Format(time.RFC3339)},
+		})
+		require.Equal(t, 200, status)
+		assert.Equal(t, int64(6), response.Total)
+	})
+
+	t.Run("sort", func(t *testing.T) {
+		status, response := list("/p/list", url.Values{"sort": {"size"}, "order": {"asc"}, "limit": {"3"}})
+		require.Equal(t, 200, status)
+		require.Len(t, response.Items, 3)
+		assert.Equal(t, int64(100), response.Items[0].Size)
+		assert.Equal(t, int64(102), response.Items[2].Size)
+
+		status, response = list("/p/list", url.Values{"sort": {"size"}, "order": {"asc"}, "limit": {"3"}, "cursor": {response.NextCursor}})
+		require.Equal(t, 200, status)
+		assert.Equal(t, int64(103), response.Items[0].Size)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		status, response := list("/p/list", url.Values{"sort": {"size"}, "limit": {"1"}})
+		require.Equal(t, 200, status)
+
+		for _, params := range []url.Values{
+			{"sort": {"mime_type"}},
+			{"order": {"sideways"}},
+			{"cursor": {"not-a-cursor"}},
+			{"cursor": {response.NextCursor}}, // issued for a different sort
+			{"private": {"maybe"}},
+			{"created_after": {"yesterday"}},
+		} {
+			status, _ := list("/p/list", params)
+			assert.Equal(t, 400, status, "params %v", params)
+		}
+	})
+
+	t.Run("shortlinks share the envelope", func(t *testing.T) {
+		for i, title := range []string{"Gamma", "alpha", "Beta"} {
+			require.NoError(t, env.DB.Create(&models.Shortlink{
+				TargetURL: fmt.Sprintf("https://example.com/%d", i),
+				Title:     title,
+				APIKey:    "test-api-key",
+			}).Error)
+		}
+
+		status, response := list("/u/list", url.Values{"sort": {"title"}, "order": {"asc"}, "limit": {"2"}})
+		require.Equal(t, 200, status)
+		assert.Equal(t, int64(3), response.Total)
+		assert.True(t, response.HasMore)
+
+		status, response = list("/u/list", url.Values{"title": {"ALPHA"}})
+		require.Equal(t, 200, status)
+		assert.Equal(t, int64(1), response.Total)
+	})
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/config"
+	"github.com/watzon/0x45/internal/server/netcat"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestNetcatListener(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	cfg := *env.Server.GetConfig()
+	cfg.Server.DefaultUploadSize = 64
+	cfg.Server.TCP = config.TCPConfig{
+		Enabled:        true,
+		Address:        "127.0.0.1:0",
+		IdleTimeout:    200 * time.Millisecond,
+		Timeout:        time.Second,
+		MaxConnections: 2,
+	}
+
+	listener := netcat.NewListener(env.Logger, &cfg, env.Server.GetServices().Paste, env.Server.GetMiddleware().RateLimit)
+	require.NoError(t, listener.Listen())
+	go func() { _ = listener.Serve() }()
+
+	send := func(content string, closeWrite bool) string {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write([]byte(content))
+		require.NoError(t, err)
+		if closeWrite {
+			require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		require.NoError(t, err)
+		return strings.TrimSpace(line)
+	}
+
+	pasteContent := func(url string) string {
+		id := strings.TrimSuffix(url[strings.LastIndex(url, "/")+1:], ".txt")
+		resp, err := env.App.Test(httptest.NewRequest("GET", "/p/"+id+"/raw", nil))
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		content, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("closed by client", func(t *testing.T) {
+		url := send("hello from nc\n", true)
+		require.Contains(t, url, "/p/")
+		assert.Equal(t, "hello from nc\n", pasteContent(url))
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		url := send("still open\n", false)
+		require.Contains(t, url, "/p/")
+		assert.Equal(t, "still open\n", pasteContent(url))
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		reply := send(strings.Repeat("x", 100), true)
+		assert.True(t, strings.HasPrefix(reply, "error:"), reply)
+	})
+
+	t.Run("slow client", func(t *testing.T) {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// A byte every 100ms never trips the idle timeout, only the overall one
+		start := time.Now()
+		reply := make(chan string, 1)
+		go func() {
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			reply <- strings.TrimSpace(line)
+		}()
+		for time.Since(start) < 3*time.Second {
+			if _, err := conn.Write([]byte("x")); err != nil {
+				break
+			}
+			select {
+			case line := <-reply:
+				assert.True(t, strings.HasPrefix(line, "error:"), line)
+				assert.Less(t, time.Since(start), 2*time.Second)
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		t.Fatal("slow client was never disconnected")
+	})
+
+	t.Run("connection limit", func(t *testing.T) {
+		// Two silent clients take both slots until their idle timeout
+		for range 2 {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+		}
+
+		reply := send("one too many\n", false)
+		assert.Equal(t, "error: Too many connections, please try again later", reply)
+
+		time.Sleep(500 * time.Millisecond)
+		url := send("room again\n", true)
+		assert.Contains(t, url, "/p/")
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, listener.Shutdown(ctx))
+
+		_, err := net.Dial("tcp", listener.Addr().String())
+		assert.Error(t, err)
+	})
+}
@@ -245,6 +245,20 @@ func TestJSONPasteUpload(t *testing.T) {
 			invalidAuth:    false,
 			expectedStatus: 400,
 		},
+		{
+			name:           "url pointing at a private address",
+			body:           `{"url": "http://169.254.169.254/latest/meta-data/"}`,
+			withAuth:       true,
+			invalidAuth:    false,
+			expectedStatus: 400,
+		},
+		{
+			name:           "url with a non-http scheme",
+			body:           `{"url": "file:///etc/passwd"}`,
+			withAuth:       true,
+			invalidAuth:    false,
+			expectedStatus: 400,
+		},
 		{
 			name:           "empty json",
 			body:           `{}`,
@@ -397,3 +411,168 @@ func TestPasteWithExpiresIn(t *testing.T) {
 		})
 	}
 }
+
+func TestForkPaste(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	// Create the paste that will be forked
+	req := httptest.NewRequest("POST", "/p/", strings.NewReader(`{"content": "original content", "filename": "main.go"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := env.App.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	var parent services.PasteResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&parent))
+
+	forkTestData := []struct {
+		name            string
+		id              string
+		body            string
+		expectedStatus  int
+		expectedContent string
+	}{
+		{
+			name:            "fork without changes",
+			id:              parent.ID,
+			body:            `{}`,
+			expectedStatus:  200,
+			expectedContent: "original content",
+		},
+		{
+			name:            "fork with edited content",
+			id:              parent.ID,
+			body:            `{"content": "edited content"}`,
+			expectedStatus:  200,
+			expectedContent: "edited content",
+		},
+		{
+			name:           "fork of missing paste",
+			id:             "missing",
+			body:           `{}`,
+			expectedStatus: 404,
+		},
+	}
+
+	for _, tt := range forkTestData {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/p/"+tt.id+"/fork", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := env.App.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			if tt.expectedStatus != 200 {
+				return
+			}
+
+			var fork services.PasteResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&fork))
+			assert.NotEqual(t, parent.ID, fork.ID)
+			assert.Equal(t, "main.go", fork.Filename)
+
+			// The fork keeps a reference to its parent
+			paste, err := env.Server.GetServices().Paste.GetPaste(fork.ID)
+			require.NoError(t, err)
+			assert.Equal(t, parent.ID, paste.GetMetadata().ForkedFrom)
+
+			// And serves the expected content
+			raw, err := env.App.Test(httptest.NewRequest("GET", "/p/"+fork.ID+"/raw", nil))
+			require.NoError(t, err)
+			content, _ := io.ReadAll(raw.Body)
+			assert.Equal(t, tt.expectedContent, string(content))
+		})
+	}
+}
+
+func TestRawPutUpload(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	uploadTestData := []struct {
+		name             string
+		path             string
+		headers          map[string]string
+		expectedStatus   int
+		expectedFilename string
+		expectJSON       bool
+	}{
+		{
+			name:             "filename from path",
+			path:             "/p/notes.log",
+			expectedStatus:   200,
+			expectedFilename: "notes.log",
+		},
+		{
+			name:             "curl -T to the root",
+			path:             "/build.log",
+			expectedStatus:   200,
+			expectedFilename: "build.log",
+		},
+		{
+			name:             "filename header overrides path",
+			path:             "/",
+			headers:          map[string]string{"X-Filename": "custom.txt", "X-Expires-In": "1h"},
+			expectedStatus:   200,
+			expectedFilename: "custom.txt",
+		},
+		{
+			name:             "json response",
+			path:             "/p/data.txt",
+			headers:          map[string]string{"Accept": "application/json"},
+			expectedStatus:   200,
+			expectedFilename: "data.txt",
+			expectJSON:       true,
+		},
+		{
+			name:           "private without auth",
+			path:           "/p/secret.txt",
+			headers:        map[string]string{"X-Private": "true"},
+			expectedStatus: 401,
+		},
+		{
+			name:           "invalid expiry",
+			path:           "/p/notes.txt",
+			headers:        map[string]string{"X-Expires-In": "soon"},
+			expectedStatus: 400,
+		},
+	}
+
+	for _, tt := range uploadTestData {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", tt.path, strings.NewReader("raw upload content"))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			resp, err := env.App.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if tt.expectedStatus != 200 {
+				return
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			var pasteURL string
+			if tt.expectJSON {
+				var paste services.PasteResponse
+				require.NoError(t, json.Unmarshal(body, &paste))
+				pasteURL = paste.URL
+			} else {
+				assert.True(t, strings.HasSuffix(string(body), "\n"))
+				assert.NotEmpty(t, resp.Header.Get("X-Paste-Delete-Url"))
+				pasteURL = strings.TrimSpace(string(body))
+			}
+
+			id := strings.TrimSuffix(pasteURL[strings.LastIndex(pasteURL, "/")+1:], ".txt")
+			id = strings.TrimSuffix(id, ".log")
+			paste, err := env.Server.GetServices().Paste.GetPaste(id)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedFilename, paste.Filename)
+		})
+	}
+}
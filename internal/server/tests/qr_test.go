@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/server/services"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestQRCodes(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	shortlink := env.CreateShortlink(t, `{"url": "https://example.com/label", "title": "Label"}`)
+
+	status, data := env.Send(t, "POST", "/p/", `{"content": "label text", "filename": "label.txt"}`, testutils.Anonymous)
+	require.Equal(t, 200, status, string(data))
+	var paste services.PasteResponse
+	require.NoError(t, json.Unmarshal(data, &paste))
+
+	get := func(path string) (int, string, []byte) {
+		resp, err := env.App.Test(httptest.NewRequest("GET", path, nil))
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		if resp.StatusCode == 200 {
+			assert.Equal(t, "public, max-age=31536000, immutable", resp.Header.Get("Cache-Control"))
+		}
+		return resp.StatusCode, resp.Header.Get("Content-Type"), data
+	}
+
+	decode := func(data []byte) image.Image {
+		img, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		return img
+	}
+
+	rgba := func(c color.Color) color.RGBA {
+		r, g, b, a := c.RGBA()
+		return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+	}
+
+	t.Run("png", func(t *testing.T) {
+		status, contentType, data := get("/u/" + shortlink + "/qr")
+		require.Equal(t, 200, status, string(data))
+		assert.Equal(t, "image/png", contentType)
+		img := decode(data)
+		assert.Equal(t, image.Rect(0, 0, 256, 256), img.Bounds())
+
+		// The quiet zone is light and the finder pattern in the corner dark
+		assert.Equal(t, color.RGBA{255, 255, 255, 255}, rgba(img.At(2, 2)))
+		assert.Equal(t, color.RGBA{0, 0, 0, 255}, rgba(img.At(img.Bounds().Dx()/6, img.Bounds().Dy()/6)))
+	})
+
+	t.Run("options", func(t *testing.T) {
+		status, _, data := get("/u/" + shortlink + "/qr?size=512&margin=0&fg=%23336699&bg=ffe&level=h")
+		require.Equal(t, 200, status, string(data))
+		img := decode(data)
+		assert.Equal(t, image.Rect(0, 0, 512, 512), img.Bounds())
+		assert.Equal(t, color.RGBA{0x33, 0x66, 0x99, 255}, rgba(img.At(1, 1)), "without a margin the finder pattern starts in the corner")
+
+		status, _, data = get("/u/" + shortlink + "/qr?bg=00000000")
+		require.Equal(t, 200, status)
+		assert.Equal(t, uint8(0), rgba(decode(data).At(1, 1)).A)
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		status, contentType, data := get("/u/" + shortlink + "/qr?format=svg&size=300&fg=c00")
+		require.Equal(t, 200, status, string(data))
+		assert.Equal(t, "image/svg+xml", contentType)
+		svg := string(data)
+		assert.True(t, strings.HasPrefix(svg, "<svg "))
+		assert.Contains(t, svg, `width="300" height="300"`)
+		assert.Contains(t, svg, `<path fill="#cc0000" d="M4 4h7v1h-7z`)
+		assert.NotContains(t, svg, "<text")
+
+		status, _, data = get("/u/" + shortlink + "/qr?format=svg&logo=true")
+		require.Equal(t, 200, status, string(data))
+		assert.Contains(t, string(data), ">0x45</text>")
+	})
+
+	t.Run("pastes", func(t *testing.T) {
+		for _, path := range []string{"/p/" + paste.ID + "/qr", "/p/" + paste.ID + ".txt/qr"} {
+			status, contentType, data := get(path)
+			require.Equal(t, 200, status, path)
+			assert.Equal(t, "image/png", contentType)
+			decode(data)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for path, want := range map[string]int{
+			"/u/missing/qr":                          404,
+			"/p/missing/qr":                          404,
+			"/u/" + shortlink + "/qr?format=gif":     400,
+			"/u/" + shortlink + "/qr?size=10":        400,
+			"/u/" + shortlink + "/qr?size=99999":     400,
+			"/u/" + shortlink + "/qr?margin=-1":      400,
+			"/u/" + shortlink + "/qr?level=X":        400,
+			"/u/" + shortlink + "/qr?fg=blue":        400,
+			"/u/" + shortlink + "/qr?logo=1&level=L": 400,
+		} {
+			status, _, _ := get(path)
+			assert.Equal(t, want, status, path)
+		}
+	})
+}
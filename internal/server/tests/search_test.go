@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/services"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestPasteSearch(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	pasteService := env.Server.GetServices().Paste
+
+	var apiKey models.APIKey
+	require.NoError(t, env.DB.Where("key = ?", "test-api-key").First(&apiKey).Error)
+
+	create := func(content, filename string, key *models.APIKey) *models.Paste {
+		paste, err := pasteService.CreatePaste([]byte(content), key, &services.PasteOptions{Filename: filename})
+		require.NoError(t, err)
+		return paste
+	}
+
+	config := create("database:\n  host: db.internal\n  pool_size: 20\n", "production.yaml", &apiKey)
+	notes := create("Meeting notes about the database migration", "notes.txt", &apiKey)
+	binary := create("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "architecture-diagram.png", &apiKey)
+	anonymous := create("database credentials nobody should find", "anon.txt", nil)
+
+	search := func(query string) (int, []string) {
+		req := httptest.NewRequest("GET", "/p/search?"+url.Values{"q": {query}}.Encode(), nil)
+		req.Header.Set("Authorization", "Bearer test-api-key")
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		if resp.StatusCode != 200 {
+			return resp.StatusCode, nil
+		}
+
+		var response struct {
+			Items []services.PasteResponse `json:"items"`
+			Total int64                    `json:"total"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		require.Equal(t, int64(len(response.Items)), response.Total)
+
+		ids := make([]string, len(response.Items))
+		for i, item := range response.Items {
+			ids[i] = item.ID
+		}
+		return resp.StatusCode, ids
+	}
+
+	t.Run("content and filenames", func(t *testing.T) {
+		_, ids := search("database")
+		assert.ElementsMatch(t, []string{config.ID, notes.ID}, ids)
+
+		// Every word has to match, and words match as prefixes
+		_, ids = search("databa pool")
+		assert.Equal(t, []string{config.ID}, ids)
+
+		// Binary pastes are found by their filename only
+		_, ids = search("diagram")
+		assert.Equal(t, []string{binary.ID}, ids)
+		_, ids = search("IHDR")
+		assert.Empty(t, ids)
+
+		// Punctuation in the query can't break the search syntax
+		status, ids := search(`"db.internal" -(host*)`)
+		assert.Equal(t, 200, status)
+		assert.Equal(t, []string{config.ID}, ids)
+
+		status, _ = search("  ... ")
+		assert.Equal(t, 400, status)
+	})
+
+	t.Run("titles, descriptions and tags", func(t *testing.T) {
+		paste, err := pasteService.CreatePaste([]byte("SELECT 1;"), &apiKey, &services.PasteOptions{
+			Filename:    "query.sql",
+			Title:       "Quarterly revenue",
+			Description: "Numbers for the board",
+			Tags:        models.Tags{"finance"},
+		})
+		require.NoError(t, err)
+
+		_, ids := search("quarterly")
+		assert.Equal(t, []string{paste.ID}, ids)
+		_, ids = search("board finance")
+		assert.Equal(t, []string{paste.ID}, ids)
+
+		// Editing the details updates the index
+		req := httptest.NewRequest("PATCH", "/p/"+paste.ID, strings.NewReader(`{"title": "Annual revenue", "tags": ["reports"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer test-api-key")
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+
+		_, ids = search("quarterly")
+		assert.Empty(t, ids)
+		_, ids = search("annual reports select")
+		assert.Equal(t, []string{paste.ID}, ids)
+	})
+
+	t.Run("deleted pastes are removed from the index", func(t *testing.T) {
+		require.NoError(t, pasteService.DeleteOwned(&apiKey, notes.ID))
+
+		_, ids := search("meeting")
+		assert.Empty(t, ids)
+
+		var count int64
+		require.NoError(t, env.DB.Table(models.PasteSearchTable).Where("paste_id = ?", notes.ID).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+
+	t.Run("backfill indexes existing pastes", func(t *testing.T) {
+		// Anonymous pastes aren't indexed. Give this one to the key, as if it
+		// had been created before search existed.
+		require.NoError(t, env.DB.Model(anonymous).Update("api_key", apiKey.Key).Error)
+		_, ids := search("credentials")
+		assert.Empty(t, ids)
+
+		indexed, err := env.Server.GetServices().Search.Backfill(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, indexed)
+
+		_, ids = search("credentials")
+		assert.Equal(t, []string{anonymous.ID}, ids)
+	})
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestShortlinkAccessRestrictions(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	visit := func(method, path string, headers map[string]string, form url.Values) (int, string, string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, resp.Header.Get("Location"), string(data)
+	}
+	browser := map[string]string{"Accept": "text/html,application/xhtml+xml"}
+
+	t.Run("password", func(t *testing.T) {
+		status, shortlink := env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/secret", "title": "Secret", "password": "hunter2"}`)
+		require.Equal(t, 200, status)
+		assert.Equal(t, true, shortlink["password_protected"])
+		assert.NotContains(t, shortlink, "password_hash")
+		id := shortlink["id"].(string)
+
+		status, _, body := visit("GET", "/u/"+id, nil, nil)
+		assert.Equal(t, 401, status)
+		assert.NotContains(t, body, "example.com/secret")
+
+		status, _, _ = visit("GET", "/u/"+id, map[string]string{"X-Shortlink-Password": "wrong"}, nil)
+		assert.Equal(t, 401, status)
+
+		status, location, _ := visit("GET", "/u/"+id, map[string]string{"X-Shortlink-Password": "hunter2"}, nil)
+		assert.Equal(t, 307, status)
+		assert.Equal(t, "https://example.com/secret", location)
+
+		// Browsers get a prompt that posts back to the short URL
+		status, _, body = visit("GET", "/u/"+id, browser, nil)
+		assert.Equal(t, 401, status)
+		assert.Contains(t, body, `action="`+env.Config.Server.BaseURL+`/u/`+id+`"`)
+		assert.NotContains(t, body, "example.com/secret")
+
+		status, _, body = visit("POST", "/u/"+id, browser, url.Values{"password": {"wrong"}})
+		assert.Equal(t, 401, status)
+		assert.Contains(t, body, "Wrong password")
+
+		status, location, _ = visit("POST", "/u/"+id, browser, url.Values{"password": {"hunter2"}})
+		assert.Equal(t, 303, status)
+		assert.Equal(t, "https://example.com/secret", location)
+
+		// Previews don't give the destination away either
+		status, _, body = visit("GET", "/u/"+id+"+", nil, nil)
+		assert.Equal(t, 401, status)
+		assert.NotContains(t, body, "example.com/secret")
+		status, _, body = visit("GET", "/u/"+id+"+", map[string]string{"X-Shortlink-Password": "hunter2"}, nil)
+		assert.Equal(t, 200, status)
+		assert.Contains(t, body, "example.com/secret")
+
+		// The interstitial passes the password on when continuing
+		warned := env.CreateShortlink(t, `{"url": "https://example.com/warned", "title": "Warned", "password": "hunter2", "interstitial": true}`)
+		status, _, body = visit("POST", "/u/"+warned, browser, url.Values{"password": {"hunter2"}})
+		assert.Equal(t, 200, status)
+		assert.Contains(t, body, "https://example.com/warned")
+		assert.Contains(t, body, `name="password" value="hunter2"`)
+		status, location, _ = visit("POST", "/u/"+warned+"?confirm=1", browser, url.Values{"password": {"hunter2"}})
+		assert.Equal(t, 303, status)
+		assert.Equal(t, "https://example.com/warned", location)
+
+		// Posts to the management routes still reach them
+		status, _ = env.SendJSON(t, "POST", "/u/batch", `{"items": [{"url": "https://example.com/other", "title": "Other"}]}`)
+		assert.Equal(t, 200, status)
+
+		status, shortlink = env.SendJSON(t, "PATCH", "/u/"+id, `{"password": ""}`)
+		require.Equal(t, 200, status)
+		assert.Equal(t, false, shortlink["password_protected"])
+		status, _, _ = visit("GET", "/u/"+id, nil, nil)
+		assert.Equal(t, 307, status)
+	})
+
+	t.Run("wrong password limit", func(t *testing.T) {
+		id := env.CreateShortlink(t, `{"url": "https://example.com/guarded", "title": "Guarded", "password": "hunter2"}`)
+		wrong := map[string]string{"X-Shortlink-Password": "wrong"}
+
+		// The two wrong passwords above count, the right ones don't, leaving one of three
+		status, _, _ := visit("GET", "/u/"+id, wrong, nil)
+		assert.Equal(t, 401, status)
+		status, _, _ = visit("POST", "/u/"+id, browser, url.Values{"password": {"wrong"}})
+		assert.Equal(t, 429, status)
+		status, _, _ = visit("GET", "/u/"+id+"+", wrong, nil)
+		assert.Equal(t, 429, status)
+
+		// Further attempts aren't checked at all until the window refills
+		status, _, _ = visit("GET", "/u/"+id, map[string]string{"X-Shortlink-Password": "hunter2"}, nil)
+		assert.Equal(t, 429, status)
+
+		// Visits without a password are unaffected
+		status, _, _ = visit("GET", "/u/"+id, nil, nil)
+		assert.Equal(t, 401, status)
+		open := env.CreateShortlink(t, `{"url": "https://example.com/open", "title": "Open"}`)
+		status, _, _ = visit("GET", "/u/"+open, nil, nil)
+		assert.Equal(t, 307, status)
+	})
+
+	t.Run("click limit", func(t *testing.T) {
+		id := env.CreateShortlink(t, `{"url": "https://example.com/once", "title": "Once", "max_clicks": 2}`)
+
+		for range 2 {
+			status, _, _ := visit("GET", "/u/"+id, nil, nil)
+			require.Equal(t, 307, status)
+		}
+		status, _, _ := visit("GET", "/u/"+id, nil, nil)
+		assert.Equal(t, 410, status)
+
+		// The owner can still see and raise the limit
+		status, shortlink := env.SendJSON(t, "GET", "/u/"+id+"/stats", "")
+		assert.Equal(t, 200, status)
+		status, shortlink = env.SendJSON(t, "PATCH", "/u/"+id, `{"max_clicks": 3}`)
+		require.Equal(t, 200, status)
+		assert.Equal(t, float64(2), shortlink["clicks"])
+
+		status, _, _ = visit("GET", "/u/"+id, nil, nil)
+		assert.Equal(t, 307, status)
+		status, _, _ = visit("GET", "/u/"+id, nil, nil)
+		assert.Equal(t, 410, status)
+
+		status, _ = env.SendJSON(t, "PATCH", "/u/"+id, `{"max_clicks": -1}`)
+		assert.Equal(t, 400, status)
+	})
+
+	t.Run("activation window", func(t *testing.T) {
+		future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+		id := env.CreateShortlink(t, `{"url": "https://example.com/launch", "title": "Launch", "not_before": "`+future+`"}`)
+		status, _, _ := visit("GET", "/u/"+id, nil, nil)
+		assert.Equal(t, 403, status)
+
+		status, _ = env.SendJSON(t, "PATCH", "/u/"+id, `{"not_before": "", "not_after": "`+past+`"}`)
+		require.Equal(t, 200, status)
+		status, _, _ = visit("GET", "/u/"+id, nil, nil)
+		assert.Equal(t, 410, status)
+
+		status, _ = env.SendJSON(t, "PATCH", "/u/"+id, `{"not_after": ""}`)
+		require.Equal(t, 200, status)
+		status, _, _ = visit("GET", "/u/"+id, nil, nil)
+		assert.Equal(t, 307, status)
+
+		status, _ = env.SendJSON(t, "PATCH", "/u/"+id, `{"not_before": "`+future+`", "not_after": "`+past+`"}`)
+		assert.Equal(t, 400, status)
+		status, _ = env.SendJSON(t, "PATCH", "/u/"+id, `{"not_after": "next week"}`)
+		assert.Equal(t, 400, status)
+	})
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestAnonymousShortlinks(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	blocked := blockedHosts{"evil.example": true}
+	env.Server.GetServices().Reputation.Add(blocked)
+	cfg := env.Server.GetConfig()
+
+	t.Run("off by default", func(t *testing.T) {
+		status, _ := env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/", "title": "Home"}`, testutils.Anonymous)
+		assert.Equal(t, 401, status)
+
+		// Without blocklist checks they stay off
+		cfg.Server.Shortlinks.Anonymous.Enabled = true
+		status, _ = env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/", "title": "Home"}`, testutils.Anonymous)
+		assert.Equal(t, 401, status)
+	})
+
+	cfg.Server.Shortlinks.Reputation.Enabled = true
+
+	var anonymous map[string]any
+	t.Run("create", func(t *testing.T) {
+		var status int
+		status, anonymous = env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/anonymous", "title": "Anonymous"}`, testutils.Anonymous)
+		require.Equal(t, 200, status, anonymous)
+		assert.Contains(t, anonymous["delete_url"], "/u/"+anonymous["id"].(string)+"/")
+
+		expiresAt, err := time.Parse(time.RFC3339, anonymous["expires_at"].(string))
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), expiresAt, time.Minute, "anonymous shortlinks expire by default")
+
+		var shortlink models.Shortlink
+		require.NoError(t, env.DB.First(&shortlink, "id = ?", anonymous["id"]).Error)
+		assert.Empty(t, shortlink.APIKey)
+
+		status, _ = env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/", "title": "Slug", "slug": "mine"}`, testutils.Anonymous)
+		assert.Equal(t, 401, status, "custom slugs need an API key")
+		status, _ = env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/", "title": "Long", "expires_in": "30d"}`, testutils.Anonymous)
+		assert.Equal(t, 400, status)
+		status, _ = env.SendJSON(t, "POST", "/u/", `{"url": "https://evil.example/", "title": "Evil"}`, testutils.Anonymous)
+		assert.Equal(t, 403, status)
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		// Every anonymous attempt above counts, leaving one of the five allowed
+		status, later := env.SendJSON(t, "POST", "/u/", `{"url": "https://later.example/", "title": "Later", "expires_in": "1h"}`, testutils.Anonymous)
+		require.Equal(t, 200, status, later)
+		status, _ = env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/", "title": "Home"}`, testutils.Anonymous)
+		assert.Equal(t, 429, status)
+
+		status, _ = env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/", "title": "Home"}`)
+		assert.Equal(t, 200, status, "API keys aren't limited")
+
+		// Anonymous destinations are checked again on every redirect
+		blocked["later.example"] = true
+		status, _ = env.SendJSON(t, "GET", "/u/"+later["id"].(string), "", testutils.Anonymous)
+		assert.Equal(t, 403, status)
+	})
+
+	t.Run("delete with key", func(t *testing.T) {
+		id := anonymous["id"].(string)
+		deleteURL, err := url.Parse(anonymous["delete_url"].(string))
+		require.NoError(t, err)
+		accept := map[string]string{"Accept": "application/json"}
+
+		status, _ := env.SendJSON(t, "DELETE", "/u/"+id+"/wrong-key", "", testutils.Anonymous, accept)
+		assert.Equal(t, 401, status)
+		status, _ = env.SendJSON(t, "GET", "/u/"+id+"/wrong-key", "", testutils.Anonymous, accept)
+		assert.NotEqual(t, 200, status)
+
+		status, data := env.SendJSON(t, "GET", deleteURL.Path, "", testutils.Anonymous, accept)
+		require.Equal(t, 200, status)
+		assert.Equal(t, "Shortlink found and will be deleted", data["message"])
+
+		req := httptest.NewRequest("GET", deleteURL.Path, nil)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml")
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		page, _ := io.ReadAll(resp.Body)
+		assert.Contains(t, string(page), "Delete Shortlink")
+		assert.Contains(t, string(page), `action="`+env.Config.Server.BaseURL+deleteURL.Path+`"`)
+
+		// The confirmation page posts the form back with DELETE as the method
+		req = httptest.NewRequest("POST", deleteURL.Path, strings.NewReader("_method=DELETE"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "text/html,application/xhtml+xml")
+		resp, err = env.App.Test(req)
+		require.NoError(t, err)
+		page, _ = io.ReadAll(resp.Body)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Contains(t, string(page), "Shortlink Deleted")
+
+		status, _ = env.SendJSON(t, "GET", "/u/"+id, "", testutils.Anonymous)
+		assert.Equal(t, 404, status)
+		status, _ = env.SendJSON(t, "DELETE", deleteURL.Path, "", testutils.Anonymous, accept)
+		assert.Equal(t, 404, status)
+	})
+
+	t.Run("passthrough paths still redirect", func(t *testing.T) {
+		status, shortlink := env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/docs/", "title": "Docs", "passthrough": true}`)
+		require.Equal(t, 200, status)
+
+		req := httptest.NewRequest("GET", "/u/"+shortlink["id"].(string)+"/intro", nil)
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, 307, resp.StatusCode)
+		assert.Equal(t, "https://example.com/docs/intro", resp.Header.Get("Location"))
+	})
+}
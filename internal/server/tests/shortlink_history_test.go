@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestShortlinkHistory(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	redirectsTo := func(id string) string {
+		resp, err := env.App.Test(httptest.NewRequest("GET", "/u/"+id, nil))
+		require.NoError(t, err)
+		return resp.Header.Get("Location")
+	}
+
+	id := env.CreateShortlink(t, `{"url": "https://example.com/v1", "title": "Release"}`)
+
+	history := func() []map[string]any {
+		status, data := env.Send(t, "GET", "/u/"+id+"/history", "")
+		require.Equal(t, 200, status, string(data))
+		var response struct {
+			Changes []map[string]any `json:"changes"`
+		}
+		require.NoError(t, json.Unmarshal(data, &response))
+		return response.Changes
+	}
+
+	t.Run("edits change the target and are recorded", func(t *testing.T) {
+		status, _ := env.Send(t, "PATCH", "/u/"+id, `{"url": "https://example.com/v2"}`, testutils.Anonymous)
+		assert.Equal(t, 401, status)
+
+		status, _ = env.Send(t, "PATCH", "/u/"+id, `{"url": "ftp://example.com/v2"}`)
+		assert.Equal(t, 400, status)
+
+		status, data := env.Send(t, "PATCH", "/u/"+id, `{"url": "https://example.com/v2"}`)
+		require.Equal(t, 200, status, string(data))
+		assert.Equal(t, "https://example.com/v2", redirectsTo(id))
+
+		status, _ = env.Send(t, "PATCH", "/u/"+id, `{"url": "https://example.com/v3", "title": "Release 3"}`)
+		require.Equal(t, 200, status)
+
+		// Edits that don't touch the target or title leave no trace
+		status, _ = env.Send(t, "PATCH", "/u/"+id, `{"tags": ["releases"]}`)
+		require.Equal(t, 200, status)
+
+		changes := history()
+		require.Len(t, changes, 2)
+		assert.Equal(t, models.ShortlinkChangeEdit, changes[0]["kind"])
+		assert.Equal(t, "https://example.com/v2", changes[0]["previous_url"])
+		assert.Equal(t, "https://example.com/v3", changes[0]["url"])
+		assert.Equal(t, "Release", changes[0]["previous_title"])
+		assert.Equal(t, "Release 3", changes[0]["title"])
+		assert.Equal(t, "https://example.com/v1", changes[1]["previous_url"])
+		assert.NotEmpty(t, changes[1]["changed_at"])
+	})
+
+	t.Run("rollback restores a previous target", func(t *testing.T) {
+		changes := history()
+		first := int(changes[len(changes)-1]["id"].(float64))
+
+		status, _ := env.Send(t, "POST", "/u/"+id+"/rollback", `{"change_id": 9999}`)
+		assert.Equal(t, 404, status)
+		status, _ = env.Send(t, "POST", "/u/"+id+"/rollback", `{}`)
+		assert.Equal(t, 400, status)
+
+		status, data := env.Send(t, "POST", "/u/"+id+"/rollback", `{"change_id": `+strconv.Itoa(first)+`}`)
+		require.Equal(t, 200, status, string(data))
+		assert.Equal(t, "https://example.com/v1", redirectsTo(id))
+
+		changes = history()
+		require.Len(t, changes, 3)
+		assert.Equal(t, models.ShortlinkChangeRollback, changes[0]["kind"])
+		assert.Equal(t, "https://example.com/v3", changes[0]["previous_url"])
+		assert.Equal(t, "https://example.com/v1", changes[0]["url"])
+		assert.Equal(t, "Release", changes[0]["title"])
+	})
+}
@@ -0,0 +1,218 @@
+package tests
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/services"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestShortlinkLinkCheck(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	// Local stand-ins for the link targets and the owner's mail server
+	target := http.NewServeMux()
+	target.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	target.HandleFunc("/gone", http.NotFound)
+	targets := httptest.NewServer(target)
+	defer targets.Close()
+
+	smtpPort, mails := fakeSMTP(t)
+
+	cfg := *env.Server.GetConfig()
+	cfg.Server.Fetch.AllowPrivate = true
+	cfg.Server.Shortlinks.LinkCheck.Threshold = 2
+	cfg.Server.Shortlinks.LinkCheck.Notify = true
+	cfg.SMTP.Enabled = true
+	cfg.SMTP.Host = "127.0.0.1"
+	cfg.SMTP.Port = smtpPort
+	checker := services.NewLinkCheckService(env.DB.DB, env.Logger, &cfg)
+
+	load := func(id string) models.Shortlink {
+		var shortlink models.Shortlink
+		require.NoError(t, env.DB.First(&shortlink, "id = ?", id).Error)
+		return shortlink
+	}
+
+	// run makes every target due and checks them all
+	run := func() {
+		require.NoError(t, env.DB.Model(&models.Shortlink{}).Where("1 = 1").Update("next_check_at", nil).Error)
+		count, err := checker.RunChecks()
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+	}
+
+	working := env.CreateShortlink(t, `{"url": "`+targets.URL+`/ok", "title": "Target"}`)
+	broken := env.CreateShortlink(t, `{"url": "`+targets.URL+`/gone", "title": "Target"}`)
+
+	t.Run("failures are retried before a link counts as broken", func(t *testing.T) {
+		count, err := checker.RunChecks()
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		count, err = checker.RunChecks()
+		require.NoError(t, err)
+		assert.Equal(t, 0, count, "nothing is due right after a run")
+
+		shortlink := load(working)
+		assert.False(t, shortlink.Broken)
+		require.Len(t, shortlink.Checks, 1)
+		assert.Equal(t, 200, shortlink.Checks[0].Status)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), *shortlink.NextCheckAt, time.Minute)
+
+		shortlink = load(broken)
+		assert.False(t, shortlink.Broken, "a single failure isn't enough")
+		assert.Equal(t, 1, shortlink.CheckFailures)
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), *shortlink.NextCheckAt, time.Minute)
+	})
+
+	t.Run("broken links are flagged and their owner told", func(t *testing.T) {
+		run()
+
+		shortlink := load(broken)
+		assert.True(t, shortlink.Broken)
+		require.Len(t, shortlink.Checks, 2)
+		assert.Equal(t, 404, shortlink.Checks.Last().Status)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), *shortlink.NextCheckAt, time.Minute)
+
+		select {
+		case mail := <-mails:
+			assert.Contains(t, mail, "To: test@example.com")
+			assert.Contains(t, mail, targets.URL+"/gone")
+			assert.Contains(t, mail, "404")
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification was sent")
+		}
+
+		// Broken links back off and aren't reported twice
+		run()
+		assert.WithinDuration(t, time.Now().Add(48*time.Hour), *load(broken).NextCheckAt, time.Minute)
+		select {
+		case <-mails:
+			t.Fatal("the owner was told twice")
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		status, data := env.Send(t, "GET", "/u/list?broken=true", "")
+		require.Equal(t, 200, status, string(data))
+		var list struct {
+			Items []struct {
+				ID     string             `json:"id"`
+				Broken bool               `json:"broken"`
+				Checks []models.LinkCheck `json:"checks"`
+			} `json:"items"`
+		}
+		require.NoError(t, json.Unmarshal(data, &list))
+		require.Len(t, list.Items, 1)
+		assert.Equal(t, broken, list.Items[0].ID)
+		assert.True(t, list.Items[0].Broken)
+		assert.Len(t, list.Items[0].Checks, 3)
+
+		status, data = env.Send(t, "GET", "/u/list?broken=false", "")
+		require.Equal(t, 200, status)
+		require.NoError(t, json.Unmarshal(data, &list))
+		require.Len(t, list.Items, 1)
+		assert.Equal(t, working, list.Items[0].ID)
+	})
+
+	t.Run("changing the target resets the checks", func(t *testing.T) {
+		status, data := env.Send(t, "PATCH", "/u/"+broken, `{"url": "`+targets.URL+`/ok"}`)
+		require.Equal(t, 200, status, string(data))
+
+		shortlink := load(broken)
+		assert.False(t, shortlink.Broken)
+		assert.Empty(t, shortlink.Checks)
+		assert.Nil(t, shortlink.NextCheckAt)
+
+		count, err := checker.RunChecks()
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		assert.Equal(t, 200, load(broken).Checks.Last().Status)
+	})
+
+	t.Run("targets the fetcher refuses are skipped", func(t *testing.T) {
+		// With private addresses off, the local targets look like intranet hosts
+		strictCfg := cfg
+		strictCfg.Server.Fetch.AllowPrivate = false
+		strict := services.NewLinkCheckService(env.DB.DB, env.Logger, &strictCfg)
+
+		for range strictCfg.Server.Shortlinks.LinkCheck.Threshold + 1 {
+			require.NoError(t, env.DB.Model(&models.Shortlink{}).Where("1 = 1").Update("next_check_at", nil).Error)
+			count, err := strict.RunChecks()
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+		}
+
+		shortlink := load(working)
+		assert.False(t, shortlink.Broken)
+		assert.Equal(t, 0, shortlink.CheckFailures)
+		last := shortlink.Checks.Last()
+		assert.Equal(t, "destination address is not allowed", last.Skipped)
+		assert.Empty(t, last.Error)
+		assert.Equal(t, 0, last.Status)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), *shortlink.NextCheckAt, time.Minute)
+
+		select {
+		case <-mails:
+			t.Fatal("skipped targets shouldn't be reported")
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+}
+
+// fakeSMTP accepts mail on a local port and passes the data of every message on
+func fakeSMTP(t *testing.T) (int, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				text := textproto.NewConn(conn)
+				_ = text.PrintfLine("220 localhost")
+				for {
+					line, err := text.ReadLine()
+					if err != nil {
+						return
+					}
+					command, _, _ := strings.Cut(line, " ")
+					switch strings.ToUpper(command) {
+					case "DATA":
+						_ = text.PrintfLine("354 go ahead")
+						data, err := text.ReadDotBytes()
+						if err != nil {
+							return
+						}
+						messages <- string(data)
+						_ = text.PrintfLine("250 ok")
+					case "QUIT":
+						_ = text.PrintfLine("221 bye")
+						return
+					default:
+						_ = text.PrintfLine("250 ok")
+					}
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port, messages
+}
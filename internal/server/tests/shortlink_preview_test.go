@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestShortlinkPreview(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	get := func(path string, headers map[string]string) (int, string, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, resp.Header.Get("Location"), string(data)
+	}
+	browser := map[string]string{"Accept": "text/html,application/xhtml+xml"}
+
+	status, shortlink := env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/report.pdf", "title": "Quarterly report", "tags": ["finance"]}`)
+	require.Equal(t, 200, status, shortlink)
+	id := shortlink["id"].(string)
+	assert.Equal(t, env.Config.Server.BaseURL+"/u/"+id+"+", shortlink["preview_url"])
+
+	t.Run("preview doesn't redirect", func(t *testing.T) {
+		status, location, _ := get("/u/"+id, nil)
+		require.Equal(t, 307, status)
+		assert.Equal(t, "https://example.com/report.pdf", location)
+
+		for _, path := range []string{"/u/" + id + "+", "/u/" + id + "/preview"} {
+			status, location, body := get(path, nil)
+			require.Equal(t, 200, status, path)
+			assert.Empty(t, location)
+
+			var preview map[string]any
+			require.NoError(t, json.Unmarshal([]byte(body), &preview))
+			assert.Equal(t, "https://example.com/report.pdf", preview["url"])
+			assert.Equal(t, "Quarterly report", preview["title"])
+			assert.Equal(t, float64(1), preview["clicks"], "previews aren't counted as clicks")
+			assert.NotContains(t, preview, "delete_url")
+		}
+
+		status, _, body := get("/u/"+id+"+", browser)
+		require.Equal(t, 200, status)
+		assert.Contains(t, body, "https://example.com/report.pdf")
+		assert.Contains(t, body, "Clicks: 1")
+		assert.Contains(t, body, "#finance")
+
+		status, _, _ = get("/u/missing+", nil)
+		assert.Equal(t, 404, status)
+	})
+
+	t.Run("per link interstitial", func(t *testing.T) {
+		warned := env.CreateShortlink(t, `{"url": "https://example.com/download", "title": "Download", "interstitial": true}`)
+
+		status, location, body := get("/u/"+warned, browser)
+		require.Equal(t, 200, status)
+		assert.Empty(t, location)
+		assert.Contains(t, body, "https://example.com/download")
+		assert.Contains(t, body, "/u/"+warned+"?confirm=1")
+
+		status, location, _ = get("/u/"+warned+"?confirm=1", nil)
+		assert.Equal(t, 307, status)
+		assert.Equal(t, "https://example.com/download", location)
+	})
+
+	t.Run("instance wide interstitial for new keys", func(t *testing.T) {
+		shortlinks := &env.Server.GetConfig().Server.Shortlinks
+		shortlinks.Interstitial = "new_keys"
+		shortlinks.NewKeyAge = time.Hour
+		defer func() { shortlinks.Interstitial = "" }()
+
+		status, _, _ := get("/u/"+id, nil)
+		assert.Equal(t, 200, status, "the test key was just created")
+
+		require.NoError(t, env.DB.Exec("UPDATE api_keys SET created_at = ? WHERE key = ?",
+			time.Now().Add(-2*time.Hour), "test-api-key").Error)
+		status, _, _ = get("/u/"+id, nil)
+		assert.Equal(t, 307, status)
+	})
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestShortlinkRedirectOptions(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	redirect := func(path string, headers map[string]string) (int, string) {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode, resp.Header.Get("Location")
+	}
+
+	t.Run("redirect status", func(t *testing.T) {
+		id := env.CreateShortlink(t, `{"url": "https://example.com/", "title": "Home"}`)
+		status, _ := redirect("/u/"+id, nil)
+		assert.Equal(t, 307, status)
+
+		for _, code := range []int{301, 302, 308} {
+			status, _ := env.Send(t, "PATCH", "/u/"+id, `{"redirect_status": `+strconv.Itoa(code)+`}`)
+			require.Equal(t, 200, status)
+			status, location := redirect("/u/"+id, nil)
+			assert.Equal(t, code, status)
+			assert.Equal(t, "https://example.com/", location)
+		}
+
+		status, _ = env.Send(t, "PATCH", "/u/"+id, `{"redirect_status": 200}`)
+		assert.Equal(t, 400, status)
+		status, _ = env.Send(t, "POST", "/u/", `{"url": "https://example.com/", "redirect_status": 303}`)
+		assert.Equal(t, 400, status)
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		id := env.CreateShortlink(t, `{"url": "https://example.com/docs/?lang=en&v=1", "title": "Docs", "passthrough": true}`)
+
+		status, location := redirect("/u/"+id+"/guides/intro%20page?v=2&ref=x", nil)
+		require.Equal(t, 307, status)
+		target, err := url.Parse(location)
+		require.NoError(t, err)
+		assert.Equal(t, "/docs/guides/intro page", target.Path)
+		assert.Equal(t, url.Values{"lang": {"en"}, "v": {"2"}, "ref": {"x"}}, target.Query())
+
+		// Management routes below the shortlink keep working
+		status, _ = env.Send(t, "GET", "/u/"+id+"/stats", "")
+		assert.Equal(t, 200, status)
+
+		// Without passthrough, path suffixes aren't redirected
+		other := env.CreateShortlink(t, `{"url": "https://example.com/", "title": "Home"}`)
+		status, _ = redirect("/u/"+other+"/extra", nil)
+		assert.NotEqual(t, 307, status)
+		_, location = redirect("/u/"+other+"?x=1", nil)
+		assert.Equal(t, "https://example.com/", location)
+	})
+
+	t.Run("utm templates", func(t *testing.T) {
+		id := env.CreateShortlink(t, `{
+			"url": "https://example.com/pricing?utm_medium=newsletter",
+			"title": "Pricing",
+			"passthrough": true,
+			"utm": {"source": "{referrer}", "medium": "shortlink", "campaign": "launch-{date}", "term": "{id}", "content": "{variant}"}
+		}`)
+
+		_, location := redirect("/u/"+id+"?utm_source=mastodon", map[string]string{"Referer": "https://news.example.org/item?id=1"})
+		target, err := url.Parse(location)
+		require.NoError(t, err)
+		assert.Equal(t, url.Values{
+			"utm_source":   {"mastodon"},
+			"utm_medium":   {"newsletter"},
+			"utm_campaign": {"launch-" + time.Now().Format("2006-01-02")},
+			"utm_term":     {id},
+		}, target.Query(), "existing parameters win and empty templates are left out")
+
+		_, location = redirect("/u/"+id, map[string]string{"Referer": "https://news.example.org/item?id=1"})
+		target, err = url.Parse(location)
+		require.NoError(t, err)
+		assert.Equal(t, "news.example.org", target.Query().Get("utm_source"))
+	})
+}
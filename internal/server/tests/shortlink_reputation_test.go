@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+// blockedHosts is a reputation source blocking a fixed set of hosts
+type blockedHosts map[string]bool
+
+func (b blockedHosts) Name() string { return "test" }
+
+func (b blockedHosts) Lookup(u *url.URL) (string, bool) {
+	return u.Hostname(), b[u.Hostname()]
+}
+
+func TestShortlinkReputation(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	blocked := blockedHosts{"evil.example": true}
+	env.Server.GetServices().Reputation.Add(blocked)
+
+	t.Run("blocked destinations can't be saved", func(t *testing.T) {
+		status, _ := env.SendJSON(t, "POST", "/u/", `{"url": "https://evil.example/login", "title": "Login"}`)
+		assert.Equal(t, 403, status)
+
+		status, _ = env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/", "title": "Rules", "rules": [{"url": "https://evil.example/", "countries": ["US"]}]}`)
+		assert.Equal(t, 403, status)
+
+		status, data := env.SendJSON(t, "POST", "/u/batch", `{"items": [{"url": "https://example.com/a", "title": "A"}, {"url": "https://evil.example/b", "title": "B"}]}`)
+		require.Equal(t, 207, status, data)
+		assert.Equal(t, float64(1), data["succeeded"])
+		results := data["results"].([]any)
+		assert.Equal(t, float64(403), results[1].(map[string]any)["status"])
+
+		status, shortlink := env.SendJSON(t, "POST", "/u/", `{"url": "https://example.com/", "title": "Fine"}`)
+		require.Equal(t, 200, status)
+		id := shortlink["id"].(string)
+		status, _ = env.SendJSON(t, "PATCH", "/u/"+id, `{"url": "https://evil.example/"}`)
+		assert.Equal(t, 403, status)
+	})
+
+	t.Run("redirects are checked when configured", func(t *testing.T) {
+		status, shortlink := env.SendJSON(t, "POST", "/u/", `{"url": "https://later.example/", "title": "Later"}`)
+		require.Equal(t, 200, status)
+		id := shortlink["id"].(string)
+
+		// The list picks the destination up after the link was made
+		blocked["later.example"] = true
+
+		status, _ = env.SendJSON(t, "GET", "/u/"+id, "")
+		assert.Equal(t, 307, status, "redirects aren't checked by default")
+
+		env.Server.GetConfig().Server.Shortlinks.Reputation.CheckRedirects = true
+		defer func() { env.Server.GetConfig().Server.Shortlinks.Reputation.CheckRedirects = false }()
+
+		status, _ = env.SendJSON(t, "GET", "/u/"+id, "")
+		assert.Equal(t, 403, status)
+
+		var stored models.Shortlink
+		require.NoError(t, env.DB.First(&stored, "id = ?", id).Error)
+		assert.Equal(t, 1, stored.Clicks, "blocked visits aren't counted")
+	})
+}
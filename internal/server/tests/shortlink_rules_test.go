@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+const (
+	iPhoneUserAgent  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	androidUserAgent = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+	desktopUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+)
+
+func TestShortlinkRules(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	redirect := func(id string, headers map[string]string) string {
+		req := httptest.NewRequest("GET", "/u/"+id, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, 307, resp.StatusCode)
+		return resp.Header.Get("Location")
+	}
+
+	tomorrow := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	status, data := env.Send(t, "POST", "/u/", `{
+		"url": "https://example.com/",
+		"title": "App",
+		"rules": [
+			{"url": "https://example.com/launch", "starts_at": "`+tomorrow+`"},
+			{"url": "https://apps.apple.com/app/id1", "devices": ["iOS"]},
+			{"url": "https://play.google.com/store/apps/details?id=app", "devices": ["android"]},
+			{"url": "https://example.com/de", "languages": ["de"]},
+			{"url": "https://example.com/mobile", "devices": ["mobile", "tablet"]}
+		]
+	}`)
+	require.Equal(t, 200, status, string(data))
+
+	var shortlink struct {
+		ID    string           `json:"id"`
+		Rules []map[string]any `json:"rules"`
+	}
+	require.NoError(t, json.Unmarshal(data, &shortlink))
+	require.Len(t, shortlink.Rules, 5)
+	assert.Equal(t, []any{"ios"}, shortlink.Rules[1]["devices"])
+
+	t.Run("first matching rule wins", func(t *testing.T) {
+		assert.Equal(t, "https://apps.apple.com/app/id1", redirect(shortlink.ID, map[string]string{"User-Agent": iPhoneUserAgent}))
+		assert.Equal(t, "https://play.google.com/store/apps/details?id=app", redirect(shortlink.ID, map[string]string{
+			"User-Agent":      androidUserAgent,
+			"Accept-Language": "de-DE,de;q=0.9",
+		}))
+		assert.Equal(t, "https://example.com/de", redirect(shortlink.ID, map[string]string{
+			"User-Agent":      desktopUserAgent,
+			"Accept-Language": "fr;q=0.5, de-AT",
+		}))
+	})
+
+	t.Run("falls back to the target", func(t *testing.T) {
+		assert.Equal(t, "https://example.com/", redirect(shortlink.ID, map[string]string{
+			"User-Agent":      desktopUserAgent,
+			"Accept-Language": "en-US, de;q=0",
+		}))
+		assert.Equal(t, "https://example.com/", redirect(shortlink.ID, nil))
+	})
+
+	t.Run("invalid rules", func(t *testing.T) {
+		for _, rules := range []string{
+			`[{"url": "https://example.com/x", "devices": ["fridge"]}]`,
+			`[{"url": "https://example.com/x", "countries": ["Germany"]}]`,
+			`[{"url": "https://example.com/x", "from": "9am", "to": "17:00"}]`,
+			`[{"url": "https://example.com/x", "from": "09:00"}]`,
+			`[{"url": "https://example.com/x", "timezone": "Mars/Olympus"}]`,
+			`[{"url": "javascript:alert(1)", "devices": ["ios"]}]`,
+		} {
+			status, _ := env.Send(t, "PATCH", "/u/"+shortlink.ID, `{"rules": `+rules+`}`)
+			assert.Equal(t, 400, status, rules)
+		}
+	})
+
+	t.Run("rules can be replaced and removed", func(t *testing.T) {
+		status, data := env.Send(t, "PATCH", "/u/"+shortlink.ID, `{"rules": [
+			{"url": "https://example.com/always", "days": ["mon", "tue", "wed", "thu", "fri", "sat", "sun"], "from": "00:00", "to": "00:00", "timezone": "Asia/Tokyo"}
+		]}`)
+		require.Equal(t, 200, status, string(data))
+		// A window from midnight to midnight wraps around the whole day
+		assert.Equal(t, "https://example.com/always", redirect(shortlink.ID, map[string]string{"User-Agent": iPhoneUserAgent}))
+
+		status, data = env.Send(t, "PATCH", "/u/"+shortlink.ID, `{"rules": []}`)
+		require.Equal(t, 200, status, string(data))
+		assert.Equal(t, "https://example.com/", redirect(shortlink.ID, map[string]string{"User-Agent": iPhoneUserAgent}))
+	})
+}
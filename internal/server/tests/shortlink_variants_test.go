@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestShortlinkVariants(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	// redirect follows the shortlink, returning the target and the variant cookie set
+	redirect := func(id, cookie string) (string, string) {
+		req := httptest.NewRequest("GET", "/u/"+id, nil)
+		if cookie != "" {
+			req.Header.Set("Cookie", "variant_"+id+"="+cookie)
+		}
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, 307, resp.StatusCode)
+
+		for _, c := range resp.Cookies() {
+			if c.Name == "variant_"+id {
+				return resp.Header.Get("Location"), c.Value
+			}
+		}
+		return resp.Header.Get("Location"), ""
+	}
+
+	status, data := env.Send(t, "POST", "/u/", `{
+		"url": "https://example.com/landing",
+		"title": "Landing",
+		"variants": [
+			{"name": "Control", "url": "https://example.com/landing", "weight": 3},
+			{"name": "new-hero", "url": "https://example.com/landing-v2"}
+		]
+	}`)
+	require.Equal(t, 200, status, string(data))
+
+	var shortlink struct {
+		ID       string                   `json:"id"`
+		Variants models.ShortlinkVariants `json:"variants"`
+	}
+	require.NoError(t, json.Unmarshal(data, &shortlink))
+	assert.Equal(t, models.ShortlinkVariants{
+		{Name: "control", URL: "https://example.com/landing", Weight: 3},
+		{Name: "new-hero", URL: "https://example.com/landing-v2", Weight: 1},
+	}, shortlink.Variants)
+
+	targets := map[string]string{
+		"control":  "https://example.com/landing",
+		"new-hero": "https://example.com/landing-v2",
+	}
+
+	t.Run("assignment is sticky", func(t *testing.T) {
+		target, assigned := redirect(shortlink.ID, "")
+		require.Contains(t, targets, assigned)
+		assert.Equal(t, targets[assigned], target)
+
+		// The same visitor without the cookie is assigned the same variant again
+		target, _ = redirect(shortlink.ID, "")
+		assert.Equal(t, targets[assigned], target)
+
+		// The cookie wins over the IP address
+		target, cookie := redirect(shortlink.ID, "new-hero")
+		assert.Equal(t, targets["new-hero"], target)
+		assert.Empty(t, cookie, "a valid cookie isn't set again")
+
+		// Cookies naming a variant that no longer exists are replaced
+		target, cookie = redirect(shortlink.ID, "removed")
+		assert.Equal(t, targets[assigned], target)
+		assert.Equal(t, assigned, cookie)
+	})
+
+	t.Run("stats per variant", func(t *testing.T) {
+		status, data := env.Send(t, "GET", "/u/"+shortlink.ID+"/stats", "")
+		require.Equal(t, 200, status, string(data))
+
+		var stats struct {
+			Variants map[string]int64 `json:"variants"`
+		}
+		require.NoError(t, json.Unmarshal(data, &stats))
+		assert.Len(t, stats.Variants, 2)
+		assert.Equal(t, int64(4), stats.Variants["control"]+stats.Variants["new-hero"])
+		assert.GreaterOrEqual(t, stats.Variants["new-hero"], int64(1))
+	})
+
+	t.Run("invalid variants", func(t *testing.T) {
+		for _, variants := range []string{
+			`[{"name": "only", "url": "https://example.com/a"}]`,
+			`[{"name": "a", "url": "https://example.com/a"}, {"name": "A", "url": "https://example.com/b"}]`,
+			`[{"name": "a", "url": "https://example.com/a", "weight": -1}, {"name": "b", "url": "https://example.com/b"}]`,
+			`[{"name": "a b", "url": "https://example.com/a"}, {"name": "b", "url": "https://example.com/b"}]`,
+			`[{"name": "a", "url": "/relative"}, {"name": "b", "url": "https://example.com/b"}]`,
+		} {
+			status, _ := env.Send(t, "PATCH", "/u/"+shortlink.ID, `{"variants": `+variants+`}`)
+			assert.Equal(t, 400, status, variants)
+		}
+	})
+
+	t.Run("variants can be removed", func(t *testing.T) {
+		status, data := env.Send(t, "PATCH", "/u/"+shortlink.ID, `{"variants": []}`)
+		require.Equal(t, 200, status, string(data))
+
+		target, cookie := redirect(shortlink.ID, "new-hero")
+		assert.Equal(t, "https://example.com/landing", target)
+		assert.Empty(t, cookie)
+	})
+}
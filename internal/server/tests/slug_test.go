@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/services"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestCustomSlugs(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	testData := []struct {
+		name           string
+		path           string
+		body           string
+		withAuth       bool
+		prefix         string
+		expectedStatus int
+		expectedID     string
+	}{
+		{
+			name:           "paste with slug",
+			path:           "/p/",
+			body:           `{"content": "hello", "slug": "hello-world"}`,
+			withAuth:       true,
+			expectedStatus: 200,
+			expectedID:     "hello-world",
+		},
+		{
+			name:           "paste with taken slug",
+			path:           "/p/",
+			body:           `{"content": "hello again", "slug": "hello-world"}`,
+			withAuth:       true,
+			expectedStatus: 409,
+		},
+		{
+			name:           "paste with slug and no api key",
+			path:           "/p/",
+			body:           `{"content": "hello", "slug": "anonymous"}`,
+			withAuth:       false,
+			expectedStatus: 401,
+		},
+		{
+			name:           "paste with reserved slug",
+			path:           "/p/",
+			body:           `{"content": "hello", "slug": "list"}`,
+			withAuth:       true,
+			expectedStatus: 400,
+		},
+		{
+			name:           "shortlink with slug",
+			path:           "/u/",
+			body:           `{"url": "https://example.com", "title": "Example", "slug": "example"}`,
+			withAuth:       true,
+			expectedStatus: 200,
+			expectedID:     "example",
+		},
+		{
+			name:           "shortlink with taken slug",
+			path:           "/u/",
+			body:           `{"url": "https://example.com", "title": "Example", "slug": "example"}`,
+			withAuth:       true,
+			expectedStatus: 409,
+		},
+		{
+			name:           "shortlink with invalid slug",
+			path:           "/u/",
+			body:           `{"url": "https://example.com", "title": "Example", "slug": "no/slashes"}`,
+			withAuth:       true,
+			expectedStatus: 400,
+		},
+		{
+			name:           "shortlink slug namespaced by prefix",
+			path:           "/u/",
+			body:           `{"url": "https://example.com", "title": "Example", "slug": "docs-home"}`,
+			withAuth:       true,
+			prefix:         "acme",
+			expectedStatus: 200,
+			expectedID:     "acme-docs-home",
+		},
+	}
+
+	for _, tt := range testData {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, env.DB.Model(&models.APIKey{}).
+				Where("key = ?", "test-api-key").
+				Update("shortlink_prefix", tt.prefix).Error)
+
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.withAuth {
+				req.Header.Set("Authorization", "Bearer test-api-key")
+			}
+
+			resp, err := env.App.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			if tt.expectedID == "" {
+				return
+			}
+
+			var response services.PasteResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+			assert.Equal(t, tt.expectedID, response.ID)
+
+			// The slug resolves like any generated ID
+			lookup := "/p/" + tt.expectedID + "/raw"
+			if tt.path == "/u/" {
+				lookup = "/u/" + tt.expectedID
+			}
+			resp, err = env.App.Test(httptest.NewRequest("GET", lookup, nil))
+			require.NoError(t, err)
+			assert.Less(t, resp.StatusCode, 400)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/server/sshd"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHServer(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	cfg := *env.Server.GetConfig()
+	cfg.Server.SSH.Address = "127.0.0.1:0"
+	cfg.Server.SSH.HostKey = filepath.Join(env.TempDir, "ssh", "host_key")
+	cfg.Server.SSH.MaxConnections = 2
+
+	server, err := sshd.NewServer(env.Logger, &cfg, env.Server.GetServices(), env.Server.GetMiddleware().RateLimit)
+	require.NoError(t, err)
+	require.NoError(t, server.Listen())
+	go func() { _ = server.Serve() }()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	newSigner := func() ssh.Signer {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		signer, err := ssh.NewSignerFromKey(priv)
+		require.NoError(t, err)
+		return signer
+	}
+
+	linked := newSigner()
+	anonymous := newSigner()
+
+	// Link the first key to the test API key
+	body, err := json.Marshal(map[string]string{
+		"public_key": string(ssh.MarshalAuthorizedKey(linked.PublicKey())),
+		"comment":    "laptop",
+	})
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "/keys/ssh", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer test-api-key")
+	resp, err := env.App.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+
+	run := func(signer ssh.Signer, command, stdin string) (string, string, int) {
+		client, err := ssh.Dial("tcp", server.Addr().String(), &ssh.ClientConfig{
+			User:            "paste",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		})
+		require.NoError(t, err)
+		defer client.Close()
+
+		session, err := client.NewSession()
+		require.NoError(t, err)
+		defer session.Close()
+
+		var stdout, stderr bytes.Buffer
+		session.Stdin = strings.NewReader(stdin)
+		session.Stdout = &stdout
+		session.Stderr = &stderr
+
+		if command == "" {
+			require.NoError(t, session.Shell())
+			err = session.Wait()
+		} else {
+			err = session.Run(command)
+		}
+
+		status := 0
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			status = exitErr.ExitStatus()
+		} else {
+			require.NoError(t, err)
+		}
+		return stdout.String(), stderr.String(), status
+	}
+
+	idFromURL := func(url string) string {
+		id := strings.TrimSpace(url)
+		id = id[strings.LastIndex(id, "/")+1:]
+		return strings.TrimSuffix(id, ".txt")
+	}
+
+	t.Run("unlinked keys are refused", func(t *testing.T) {
+		_, err := ssh.Dial("tcp", server.Addr().String(), &ssh.ClientConfig{
+			User:            "paste",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(anonymous)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		})
+		assert.ErrorContains(t, err, "unable to authenticate")
+	})
+
+	// The remaining tests use the unlinked key anonymously
+	cfg.Server.SSH.Anonymous = true
+
+	t.Run("anonymous upload and get", func(t *testing.T) {
+		stdout, stderr, status := run(anonymous, "", "hello over ssh\n")
+		require.Equal(t, 0, status, stderr)
+		require.Contains(t, stdout, "/p/")
+
+		content, _, status := run(anonymous, "get "+idFromURL(stdout), "")
+		require.Equal(t, 0, status)
+		assert.Equal(t, "hello over ssh\n", content)
+	})
+
+	t.Run("anonymous list is refused", func(t *testing.T) {
+		_, stderr, status := run(anonymous, "list", "")
+		assert.Equal(t, 1, status)
+		assert.Contains(t, stderr, "linked to an API key")
+	})
+
+	t.Run("linked key lifecycle", func(t *testing.T) {
+		stdout, stderr, status := run(linked, "upload --expires 1h notes.txt", "linked content\n")
+		require.Equal(t, 0, status, stderr)
+		id := idFromURL(stdout)
+
+		paste, err := env.Server.GetServices().Paste.GetPaste(id)
+		require.NoError(t, err)
+		assert.Equal(t, "test-api-key", paste.APIKey)
+		assert.Equal(t, "notes.txt", paste.Filename)
+		require.NotNil(t, paste.ExpiresAt)
+
+		listing, _, status := run(linked, "list", "")
+		require.Equal(t, 0, status)
+		assert.Contains(t, listing, id)
+
+		// Other keys can't delete it
+		_, _, status = run(anonymous, "delete "+id, "")
+		assert.Equal(t, 1, status)
+
+		out, _, status := run(linked, "delete "+id, "")
+		require.Equal(t, 0, status)
+		assert.Contains(t, out, "deleted")
+
+		_, stderr, status = run(linked, "get "+id, "")
+		assert.Equal(t, 1, status)
+		assert.Contains(t, stderr, "not found")
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		_, stderr, status := run(anonymous, "frobnicate", "")
+		assert.Equal(t, 1, status)
+		assert.Contains(t, stderr, "unknown command")
+	})
+
+	t.Run("list limit is clamped", func(t *testing.T) {
+		for range 2 {
+			_, stderr, status := run(linked, "", "clamped\n")
+			require.Equal(t, 0, status, stderr)
+		}
+
+		// A negative limit would otherwise mean no limit at all
+		listing, _, status := run(linked, "list --limit -1", "")
+		require.Equal(t, 0, status)
+		assert.Len(t, strings.Split(strings.TrimSpace(listing), "\n"), 2, listing)
+	})
+
+	dial := func() (*ssh.Client, error) {
+		return ssh.Dial("tcp", server.Addr().String(), &ssh.ClientConfig{
+			User:            "paste",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(linked)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		})
+	}
+
+	t.Run("connection limit", func(t *testing.T) {
+		// Let the connections of earlier tests wind down
+		time.Sleep(100 * time.Millisecond)
+
+		for range 2 {
+			client, err := dial()
+			require.NoError(t, err)
+			defer client.Close()
+		}
+
+		_, err := dial()
+		assert.Error(t, err)
+	})
+
+	t.Run("idle connections are closed", func(t *testing.T) {
+		time.Sleep(100 * time.Millisecond)
+		cfg.Server.SSH.IdleTimeout = 200 * time.Millisecond
+
+		client, err := dial()
+		require.NoError(t, err)
+		defer client.Close()
+
+		closed := make(chan struct{})
+		go func() {
+			_ = client.Wait()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(3 * time.Second):
+			t.Fatal("idle connection was never closed")
+		}
+	})
+}
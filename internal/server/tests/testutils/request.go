@@ -0,0 +1,69 @@
+package testutils
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Anonymous leaves the test API key out of a request made with Send
+var Anonymous = map[string]string{"Authorization": ""}
+
+// Send makes a request with a JSON body, authorized with the test API key, and
+// returns the status and body of the response. Headers are set on top of those;
+// an empty value removes a header.
+func (env *TestEnv) Send(t *testing.T, method, path, body string, headers ...map[string]string) (int, []byte) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer test-api-key")
+	for _, h := range headers {
+		for k, v := range h {
+			if v == "" {
+				req.Header.Del(k)
+			} else {
+				req.Header.Set(k, v)
+			}
+		}
+	}
+
+	resp, err := env.App.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// SendJSON is Send for JSON responses, decoding the body into a map. Bodies that
+// aren't a JSON object decode to nil.
+func (env *TestEnv) SendJSON(t *testing.T, method, path, body string, headers ...map[string]string) (int, map[string]any) {
+	t.Helper()
+
+	status, data := env.Send(t, method, path, body, headers...)
+	var decoded map[string]any
+	_ = json.Unmarshal(data, &decoded)
+	return status, decoded
+}
+
+// CreateShortlink creates a shortlink from a JSON body with Send and returns its
+// ID, failing the test unless it was created.
+func (env *TestEnv) CreateShortlink(t *testing.T, body string, headers ...map[string]string) string {
+	t.Helper()
+
+	status, shortlink := env.SendJSON(t, "POST", "/u/", body, headers...)
+	if status != 200 {
+		t.Fatalf("creating shortlink: status %d: %v", status, shortlink)
+	}
+	return shortlink["id"].(string)
+}
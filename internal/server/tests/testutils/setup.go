@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/watzon/0x45/internal/config"
@@ -69,6 +70,19 @@ func SetupTestEnv(t *testing.T) *TestEnv {
 			ServerHeader:      "0x45-test",
 			ViewsDirectory:    viewsDir,
 			PublicDirectory:   pubDir,
+			Shortlinks: config.ShortlinkConfig{
+				// Off unless a test turns it on, with a limit tests can reach
+				Anonymous: config.AnonymousConfig{
+					Expiry:    24 * time.Hour,
+					MaxExpiry: 7 * 24 * time.Hour,
+					Limit:     5,
+					Window:    time.Hour,
+				},
+				Passwords: config.PasswordConfig{
+					Limit:  3,
+					Window: time.Hour,
+				},
+			},
 		},
 		Retention: config.RetentionConfig{
 			NoKey: config.RetentionLimitConfig{
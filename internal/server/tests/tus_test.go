@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/watzon/0x45/internal/models"
+	"github.com/watzon/0x45/internal/server/tests/testutils"
+)
+
+func TestTusUpload(t *testing.T) {
+	env := testutils.SetupTestEnv(t)
+	defer env.CleanupFn()
+
+	content := "first chunk|second chunk"
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("notes.txt")) +
+		",title " + base64.StdEncoding.EncodeToString([]byte("Meeting notes")) +
+		",tags " + base64.StdEncoding.EncodeToString([]byte("work, Notes"))
+
+	create := func(length int) string {
+		req := httptest.NewRequest("POST", "/p/tus", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", strconv.Itoa(length))
+		req.Header.Set("Upload-Metadata", metadata)
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, 201, resp.StatusCode)
+
+		location := resp.Header.Get("Location")
+		require.Contains(t, location, "/p/tus/")
+		assert.NotEmpty(t, resp.Header.Get("Upload-Expires"))
+		return location[strings.Index(location, "/p/tus/"):]
+	}
+
+	patch := func(path string, offset int, chunk string) *testResponse {
+		req := httptest.NewRequest("PATCH", path, strings.NewReader(chunk))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		return &testResponse{status: resp.StatusCode, header: resp.Header.Get}
+	}
+
+	head := func(path string) *testResponse {
+		req := httptest.NewRequest("HEAD", path, nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		return &testResponse{status: resp.StatusCode, header: resp.Header.Get}
+	}
+
+	t.Run("options", func(t *testing.T) {
+		req := httptest.NewRequest("OPTIONS", "/p/tus", nil)
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, 204, resp.StatusCode)
+		assert.Equal(t, "1.0.0", resp.Header.Get("Tus-Version"))
+		assert.Contains(t, resp.Header.Get("Tus-Extension"), "creation")
+		assert.Equal(t, strconv.Itoa(env.Config.Server.DefaultUploadSize), resp.Header.Get("Tus-Max-Size"))
+
+		// API keys get their own, larger limit
+		req = httptest.NewRequest("OPTIONS", "/p/tus", nil)
+		req.Header.Set("Authorization", "Bearer test-api-key")
+		resp, err = env.App.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(env.Config.Server.APIUploadSize), resp.Header.Get("Tus-Max-Size"))
+	})
+
+	t.Run("upload exceeding the key's limit", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/p/tus", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", strconv.Itoa(env.Config.Server.DefaultUploadSize+1))
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, 413, resp.StatusCode)
+		assert.Equal(t, strconv.Itoa(env.Config.Server.DefaultUploadSize), resp.Header.Get("Tus-Max-Size"))
+	})
+
+	t.Run("missing version", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/p/tus", nil)
+		req.Header.Set("Upload-Length", "10")
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, 412, resp.StatusCode)
+	})
+
+	t.Run("chunked upload", func(t *testing.T) {
+		path := create(len(content))
+
+		first := strings.Index(content, "|") + 1
+		resp := patch(path, 0, content[:first])
+		require.Equal(t, 204, resp.status)
+		assert.Equal(t, strconv.Itoa(first), resp.header("Upload-Offset"))
+
+		resp = head(path)
+		require.Equal(t, 200, resp.status)
+		assert.Equal(t, strconv.Itoa(first), resp.header("Upload-Offset"))
+		assert.Equal(t, strconv.Itoa(len(content)), resp.header("Upload-Length"))
+		assert.Equal(t, metadata, resp.header("Upload-Metadata"))
+
+		// Resending from a stale offset is rejected
+		resp = patch(path, 0, content[:first])
+		assert.Equal(t, 409, resp.status)
+
+		resp = patch(path, first, content[first:])
+		require.Equal(t, 204, resp.status)
+		assert.Equal(t, strconv.Itoa(len(content)), resp.header("Upload-Offset"))
+
+		pasteURL := resp.header("X-Paste-Url")
+		require.NotEmpty(t, pasteURL)
+		assert.NotEmpty(t, resp.header("X-Paste-Delete-Url"))
+
+		req := httptest.NewRequest("GET", "/p/"+resp.header("X-Paste-Id")+"/raw", nil)
+		rawResp, err := env.App.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, rawResp.StatusCode)
+		body, err := io.ReadAll(rawResp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(body))
+
+		paste, err := env.Server.GetServices().Paste.GetPaste(resp.header("X-Paste-Id"))
+		require.NoError(t, err)
+		assert.Equal(t, "Meeting notes", paste.Title)
+		assert.Equal(t, models.Tags{"work", "notes"}, paste.Tags)
+
+		resp = head(path)
+		assert.Equal(t, pasteURL, resp.header("X-Paste-Url"))
+	})
+
+	t.Run("concurrent chunks", func(t *testing.T) {
+		path := create(len(content))
+		first := strings.Index(content, "|") + 1
+
+		// Several clients race for the same offset with chunks of the same length. Only
+		// one may win, and the losers must not touch the chunk it stored.
+		chunks := []string{content[:first], "FIRST CHUNK|", "first-chunk|", "First Chunk|"}
+		statuses := make([]int, len(chunks))
+		var wg sync.WaitGroup
+		for i, chunk := range chunks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req := httptest.NewRequest("PATCH", path, strings.NewReader(chunk))
+				req.Header.Set("Tus-Resumable", "1.0.0")
+				req.Header.Set("Content-Type", "application/offset+octet-stream")
+				req.Header.Set("Upload-Offset", "0")
+				if resp, err := env.App.Test(req); err == nil {
+					statuses[i] = resp.StatusCode
+				}
+			}()
+		}
+		wg.Wait()
+
+		winner := ""
+		for i, status := range statuses {
+			if status == 204 {
+				require.Empty(t, winner, "only one chunk may be accepted")
+				winner = chunks[i]
+			} else {
+				assert.Equal(t, 409, status)
+			}
+		}
+		require.NotEmpty(t, winner)
+
+		resp := patch(path, first, content[first:])
+		require.Equal(t, 204, resp.status)
+
+		req := httptest.NewRequest("GET", "/p/"+resp.header("X-Paste-Id")+"/raw", nil)
+		rawResp, err := env.App.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, 200, rawResp.StatusCode)
+		body, err := io.ReadAll(rawResp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, winner+content[first:], string(body))
+	})
+
+	t.Run("chunk exceeding length", func(t *testing.T) {
+		path := create(4)
+		resp := patch(path, 0, "too long")
+		assert.Equal(t, 413, resp.status)
+	})
+
+	t.Run("termination", func(t *testing.T) {
+		path := create(len(content))
+		require.Equal(t, 204, patch(path, 0, "first").status)
+
+		req := httptest.NewRequest("DELETE", path, nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		resp, err := env.App.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, 204, resp.StatusCode)
+
+		assert.Equal(t, 404, head(path).status)
+	})
+}
+
+// testResponse keeps the parts of a response the tus tests look at
+type testResponse struct {
+	status int
+	header func(string) string
+}
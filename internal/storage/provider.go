@@ -12,6 +12,8 @@ type Provider interface {
 	Put(path string, content io.Reader) (string, error)
 	// Get retrieves content at the given path
 	Get(path string) ([]byte, error)
+	// Open returns a reader for the content at the given path without buffering it
+	Open(path string) (io.ReadCloser, error)
 	// Delete removes content at the given path
 	Delete(path string) error
 }
@@ -50,6 +52,10 @@ func (p *StoreProvider) Get(path string) ([]byte, error) {
 	return io.ReadAll(reader)
 }
 
+func (p *StoreProvider) Open(path string) (io.ReadCloser, error) {
+	return p.store.Get(path)
+}
+
 func (p *StoreProvider) Delete(path string) error {
 	return p.store.Delete(path)
 }
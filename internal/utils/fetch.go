@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/watzon/0x45/internal/config"
+)
+
+// Fetch errors, so callers can tell the client what went wrong
+var (
+	ErrFetchBlocked          = errors.New("destination address is not allowed")
+	ErrFetchScheme           = errors.New("only http and https URLs can be fetched")
+	ErrFetchTooManyRedirects = errors.New("too many redirects")
+	ErrFetchTooLarge         = errors.New("response exceeds size limit")
+	ErrFetchStatus           = errors.New("unexpected response status")
+)
+
+// Defaults used when the fetch section of the config is left empty
+const (
+	defaultFetchTimeout      = 10 * time.Second
+	defaultFetchMaxRedirects = 5
+)
+
+// blockedPrefixes are non-public ranges that the netip.Addr helpers don't cover
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which can reach any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("100::/64"),       // discard-only
+	netip.MustParsePrefix("2001::/32"),      // Teredo, which embeds an IPv4 address
+	netip.MustParsePrefix("2002::/16"),      // 6to4, which embeds an IPv4 address
+	netip.MustParsePrefix("fec0::/10"),      // deprecated site-local
+}
+
+// FetchResult is a fetched remote resource
+type FetchResult struct {
+	Content     []byte
+	ContentType string // media type from the Content-Type header, without parameters
+	Filename    string // from Content-Disposition, or the last path segment of the final URL
+	URL         string // the URL after following redirects
+}
+
+// Fetcher retrieves remote URLs on behalf of users without letting them reach
+// internal services. Destinations are checked after DNS resolution, when the
+// connection is made, so every redirect hop and every resolved address is covered.
+type Fetcher struct {
+	client *http.Client
+}
+
+// NewFetcher creates a fetcher using the given settings
+func NewFetcher(cfg config.FetchConfig) *Fetcher {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultFetchTimeout
+	}
+	maxRedirects := cfg.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultFetchMaxRedirects
+	}
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+	}
+	if !cfg.AllowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || IsBlockedAddr(addr) {
+				return ErrFetchBlocked
+			}
+			return nil
+		}
+	}
+
+	transport := &http.Transport{
+		// Never use an environment proxy: it would dial on our behalf and bypass the checks
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &Fetcher{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return ErrFetchTooManyRedirects
+				}
+				return checkFetchURL(req.URL)
+			},
+		},
+	}
+}
+
+// Open requests a URL and returns the response for the caller to read. The body
+// must be closed. Responses other than 2xx are returned as ErrFetchStatus.
+func (f *Fetcher) Open(ctx context.Context, rawURL string) (*http.Response, error) {
+	resp, err := f.do(ctx, http.MethodGet, rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrFetchStatus, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// Check requests a URL without downloading it and returns the status of the final
+// response, after redirects. Servers that don't answer HEAD requests properly are
+// asked again with a GET, whose body is left unread.
+func (f *Fetcher) Check(ctx context.Context, rawURL string) (int, error) {
+	resp, err := f.do(ctx, http.MethodHead, rawURL)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode < 400 {
+			return resp.StatusCode, nil
+		}
+	}
+	if errors.Is(err, ErrFetchBlocked) || errors.Is(err, ErrFetchScheme) {
+		return 0, err
+	}
+
+	resp, err = f.do(ctx, http.MethodGet, rawURL)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// do sends a request through the checked client
+func (f *Fetcher) do(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFetchURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// Surface our own errors rather than the url.Error wrapping them
+		for _, sentinel := range []error{ErrFetchBlocked, ErrFetchScheme, ErrFetchTooManyRedirects} {
+			if errors.Is(err, sentinel) {
+				return nil, sentinel
+			}
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Fetch downloads a URL, failing with ErrFetchTooLarge as soon as more than maxSize
+// bytes have been received
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, maxSize int64) (*FetchResult, error) {
+	resp, err := f.Open(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength > maxSize {
+		return nil, ErrFetchTooLarge
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxSize {
+		return nil, ErrFetchTooLarge
+	}
+
+	result := &FetchResult{
+		Content: content,
+		URL:     resp.Request.URL.String(),
+	}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		result.ContentType = mediaType
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		result.Filename = path.Base(path.Clean("/" + params["filename"]))
+	}
+	if result.Filename == "" || result.Filename == "/" {
+		result.Filename = GetFilenameFromURL(result.URL)
+	}
+
+	return result, nil
+}
+
+// IsBlockedAddr reports whether an address belongs to a loopback, private,
+// link-local or otherwise non-public range
+func IsBlockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFetchURL rejects URLs that can't be fetched, before any connection is made
+func checkFetchURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrFetchScheme
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("missing host in URL %q", u.Redacted())
+	}
+	return nil
+}
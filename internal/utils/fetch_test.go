@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/watzon/0x45/internal/config"
+)
+
+func TestIsBlockedAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{addr: "127.0.0.1", blocked: true},
+		{addr: "10.1.2.3", blocked: true},
+		{addr: "172.16.0.1", blocked: true},
+		{addr: "192.168.1.1", blocked: true},
+		{addr: "169.254.169.254", blocked: true},
+		{addr: "100.64.0.1", blocked: true},
+		{addr: "0.0.0.0", blocked: true},
+		{addr: "255.255.255.255", blocked: true},
+		{addr: "::1", blocked: true},
+		{addr: "fe80::1", blocked: true},
+		{addr: "fd00::1", blocked: true},
+		{addr: "::ffff:127.0.0.1", blocked: true},
+		{addr: "64:ff9b::a9fe:a9fe", blocked: true},
+		{addr: "93.184.216.34", blocked: false},
+		{addr: "2606:4700::1111", blocked: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := IsBlockedAddr(netip.MustParseAddr(tt.addr)); got != tt.blocked {
+				t.Errorf("IsBlockedAddr(%s) = %v, want %v", tt.addr, got, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestFetcher(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="../notes.txt"`)
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		// No Content-Length, so the limit has to be enforced while streaming
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(strings.Repeat("x", 1024)))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/file", http.StatusFound)
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+
+	t.Run("private addresses are blocked", func(t *testing.T) {
+		_, err := NewFetcher(config.FetchConfig{}).Fetch(ctx, server.URL+"/file", 1024)
+		if !errors.Is(err, ErrFetchBlocked) {
+			t.Fatalf("expected ErrFetchBlocked, got %v", err)
+		}
+	})
+
+	t.Run("other schemes are rejected", func(t *testing.T) {
+		_, err := NewFetcher(config.FetchConfig{}).Fetch(ctx, "file:///etc/passwd", 1024)
+		if !errors.Is(err, ErrFetchScheme) {
+			t.Fatalf("expected ErrFetchScheme, got %v", err)
+		}
+	})
+
+	fetcher := NewFetcher(config.FetchConfig{AllowPrivate: true, MaxRedirects: 3})
+
+	t.Run("content and headers", func(t *testing.T) {
+		result, err := fetcher.Fetch(ctx, server.URL+"/redirect", 1024)
+		if err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		if string(result.Content) != "hello" {
+			t.Errorf("Content = %q, want %q", result.Content, "hello")
+		}
+		if result.ContentType != "text/plain" {
+			t.Errorf("ContentType = %q, want %q", result.ContentType, "text/plain")
+		}
+		if result.Filename != "notes.txt" {
+			t.Errorf("Filename = %q, want %q", result.Filename, "notes.txt")
+		}
+		if result.URL != server.URL+"/file" {
+			t.Errorf("URL = %q, want %q", result.URL, server.URL+"/file")
+		}
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		if _, err := fetcher.Fetch(ctx, server.URL+"/big", 100); !errors.Is(err, ErrFetchTooLarge) {
+			t.Fatalf("expected ErrFetchTooLarge, got %v", err)
+		}
+		if _, err := fetcher.Fetch(ctx, server.URL+"/file", 3); !errors.Is(err, ErrFetchTooLarge) {
+			t.Fatalf("expected ErrFetchTooLarge for a declared Content-Length, got %v", err)
+		}
+	})
+
+	t.Run("redirect limit", func(t *testing.T) {
+		if _, err := fetcher.Fetch(ctx, server.URL+"/loop", 1024); !errors.Is(err, ErrFetchTooManyRedirects) {
+			t.Fatalf("expected ErrFetchTooManyRedirects, got %v", err)
+		}
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		if _, err := fetcher.Fetch(ctx, server.URL+"/missing", 1024); !errors.Is(err, ErrFetchStatus) {
+			t.Fatalf("expected ErrFetchStatus, got %v", err)
+		}
+	})
+
+	t.Run("check", func(t *testing.T) {
+		for path, want := range map[string]int{
+			"/redirect": http.StatusOK,
+			"/missing":  http.StatusNotFound,
+			"/no-head":  http.StatusOK,
+		} {
+			status, err := fetcher.Check(ctx, server.URL+path)
+			if err != nil {
+				t.Fatalf("Check(%s) error = %v", path, err)
+			}
+			if status != want {
+				t.Errorf("Check(%s) = %d, want %d", path, status, want)
+			}
+		}
+
+		if _, err := NewFetcher(config.FetchConfig{}).Check(ctx, server.URL+"/file"); !errors.Is(err, ErrFetchBlocked) {
+			t.Fatalf("expected ErrFetchBlocked, got %v", err)
+		}
+	})
+}
@@ -3,6 +3,41 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/watzon/0x45/internal/config"
+)
+
+// ID generation styles
+const (
+	IDStyleRandom        = "random"
+	IDStylePronounceable = "pronounceable"
+	IDStyleWords         = "words"
+)
+
+const (
+	// DefaultIDAlphabet is the URL-safe base64 alphabet, matching MustGenerateID
+	DefaultIDAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+	// MaxIDLength is the longest ID the database columns can hold
+	MaxIDLength = 32
+
+	// MinIDEntropy is the fewest random bits an ID may have, so IDs can't easily
+	// be enumerated. Four base64 characters or three words just reach it.
+	MinIDEntropy = 24
+
+	// maxReservedAttempts bounds how often a reserved ID is replaced before giving up
+	maxReservedAttempts = 100
+
+	// defaultWordCount is used for the words style when no length is configured
+	defaultWordCount = 3
+
+	ambiguousChars = "0O1lI"
+	consonants     = "bcdfghjkmnprstvz"
+	vowels         = "aeiou"
 )
 
 // MustGenerateID creates a URL-safe random string of specified length
@@ -13,3 +48,167 @@ func MustGenerateID(length int) string {
 	}
 	return base64.URLEncoding.EncodeToString(b)[:length]
 }
+
+// GenerateConfiguredID creates an ID using the given settings. defaultLength is used
+// when the settings do not specify a length. IDs that would be shadowed by a route,
+// such as a single word "list", are never returned.
+func GenerateConfiguredID(cfg config.IDConfig, defaultLength int) (string, error) {
+	if err := ValidateIDConfig(cfg); err != nil {
+		return "", err
+	}
+
+	for attempt := 0; attempt < maxReservedAttempts; attempt++ {
+		id, err := generateID(cfg, defaultLength)
+		if err != nil || !IsReservedSlug(id) {
+			return id, err
+		}
+	}
+	return "", fmt.Errorf("no unreserved ID found in %d attempts", maxReservedAttempts)
+}
+
+// generateID creates a single ID using the given settings
+func generateID(cfg config.IDConfig, defaultLength int) (string, error) {
+	length := cfg.Length
+	switch cfg.Style {
+	case IDStyleWords:
+		if length <= 0 {
+			length = defaultWordCount
+		}
+		words := make([]string, length)
+		for i := range words {
+			n, err := randomIndex(len(idWords))
+			if err != nil {
+				return "", err
+			}
+			words[i] = idWords[n]
+		}
+		return strings.Join(words, "-"), nil
+	case IDStylePronounceable:
+		if length <= 0 {
+			length = defaultLength
+		}
+		var sb strings.Builder
+		for i := 0; i < length; i++ {
+			set := consonants
+			if i%2 == 1 {
+				set = vowels
+			}
+			n, err := randomIndex(len(set))
+			if err != nil {
+				return "", err
+			}
+			sb.WriteByte(set[n])
+		}
+		return sb.String(), nil
+	default:
+		if length <= 0 {
+			length = defaultLength
+		}
+		alphabet := idAlphabet(cfg)
+		var sb strings.Builder
+		for i := 0; i < length; i++ {
+			n, err := randomIndex(len(alphabet))
+			if err != nil {
+				return "", err
+			}
+			sb.WriteByte(alphabet[n])
+		}
+		return sb.String(), nil
+	}
+}
+
+// ValidateIDConfig checks that ID settings produce IDs that fit the database and are safe in URLs
+func ValidateIDConfig(cfg config.IDConfig) error {
+	switch cfg.Style {
+	case "", IDStyleRandom, IDStylePronounceable:
+		if cfg.Length > MaxIDLength {
+			return fmt.Errorf("ID length must be at most %d", MaxIDLength)
+		}
+	case IDStyleWords:
+		// Words are joined by dashes, so each one takes its length plus one
+		longest := 0
+		for _, word := range idWords {
+			longest = max(longest, len(word))
+		}
+		if cfg.Length*(longest+1)-1 > MaxIDLength {
+			return fmt.Errorf("word-based IDs can have at most %d words", (MaxIDLength+1)/(longest+1))
+		}
+	default:
+		return fmt.Errorf("unknown ID style %q", cfg.Style)
+	}
+
+	for _, r := range cfg.Alphabet {
+		if !strings.ContainsRune(DefaultIDAlphabet, r) {
+			return fmt.Errorf("ID alphabet may only contain letters, numbers, dashes and underscores, got %q", r)
+		}
+	}
+	if len(idAlphabet(cfg)) < 2 {
+		return fmt.Errorf("ID alphabet must contain at least two distinct characters")
+	}
+
+	if cfg.Length > 0 {
+		if bits := idEntropy(cfg, cfg.Length); bits < MinIDEntropy {
+			return fmt.Errorf("IDs of length %d only have %.0f random bits, at least %d are needed", cfg.Length, bits, MinIDEntropy)
+		}
+	}
+
+	return nil
+}
+
+// idEntropy returns how many random bits an ID of the given length has
+func idEntropy(cfg config.IDConfig, length int) float64 {
+	switch cfg.Style {
+	case IDStyleWords:
+		return float64(length) * math.Log2(float64(len(idWords)))
+	case IDStylePronounceable:
+		// Consonants and vowels alternate, starting with a consonant
+		consonantCount := (length + 1) / 2
+		return float64(consonantCount)*math.Log2(float64(len(consonants))) +
+			float64(length-consonantCount)*math.Log2(float64(len(vowels)))
+	default:
+		return float64(length) * math.Log2(float64(len(idAlphabet(cfg))))
+	}
+}
+
+// ValidateIDsConfig validates the ID settings of every resource type
+func ValidateIDsConfig(cfg config.IDsConfig) error {
+	for resource, idConfig := range map[string]config.IDConfig{
+		"paste":      cfg.Paste,
+		"shortlink":  cfg.Shortlink,
+		"collection": cfg.Collection,
+	} {
+		if err := ValidateIDConfig(idConfig); err != nil {
+			return fmt.Errorf("%s IDs: %w", resource, err)
+		}
+	}
+	return nil
+}
+
+// idAlphabet returns the de-duplicated set of characters random IDs are drawn from
+func idAlphabet(cfg config.IDConfig) string {
+	alphabet := cfg.Alphabet
+	if alphabet == "" {
+		alphabet = DefaultIDAlphabet
+	}
+
+	var sb strings.Builder
+	for _, r := range alphabet {
+		if strings.ContainsRune(sb.String(), r) {
+			continue
+		}
+		if cfg.ExcludeAmbiguous && strings.ContainsRune(ambiguousChars, r) {
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// randomIndex returns a uniformly distributed random number in [0, n)
+func randomIndex(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64()), nil
+}
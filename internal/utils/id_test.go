@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/watzon/0x45/internal/config"
 )
 
 func TestGenerateID(t *testing.T) {
@@ -42,3 +46,108 @@ func TestGenerateID(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateConfiguredID(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.IDConfig
+		pattern string
+	}{
+		{
+			name:    "falls back to the default length",
+			cfg:     config.IDConfig{},
+			pattern: `^[A-Za-z0-9_-]{8}$`,
+		},
+		{
+			name:    "custom length and alphabet",
+			cfg:     config.IDConfig{Length: 12, Alphabet: "abc123"},
+			pattern: `^[abc123]{12}$`,
+		},
+		{
+			name:    "excludes ambiguous characters",
+			cfg:     config.IDConfig{Length: 32, Alphabet: "0O1lIab", ExcludeAmbiguous: true},
+			pattern: `^[ab]{32}$`,
+		},
+		{
+			name:    "pronounceable",
+			cfg:     config.IDConfig{Length: 8, Style: IDStylePronounceable},
+			pattern: `^([bcdfghjkmnprstvz][aeiou]){4}$`,
+		},
+		{
+			name:    "words",
+			cfg:     config.IDConfig{Length: 3, Style: IDStyleWords},
+			pattern: `^[a-z]+-[a-z]+-[a-z]+$`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GenerateConfiguredID(tt.cfg, 8)
+			if err != nil {
+				t.Fatalf("GenerateConfiguredID() error = %v", err)
+			}
+			if !regexp.MustCompile(tt.pattern).MatchString(got) {
+				t.Errorf("GenerateConfiguredID() = %q, want match for %s", got, tt.pattern)
+			}
+		})
+	}
+}
+
+func TestGenerateConfiguredIDSkipsReserved(t *testing.T) {
+	// "p" and "u" are reserved route prefixes, so only "x" may come back
+	for range 50 {
+		got, err := GenerateConfiguredID(config.IDConfig{Alphabet: "pux"}, 1)
+		if err != nil {
+			t.Fatalf("GenerateConfiguredID() error = %v", err)
+		}
+		if got != "x" {
+			t.Fatalf("GenerateConfiguredID() = %q, want %q", got, "x")
+		}
+	}
+
+	if _, err := GenerateConfiguredID(config.IDConfig{Alphabet: "pu"}, 1); err == nil {
+		t.Error("GenerateConfiguredID() should fail when every ID is reserved")
+	}
+}
+
+func TestValidateIDConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.IDConfig
+		wantErr bool
+	}{
+		{name: "empty config", cfg: config.IDConfig{}, wantErr: false},
+		{name: "too long", cfg: config.IDConfig{Length: MaxIDLength + 1}, wantErr: true},
+		{name: "unknown style", cfg: config.IDConfig{Style: "emoji"}, wantErr: true},
+		{name: "too many words", cfg: config.IDConfig{Style: IDStyleWords, Length: 10}, wantErr: true},
+		{name: "unsafe alphabet", cfg: config.IDConfig{Alphabet: "abc./"}, wantErr: true},
+		{name: "alphabet emptied by exclusions", cfg: config.IDConfig{Alphabet: "0O1", ExcludeAmbiguous: true}, wantErr: true},
+		{name: "too short", cfg: config.IDConfig{Length: 3}, wantErr: true},
+		{name: "shortest random", cfg: config.IDConfig{Length: 4}, wantErr: false},
+		{name: "too short for a small alphabet", cfg: config.IDConfig{Length: 12, Alphabet: "ab"}, wantErr: true},
+		{name: "too few words", cfg: config.IDConfig{Style: IDStyleWords, Length: 2}, wantErr: true},
+		{name: "too short pronounceable", cfg: config.IDConfig{Style: IDStylePronounceable, Length: 6}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateIDConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateIDConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIDWords(t *testing.T) {
+	seen := make(map[string]bool, len(idWords))
+	for _, word := range idWords {
+		if seen[word] {
+			t.Errorf("duplicate word %q", word)
+		}
+		seen[word] = true
+		if word != strings.ToLower(word) || strings.Contains(word, "-") {
+			t.Errorf("word %q must be lowercase and contain no dashes", word)
+		}
+	}
+}
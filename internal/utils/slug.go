@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxSlugLength is the longest custom slug accepted, including any prefix
+const MaxSlugLength = 32
+
+var slugPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// reservedSlugs holds words that collide with routes or are likely to confuse users
+var reservedSlugs = map[string]bool{
+	"admin":    true,
+	"api":      true,
+	"archive":  true,
+	"batch":    true,
+	"delete":   true,
+	"docs":     true,
+	"download": true,
+	"expiry":   true,
+	"fork":     true,
+	"image":    true,
+	"keys":     true,
+	"list":     true,
+	"new":      true,
+	"p":        true,
+	"preview":  true,
+	"public":   true,
+	"raw":      true,
+	"search":   true,
+	"stats":    true,
+	"submit":   true,
+	"tus":      true,
+	"u":        true,
+	"upload":   true,
+}
+
+// IsReservedSlug reports whether a slug is reserved for routes or other internal use
+func IsReservedSlug(slug string) bool {
+	return reservedSlugs[strings.ToLower(slug)]
+}
+
+// ValidateSlug checks that a custom slug is safe to use as a paste or shortlink ID
+func ValidateSlug(slug string) error {
+	if len(slug) < 3 {
+		return errors.New("slug must be at least 3 characters")
+	}
+	if len(slug) > MaxSlugLength {
+		return fmt.Errorf("slug must be at most %d characters", MaxSlugLength)
+	}
+	if !slugPattern.MatchString(slug) {
+		return errors.New("slug may only contain letters, numbers, dashes and underscores, and must start with a letter or number")
+	}
+	if IsReservedSlug(slug) {
+		return fmt.Errorf("slug %q is reserved", slug)
+	}
+	return nil
+}
+
+// ApplySlugPrefix namespaces a slug with an API key's prefix, if it has one
+func ApplySlugPrefix(prefix, slug string) string {
+	if prefix == "" || strings.HasPrefix(slug, prefix+"-") {
+		return slug
+	}
+	return prefix + "-" + slug
+}
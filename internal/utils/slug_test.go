@@ -0,0 +1,50 @@
+package utils
+
+import "testing"
+
+func TestValidateSlug(t *testing.T) {
+	tests := []struct {
+		name    string
+		slug    string
+		wantErr bool
+	}{
+		{name: "simple slug", slug: "my-notes", wantErr: false},
+		{name: "underscores and digits", slug: "release_2024", wantErr: false},
+		{name: "too short", slug: "ab", wantErr: true},
+		{name: "too long", slug: "this-slug-is-way-too-long-to-be-accepted", wantErr: true},
+		{name: "leading dash", slug: "-notes", wantErr: true},
+		{name: "contains a dot", slug: "notes.txt", wantErr: true},
+		{name: "contains a slash", slug: "a/b/c", wantErr: true},
+		{name: "reserved route", slug: "list", wantErr: true},
+		{name: "reserved route in another case", slug: "Stats", wantErr: true},
+		{name: "reserved tus route", slug: "tus", wantErr: true},
+		{name: "reserved search route", slug: "search", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSlug(tt.slug)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSlug(%q) error = %v, wantErr %v", tt.slug, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplySlugPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		slug   string
+		want   string
+	}{
+		{prefix: "", slug: "notes", want: "notes"},
+		{prefix: "acme", slug: "notes", want: "acme-notes"},
+		{prefix: "acme", slug: "acme-notes", want: "acme-notes"},
+	}
+
+	for _, tt := range tests {
+		if got := ApplySlugPrefix(tt.prefix, tt.slug); got != tt.want {
+			t.Errorf("ApplySlugPrefix(%q, %q) = %q, want %q", tt.prefix, tt.slug, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+// idWords is the word list used for word-based IDs. Every word is short, lowercase
+// and easy to spell, so IDs can be read aloud.
+var idWords = []string{
+	"able", "acid", "aged", "also", "area", "army", "away", "baby", "back", "bald", "band",
+	"bank", "base", "bath", "bean", "bear", "beat", "bell", "belt", "best", "bird", "blue",
+	"boat", "body", "bold", "bolt", "bone", "book", "boot", "born", "boss", "both", "bowl",
+	"bulk", "burn", "bush", "busy", "cake", "calm", "camp", "card", "care", "cart", "case",
+	"cash", "cast", "cave", "chef", "chip", "city", "clay", "club", "coal", "coat", "code",
+	"cold", "cool", "copy", "core", "corn", "cost", "crew", "crop", "dark", "data", "dawn",
+	"deal", "deep", "deer", "desk", "dial", "dice", "diet", "dish", "dock", "door", "dove",
+	"down", "draw", "drum", "duck", "dune", "dust", "duty", "earl", "earn", "east", "easy",
+	"echo", "edge", "epic", "even", "exit", "face", "fact", "fair", "fall", "farm", "fast",
+	"fern", "film", "fine", "fire", "firm", "fish", "flag", "flat", "fold", "folk", "food",
+	"foot", "fork", "form", "fort", "four", "free", "frog", "fuel", "full", "fund", "gain",
+	"game", "gate", "gear", "gift", "glad", "glow", "goal", "gold", "golf", "good", "gray",
+	"grid", "grin", "grow", "gulf", "hair", "half", "hall", "hand", "hard", "harp", "hawk",
+	"heat", "herb", "hero", "high", "hill", "hint", "hive", "hold", "home", "hood", "hook",
+	"hope", "horn", "host", "hour", "huge", "idea", "inch", "iron", "isle", "jade", "jazz",
+	"join", "joke", "jump", "keen", "kelp", "kind", "king", "kite", "knot", "lake", "lamp",
+	"land", "lane", "last", "leaf", "lean", "left", "lens", "lime", "line", "lion", "list",
+	"loaf", "loud", "luck", "lush", "main", "male", "malt", "mane", "many", "mask", "meal",
+	"mild", "milk", "mind", "mint", "mist", "mode", "moon", "moss", "most", "moth", "much",
+	"mule", "muse", "nail", "name", "navy", "near", "neat", "nest", "next", "nice", "node",
+	"noon", "nose", "note", "oath", "oboe", "odor", "okay", "once", "open", "oval", "oven",
+	"pace", "pack", "page", "pail", "palm", "park", "past", "path", "peak", "pear", "pine",
+	"pink", "plan", "plum", "poem", "pole", "pond", "pony", "pool", "port", "pose", "pure",
+	"quay", "quiz", "race", "raft", "rain", "ramp", "rare", "reef", "rest", "rice", "rich",
+	"ring", "road", "rock", "roof", "room", "root", "rope", "rose", "ruby", "rule", "safe",
+	"sage", "sail", "salt", "sand", "seal", "seed", "ship", "shoe", "silk", "sing", "site",
+	"size", "skip", "slow", "snow", "soap", "sock", "soft", "soil", "song", "soup", "spin",
+	"star", "stem", "step", "suit", "sure", "swan", "tail", "tale", "tall", "teal", "tent",
+	"tide", "tile", "time", "tiny", "toad", "tone", "tool", "tour", "town", "tree", "trim",
+	"tune", "twig", "unit", "vase", "vast", "vine", "vote", "wade", "wall", "warm", "wave",
+	"weed", "well", "west", "whim", "wide", "wild", "wind", "wing", "wise", "wolf", "wood",
+	"wool", "word", "yard", "yarn", "year", "yoga", "zest", "zinc", "zone",
+}
@@ -43,6 +43,12 @@ func main() {
 
 	logger.Info("logger initialized", zap.String("level", logLevel.String()))
 
+	// Maintenance commands run instead of the server, e.g. `0x45 backfill-search`
+	if len(os.Args) > 1 {
+		runCommand(ctx, os.Args[1], cfg, logger)
+		return
+	}
+
 	// Initialize server with storage manager
 	srv := server.New(cfg, logger)
 
@@ -68,6 +74,24 @@ func main() {
 	}
 }
 
+// runCommand runs a one-off maintenance command against the configured database
+func runCommand(ctx context.Context, name string, cfg *config.Config, logger *zap.Logger) {
+	switch name {
+	case "backfill-search":
+		srv := server.New(cfg, logger)
+		defer func() { _ = srv.Cleanup() }()
+
+		indexed, err := srv.GetServices().Search.Backfill(ctx)
+		if err != nil {
+			logger.Error("search backfill failed", zap.Int("indexed", indexed), zap.Error(err))
+			return
+		}
+		logger.Info("search backfill complete", zap.Int("indexed", indexed))
+	default:
+		log.Fatalf("unknown command: %s", name)
+	}
+}
+
 func getLogLevel() zapcore.Level {
 	env := os.Getenv("0X_LOG_LEVEL")
 	if env == "" {